@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/mempool"
+)
+
+// Account builds, signs and sends transactions from one address with a
+// local key. It hands out nonces itself, so transactions sent in a row do
+// not have to wait for each other to be committed. It is safe for
+// concurrent use.
+type Account struct {
+	Address string
+
+	c   *Client
+	key *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	nonce  uint64 // next nonce to use
+	synced bool
+}
+
+// Account returns an Account signing with key, sending from the key's
+// address.
+func (c *Client) Account(key *ecdsa.PrivateKey) *Account {
+	return &Account{Address: core.PubKeyToAddress(&key.PublicKey).Hex(), c: c, key: key}
+}
+
+// Transfer sends amount to to and returns the transaction hash.
+func (a *Account) Transfer(ctx context.Context, to string, amount uint64) (string, error) {
+	return a.Send(ctx, &core.Transaction{Type: core.TxTransfer, To: to, Amount: amount})
+}
+
+// Stake bonds amount as the account's own validator stake.
+func (a *Account) Stake(ctx context.Context, amount uint64) (string, error) {
+	return a.Send(ctx, &core.Transaction{Type: core.TxStake, Amount: amount})
+}
+
+// Delegate bonds amount to validator.
+func (a *Account) Delegate(ctx context.Context, validator string, amount uint64) (string, error) {
+	return a.Send(ctx, &core.Transaction{Type: core.TxDelegate, Validator: validator, Amount: amount})
+}
+
+// Undelegate starts unbonding amount of the stake the account has bonded to
+// validator, its own stake if validator is the account itself. The stake
+// returns to the balance core.UnbondingBlocks after the transaction's
+// block.
+func (a *Account) Undelegate(ctx context.Context, validator string, amount uint64) (string, error) {
+	return a.Send(ctx, &core.Transaction{Type: core.TxUndelegate, Validator: validator, Amount: amount})
+}
+
+// Send fills in, signs and submits tx, and returns its hash. See Build.
+func (a *Account) Send(ctx context.Context, tx *core.Transaction) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.build(ctx, tx); err != nil {
+		return "", err
+	}
+	hash, err := a.c.SendSigned(ctx, tx)
+	if err != nil {
+		// The nonce was not used; ask the node again next time.
+		a.synced = false
+		return "", err
+	}
+	if tx.Nonce >= a.nonce {
+		a.nonce = tx.Nonce + 1
+	}
+	return hash, nil
+}
+
+// Build fills in tx for sending without submitting it: From, the next
+// nonce if Nonce is zero, and the fee the node suggests if MaxFee is zero,
+// then signs it. The nonce is only taken once the transaction is sent:
+// building several transactions before sending them gives them the same
+// nonce unless they set it themselves.
+func (a *Account) Build(ctx context.Context, tx *core.Transaction) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.build(ctx, tx)
+}
+
+func (a *Account) build(ctx context.Context, tx *core.Transaction) error {
+	tx.From = a.Address
+	if tx.Nonce == 0 {
+		nonce, err := a.nextNonce(ctx)
+		if err != nil {
+			return err
+		}
+		tx.Nonce = nonce
+	}
+	if err := a.c.suggestFee(ctx, tx); err != nil {
+		return err
+	}
+	if err := tx.ValidateBasic(); err != nil {
+		return err
+	}
+	return tx.Sign(a.key)
+}
+
+// suggestFee sets the fee of tx from the node's estimate unless MaxFee is
+// already set: the suggested tip unless Tip is set, and room for the base
+// fee to double.
+func (c *Client) suggestFee(ctx context.Context, tx *core.Transaction) error {
+	if tx.MaxFee != 0 {
+		return nil
+	}
+	est, err := c.FeeEstimate(ctx, tx.Type)
+	if err != nil {
+		return err
+	}
+	if tx.Tip == 0 {
+		tx.Tip = est.Tip
+	}
+	tx.MaxFee = 2*est.BaseFee + tx.Tip
+	return nil
+}
+
+// SendSigned submits a signed transaction, such as a multisig transaction
+// with all its signatures, and returns its hash.
+func (c *Client) SendSigned(ctx context.Context, tx *core.Transaction) (string, error) {
+	hash, err := c.SendRawTx(ctx, core.EncodeTx(tx))
+	var rerr *RPCError
+	if errors.As(err, &rerr) && strings.HasSuffix(rerr.Message, mempool.ErrKnown.Error()) {
+		// An earlier attempt got through before failing; see retryable.
+		return tx.HashHex(), nil
+	}
+	return hash, err
+}
+
+// nextNonce returns the nonce for the next transaction. It asks the node
+// when the account is first used, after a failed send and whenever the
+// committed nonce has moved past the local one, e.g. because another
+// client sent from the same address.
+func (a *Account) nextNonce(ctx context.Context) (uint64, error) {
+	acct, err := a.c.GetAccount(ctx, a.Address)
+	if err != nil {
+		return 0, err
+	}
+	if !a.synced || acct.Nonce > a.nonce {
+		a.nonce = acct.Nonce
+		a.synced = true
+	}
+	return a.nonce, nil
+}
+
+// ResetNonce makes the next transaction use the committed nonce, dropping
+// the local count of pending transactions. Use it after a sent
+// transaction was dropped by the node, since later nonces wait for it
+// forever.
+func (a *Account) ResetNonce() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.synced = false
+}
@@ -0,0 +1,279 @@
+// Package client is a Go client for the Graphene RPC API: typed calls to
+// the Graphene.* methods over HTTP, event subscriptions over WebSocket, and
+// accounts that build, sign and send transactions with local keys.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultTimeout    = 30 * time.Second
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = 200 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+	// DefaultPollInterval is how often WaitForTx checks on a transaction.
+	DefaultPollInterval = time.Second
+
+	// maxResponseBytes bounds the size of a response body.
+	maxResponseBytes = 32 << 20
+)
+
+// Config holds the settings for New.
+type Config struct {
+	// URL is the node's RPC address, e.g. http://127.0.0.1:8545. Calls go
+	// to /rpc and subscriptions to /ws under it.
+	URL string
+	// Token is an API key or JWT, sent as a bearer token.
+	Token string
+	// Timeout bounds each HTTP attempt; zero uses DefaultTimeout.
+	Timeout time.Duration
+	// Failed attempts are retried up to MaxRetries times, waiting
+	// MinBackoff, doubling up to MaxBackoff, in between. Only transport
+	// errors and 429, 502, 503 and 504 responses are retried, never errors
+	// returned by a method. A negative MaxRetries disables retries.
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// PollInterval is how often WaitForTx and WaitForFinality poll; zero
+	// uses DefaultPollInterval.
+	PollInterval time.Duration
+	// HTTPClient overrides the client used for calls.
+	HTTPClient *http.Client
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.MinBackoff == 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = DefaultMaxBackoff
+		if cfg.MaxBackoff < cfg.MinBackoff {
+			cfg.MaxBackoff = cfg.MinBackoff
+		}
+	}
+	return cfg
+}
+
+// Client calls the Graphene API of one node. It is safe for concurrent use.
+type Client struct {
+	cfg    Config
+	rpcURL string
+	wsURL  string
+	http   *http.Client
+	nextID uint64
+}
+
+// New returns a client for the node at cfg.URL. It does not connect until
+// the first call.
+func New(cfg Config) (*Client, error) {
+	cfg = cfg.withDefaults()
+	u, err := url.Parse(strings.TrimSuffix(cfg.URL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("client url: %w", err)
+	}
+	ws := *u
+	switch u.Scheme {
+	case "http":
+		ws.Scheme = "ws"
+	case "https":
+		ws.Scheme = "wss"
+	default:
+		return nil, fmt.Errorf("client url: unsupported scheme %q", u.Scheme)
+	}
+	c := &Client{
+		cfg:    cfg,
+		rpcURL: u.String() + "/rpc",
+		wsURL:  ws.String() + "/ws",
+		http:   cfg.HTTPClient,
+	}
+	if c.http == nil {
+		c.http = &http.Client{}
+	}
+	return c, nil
+}
+
+// RPCError is an error returned by a method, as opposed to a failure to
+// reach the node.
+type RPCError struct {
+	Method  string
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return e.Method + ": " + e.Message
+}
+
+// HTTPError is a non-200 response from the node.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	retryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *HTTPError) temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+type request struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	ID     uint64        `json:"id"`
+}
+
+type response struct {
+	Result json.RawMessage `json:"result"`
+	Error  interface{}     `json:"error"`
+	ID     uint64          `json:"id"`
+}
+
+// Call invokes method, such as "Graphene.GetBalance", with args and decodes
+// the result into reply. It is the building block of the typed methods and
+// can reach methods they do not cover.
+func (c *Client) Call(ctx context.Context, method string, args, reply interface{}) error {
+	body, err := json.Marshal(request{
+		Method: method,
+		Params: []interface{}{args},
+		ID:     atomic.AddUint64(&c.nextID, 1),
+	})
+	if err != nil {
+		return err
+	}
+	var resp response
+	for attempt := 0; ; attempt++ {
+		err = c.post(ctx, body, &resp)
+		if err == nil || attempt >= c.cfg.MaxRetries || !retryable(ctx, err) {
+			break
+		}
+		if werr := sleep(ctx, c.backoff(attempt, err)); werr != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if resp.Error != nil {
+		msg, ok := resp.Error.(string)
+		if !ok {
+			bz, _ := json.Marshal(resp.Error)
+			msg = string(bz)
+		}
+		return &RPCError{Method: method, Message: msg}
+	}
+	if reply == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, reply); err != nil {
+		return fmt.Errorf("%s: decode result: %w", method, err)
+	}
+	return nil
+}
+
+func (c *Client) post(ctx context.Context, body []byte, resp *response) error {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.rpcURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	bz, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBytes))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		herr := &HTTPError{StatusCode: res.StatusCode, Body: strings.TrimSpace(string(bz))}
+		if secs, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && secs > 0 {
+			herr.retryAfter = time.Duration(secs) * time.Second
+		}
+		return herr
+	}
+	*resp = response{}
+	return json.Unmarshal(bz, resp)
+}
+
+// retryable reports whether a failed attempt may succeed if repeated.
+// Every method is safe to repeat: transactions are identified by their
+// hash, so a resent one is recognised as already known.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var herr *HTTPError
+	if errors.As(err, &herr) {
+		return herr.temporary()
+	}
+	var serr *json.SyntaxError
+	return !errors.As(err, &serr)
+}
+
+// backoff returns how long to wait before retry attempt+1: exponential with
+// jitter, or what the node asked for in Retry-After.
+func (c *Client) backoff(attempt int, err error) time.Duration {
+	var herr *HTTPError
+	if errors.As(err, &herr) && herr.retryAfter > 0 {
+		if herr.retryAfter > c.cfg.MaxBackoff {
+			return c.cfg.MaxBackoff
+		}
+		return herr.retryAfter
+	}
+	d := c.cfg.MinBackoff
+	for i := 0; i < attempt && d < c.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > c.cfg.MaxBackoff {
+		d = c.cfg.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
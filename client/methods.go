@@ -0,0 +1,200 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+
+	"github.com/rockandcode4/graphene-proto/p2p"
+	"github.com/rockandcode4/graphene-proto/rpc"
+)
+
+// The typed methods below mirror the Graphene.* methods one to one and use
+// the argument and result types of package rpc. Methods whose reply carries
+// an ok flag and an error message return that message as an *RPCError.
+
+func (c *Client) ChainInfo(ctx context.Context) (*rpc.ChainInfoReply, error) {
+	var reply rpc.ChainInfoReply
+	if err := c.Call(ctx, "Graphene.ChainInfo", &rpc.ChainInfoArgs{}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) GetBlockByHeight(ctx context.Context, height uint64, fullTxs bool) (*rpc.BlockResult, error) {
+	var reply rpc.BlockResult
+	if err := c.Call(ctx, "Graphene.GetBlockByHeight", &rpc.BlockByHeightArgs{Height: height, FullTxs: fullTxs}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) GetBlockByHash(ctx context.Context, hash string, fullTxs bool) (*rpc.BlockResult, error) {
+	var reply rpc.BlockResult
+	if err := c.Call(ctx, "Graphene.GetBlockByHash", &rpc.BlockByHashArgs{Hash: hash, FullTxs: fullTxs}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) GetLatestBlock(ctx context.Context, fullTxs bool) (*rpc.BlockResult, error) {
+	var reply rpc.BlockResult
+	if err := c.Call(ctx, "Graphene.GetLatestBlock", &rpc.LatestBlockArgs{FullTxs: fullTxs}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// GetTransaction finds a transaction in a committed block or the mempool.
+func (c *Client) GetTransaction(ctx context.Context, hash string) (*rpc.TxResult, error) {
+	var reply rpc.TxResult
+	if err := c.Call(ctx, "Graphene.GetTransaction", &rpc.TxHashArgs{Hash: hash}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// GetTransactionReceipt fails for transactions that are not committed yet;
+// see WaitForTx.
+func (c *Client) GetTransactionReceipt(ctx context.Context, hash string) (*rpc.ReceiptResult, error) {
+	var reply rpc.ReceiptResult
+	if err := c.Call(ctx, "Graphene.GetTransactionReceipt", &rpc.TxHashArgs{Hash: hash}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) GetLogs(ctx context.Context, args *rpc.LogsArgs) ([]rpc.LogResult, error) {
+	var reply rpc.LogsReply
+	if err := c.Call(ctx, "Graphene.GetLogs", args, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Logs, nil
+}
+
+func (c *Client) GetAccount(ctx context.Context, address string) (*rpc.AccountReply, error) {
+	var reply rpc.AccountReply
+	if err := c.Call(ctx, "Graphene.GetAccount", &rpc.AccountArgs{Address: address}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) GetBalance(ctx context.Context, address string) (uint64, error) {
+	var reply rpc.BalanceReply
+	if err := c.Call(ctx, "Graphene.GetBalance", &rpc.BalanceArgs{Address: address}, &reply); err != nil {
+		return 0, err
+	}
+	return reply.Balance, nil
+}
+
+// FeeEstimate prices a transaction of txType, or just reports the fee
+// market if txType is empty.
+func (c *Client) FeeEstimate(ctx context.Context, txType string) (*rpc.FeeEstimateReply, error) {
+	var reply rpc.FeeEstimateReply
+	if err := c.Call(ctx, "Graphene.FeeEstimate", &rpc.FeeEstimateArgs{Type: txType}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) SimulateTx(ctx context.Context, args *rpc.SimulateTxArgs) (*rpc.SimulateTxReply, error) {
+	var reply rpc.SimulateTxReply
+	if err := c.Call(ctx, "Graphene.SimulateTx", args, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// SendRawTx submits a signed, encoded transaction and returns its hash.
+func (c *Client) SendRawTx(ctx context.Context, raw []byte) (string, error) {
+	var reply rpc.SendRawTxReply
+	if err := c.Call(ctx, "Graphene.SendRawTx", &rpc.SendRawTxArgs{Tx: hex.EncodeToString(raw)}, &reply); err != nil {
+		return "", err
+	}
+	if !reply.Ok {
+		return "", &RPCError{Method: "Graphene.SendRawTx", Message: reply.Error}
+	}
+	return reply.Hash, nil
+}
+
+func (c *Client) GetValidators(ctx context.Context, args *rpc.ValidatorsArgs) (*rpc.ValidatorsReply, error) {
+	var reply rpc.ValidatorsReply
+	if err := c.Call(ctx, "Graphene.GetValidators", args, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// GetValidator looks up a validator at height, 0 meaning the latest block.
+func (c *Client) GetValidator(ctx context.Context, height uint64, address string) (*rpc.ValidatorReply, error) {
+	var reply rpc.ValidatorReply
+	if err := c.Call(ctx, "Graphene.GetValidator", &rpc.ValidatorArgs{Height: height, Address: address}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) GetDelegations(ctx context.Context, height uint64, delegator string) (*rpc.DelegationsReply, error) {
+	var reply rpc.DelegationsReply
+	if err := c.Call(ctx, "Graphene.GetDelegations", &rpc.DelegationsArgs{Height: height, Delegator: delegator}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) GetValidatorDelegations(ctx context.Context, height uint64, validator string) (*rpc.DelegationsReply, error) {
+	var reply rpc.DelegationsReply
+	if err := c.Call(ctx, "Graphene.GetValidatorDelegations", &rpc.ValidatorDelegationsArgs{Height: height, Validator: validator}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) GetUnbonding(ctx context.Context, height uint64, delegator string) (*rpc.UnbondingReply, error) {
+	var reply rpc.UnbondingReply
+	if err := c.Call(ctx, "Graphene.GetUnbonding", &rpc.DelegationsArgs{Height: height, Delegator: delegator}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) GetPendingRewards(ctx context.Context, height uint64, address string) (*rpc.PendingRewardsReply, error) {
+	var reply rpc.PendingRewardsReply
+	if err := c.Call(ctx, "Graphene.GetPendingRewards", &rpc.PendingRewardsArgs{Height: height, Address: address}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) Peers(ctx context.Context) ([]p2p.PeerInfo, error) {
+	var reply rpc.PeersReply
+	if err := c.Call(ctx, "Graphene.Peers", &rpc.PeersArgs{}, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Peers, nil
+}
+
+// AddPeer adds a persistent peer and returns its id. The peer stays
+// persistent even if connecting fails, which is reported as an error.
+func (c *Client) AddPeer(ctx context.Context, address string) (string, error) {
+	var reply rpc.AddPeerReply
+	if err := c.Call(ctx, "Graphene.AddPeer", &rpc.AddPeerArgs{Address: address}, &reply); err != nil {
+		return "", err
+	}
+	return reply.PeerID, replyError("Graphene.AddPeer", reply.Connected, reply.Error)
+}
+
+func (c *Client) RemovePeer(ctx context.Context, peerID string) error {
+	var reply rpc.GenericReply
+	if err := c.Call(ctx, "Graphene.RemovePeer", &rpc.RemovePeerArgs{PeerID: peerID}, &reply); err != nil {
+		return err
+	}
+	return replyError("Graphene.RemovePeer", reply.Ok, reply.Error)
+}
+
+func replyError(method string, ok bool, msg string) error {
+	if ok {
+		return nil
+	}
+	return &RPCError{Method: method, Message: msg}
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"context"
+
+	"github.com/rockandcode4/graphene-proto/core"
+)
+
+// BuildMultisig fills in tx as a transaction from the multisig account ms,
+// ready for its owners to sign offline with SignMultisig: From, Multisig,
+// the account's committed nonce if Nonce is zero and the fee the node
+// suggests if MaxFee is zero. Existing signatures are dropped. The signed
+// copies are merged with core.CombineSignatures and sent with SendSigned.
+func (c *Client) BuildMultisig(ctx context.Context, ms *core.Multisig, tx *core.Transaction) error {
+	tx.From = ms.Address().Hex()
+	tx.Multisig = ms
+	tx.Signature, tx.Signatures = nil, nil
+	if tx.Nonce == 0 {
+		acct, err := c.GetAccount(ctx, tx.From)
+		if err != nil {
+			return err
+		}
+		tx.Nonce = acct.Nonce
+	}
+	if err := c.suggestFee(ctx, tx); err != nil {
+		return err
+	}
+	return tx.ValidateBasic()
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rockandcode4/graphene-proto/rpc"
+)
+
+// ErrTxDropped is returned by WaitForTx for a transaction the node no
+// longer knows: it left the mempool without being committed, or never
+// reached it. An Account that sent it needs ResetNonce.
+var ErrTxDropped = errors.New("client: transaction dropped")
+
+// WaitForTx waits until the transaction with hash is committed and returns
+// its receipt. A failed transaction is committed too; check its Success.
+func (c *Client) WaitForTx(ctx context.Context, hash string) (*rpc.ReceiptResult, error) {
+	for {
+		rcpt, err := c.GetTransactionReceipt(ctx, hash)
+		if err == nil {
+			return rcpt, nil
+		}
+		var rerr *RPCError
+		if !errors.As(err, &rerr) {
+			return nil, err
+		}
+		// No receipt yet: the transaction is pending, was committed since,
+		// or is gone.
+		if _, err := c.GetTransaction(ctx, hash); err != nil {
+			if errors.As(err, &rerr) {
+				return nil, ErrTxDropped
+			}
+			return nil, err
+		}
+		if err := sleep(ctx, c.cfg.PollInterval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// WaitForFinality waits until the transaction with hash is in a finalized
+// block and returns its receipt. Blocks are final once committed today, so
+// this returns as soon as WaitForTx does, but it stays correct should
+// finality ever lag behind the head.
+func (c *Client) WaitForFinality(ctx context.Context, hash string) (*rpc.ReceiptResult, error) {
+	rcpt, err := c.WaitForTx(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		info, err := c.ChainInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if info.FinalizedHeight >= rcpt.BlockHeight {
+			return rcpt, nil
+		}
+		if err := sleep(ctx, c.cfg.PollInterval); err != nil {
+			return nil, err
+		}
+	}
+}
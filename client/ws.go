@@ -0,0 +1,278 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// subQueue is the number of events buffered per subscription. A
+// subscription that falls further behind is dropped with ErrSlowConsumer.
+const subQueue = 256
+
+var (
+	// ErrClosed is returned once the WebSocket connection is closed.
+	ErrClosed = errors.New("client: websocket closed")
+	// ErrSlowConsumer ends a subscription whose events were not read
+	// quickly enough.
+	ErrSlowConsumer = errors.New("client: subscription fell behind")
+)
+
+// WSConn is a WebSocket connection to the node's /ws endpoint, carrying
+// any number of subscriptions. It is safe for concurrent use.
+type WSConn struct {
+	conn *websocket.Conn
+	wmu  sync.Mutex // serialises writes
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]*wsPending
+	subs    map[string]*Subscription
+	err     error // why the connection closed
+	done    chan struct{}
+}
+
+// Subscription receives the events of one topic. Events are decoded with
+// Next: rpc.BlockResult for TopicNewBlocks and TopicFinalizedBlocks,
+// rpc.TxResult for TopicPendingTxs and TopicAddress, and
+// rpc.StakingEventResult for TopicStaking.
+type Subscription struct {
+	ID    string
+	Topic string
+
+	ws     *WSConn
+	events chan json.RawMessage
+	err    error // set before events is closed
+}
+
+type wsCall struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      uint64      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type wsSubscribeParams struct {
+	Topic        string `json:"topic,omitempty"`
+	Address      string `json:"address,omitempty"`
+	Subscription string `json:"subscription,omitempty"`
+}
+
+// wsMessage is either a reply to a call or a notification.
+type wsMessage struct {
+	ID     *uint64         `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+type wsPending struct {
+	method string
+	ch     chan wsReply
+}
+
+type wsReply struct {
+	result json.RawMessage
+	err    error
+}
+
+// DialWS opens a WebSocket connection for subscriptions.
+func (c *Client) DialWS(ctx context.Context) (*WSConn, error) {
+	hdr := http.Header{}
+	if c.cfg.Token != "" {
+		hdr.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+	conn, res, err := websocket.DefaultDialer.DialContext(ctx, c.wsURL, hdr)
+	if err != nil {
+		if res != nil {
+			return nil, fmt.Errorf("dial %s: %w (http %d)", c.wsURL, err, res.StatusCode)
+		}
+		return nil, fmt.Errorf("dial %s: %w", c.wsURL, err)
+	}
+	ws := &WSConn{
+		conn:    conn,
+		pending: make(map[uint64]*wsPending),
+		subs:    make(map[string]*Subscription),
+		done:    make(chan struct{}),
+	}
+	go ws.readLoop()
+	return ws, nil
+}
+
+// Subscribe starts a subscription to topic, one of the rpc.Topic*
+// constants. address is required by rpc.TopicAddress and filters
+// rpc.TopicStaking; other topics ignore it.
+func (ws *WSConn) Subscribe(ctx context.Context, topic, address string) (*Subscription, error) {
+	// Registering the subscription happens in the read loop, before any of
+	// its events can be read, so none are lost.
+	sub := &Subscription{Topic: topic, ws: ws, events: make(chan json.RawMessage, subQueue)}
+	raw, err := ws.call(ctx, "subscribe", wsSubscribeParams{Topic: topic, Address: address}, sub)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &sub.ID); err != nil {
+		return nil, fmt.Errorf("subscribe: %w", err)
+	}
+	return sub, nil
+}
+
+// Close ends all subscriptions and the connection.
+func (ws *WSConn) Close() error {
+	err := ws.conn.Close()
+	<-ws.done
+	return err
+}
+
+// Next waits for the next event and decodes it into v. It fails with
+// ErrClosed or ErrSlowConsumer when the subscription has ended.
+func (s *Subscription) Next(ctx context.Context, v interface{}) error {
+	select {
+	case raw, ok := <-s.events:
+		if !ok {
+			return s.err
+		}
+		return json.Unmarshal(raw, v)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Unsubscribe ends the subscription. Events already received can still be
+// read with Next.
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	_, err := s.ws.call(ctx, "unsubscribe", wsSubscribeParams{Subscription: s.ID}, nil)
+	s.ws.mu.Lock()
+	if ws := s.ws; ws.subs[s.ID] == s {
+		delete(ws.subs, s.ID)
+		s.err = ErrClosed
+		close(s.events)
+	}
+	s.ws.mu.Unlock()
+	return err
+}
+
+// call sends a request and waits for its reply. A subscribe call passes
+// sub, which the read loop registers under the returned id.
+func (ws *WSConn) call(ctx context.Context, method string, params interface{}, sub *Subscription) (json.RawMessage, error) {
+	ch := make(chan wsReply, 1)
+	ws.mu.Lock()
+	if ws.err != nil {
+		err := ws.err
+		ws.mu.Unlock()
+		return nil, err
+	}
+	ws.nextID++
+	id := ws.nextID
+	ws.pending[id] = &wsPending{method: method, ch: ch}
+	if sub != nil {
+		ws.subs[pendingKey(id)] = sub
+	}
+	ws.mu.Unlock()
+
+	ws.wmu.Lock()
+	err := ws.conn.WriteJSON(wsCall{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	ws.wmu.Unlock()
+	if err == nil {
+		select {
+		case r := <-ch:
+			return r.result, r.err
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	ws.mu.Lock()
+	delete(ws.pending, id)
+	delete(ws.subs, pendingKey(id))
+	ws.mu.Unlock()
+	return nil, err
+}
+
+// pendingKey holds a subscription in WSConn.subs until its id is known.
+func pendingKey(id uint64) string {
+	return "pending:" + strconv.FormatUint(id, 10)
+}
+
+func (ws *WSConn) readLoop() {
+	var err error
+	for {
+		var msg wsMessage
+		if err = ws.conn.ReadJSON(&msg); err != nil {
+			break
+		}
+		ws.mu.Lock()
+		if msg.ID != nil {
+			ws.reply(*msg.ID, &msg)
+		} else if msg.Method == "subscription" {
+			ws.deliver(msg.Params.Subscription, msg.Params.Result)
+		}
+		ws.mu.Unlock()
+	}
+
+	ws.mu.Lock()
+	ws.err = ErrClosed
+	if !errors.Is(err, net.ErrClosed) && !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		ws.err = fmt.Errorf("%w: %v", ErrClosed, err)
+	}
+	for id, p := range ws.pending {
+		p.ch <- wsReply{err: ws.err}
+		delete(ws.pending, id)
+	}
+	for id, s := range ws.subs {
+		s.err = ws.err
+		close(s.events)
+		delete(ws.subs, id)
+	}
+	ws.mu.Unlock()
+	close(ws.done)
+}
+
+// reply completes call id. Called with ws.mu held.
+func (ws *WSConn) reply(id uint64, msg *wsMessage) {
+	p, ok := ws.pending[id]
+	if !ok {
+		return
+	}
+	delete(ws.pending, id)
+	sub := ws.subs[pendingKey(id)]
+	delete(ws.subs, pendingKey(id))
+	if msg.Error != nil {
+		p.ch <- wsReply{err: &RPCError{Method: p.method, Message: msg.Error.Message}}
+		return
+	}
+	if sub != nil {
+		var subID string
+		if err := json.Unmarshal(msg.Result, &subID); err == nil {
+			ws.subs[subID] = sub
+		}
+	}
+	p.ch <- wsReply{result: msg.Result}
+}
+
+// deliver queues an event for its subscription. Called with ws.mu held.
+func (ws *WSConn) deliver(id string, result json.RawMessage) {
+	s, ok := ws.subs[id]
+	if !ok {
+		return
+	}
+	select {
+	case s.events <- result:
+	default:
+		delete(ws.subs, id)
+		s.err = ErrSlowConsumer
+		close(s.events)
+	}
+}
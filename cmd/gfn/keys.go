@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/keystore"
+)
+
+// keysDir is the keystore inside the home directory, one encrypted file
+// per account key.
+const keysDir = "keys"
+
+func keyStore(o *options) *keystore.Store {
+	return keystore.NewStore(filepath.Join(o.home, keysDir))
+}
+
+// passphraseFlag adds the flag naming a file to read a key's passphrase
+// from instead of prompting.
+func passphraseFlag(fs *flag.FlagSet) *string {
+	return fs.String("passphrase-file", "", "read the key passphrase from this file instead of prompting")
+}
+
+// unlockKey loads and decrypts the key called name.
+func unlockKey(o *options, name, passFile string) (*keystore.Key, error) {
+	ks := keyStore(o)
+	if _, err := ks.Info(name); err != nil {
+		return nil, err
+	}
+	pass, err := keystore.ReadPassphrase(passFile, fmt.Sprintf("Passphrase for %s: ", name), false)
+	if err != nil {
+		return nil, err
+	}
+	return ks.Load(name, pass)
+}
+
+func printKey(o *options, k *keystore.Info) error {
+	return o.print(k, func(w *tabwriter.Writer) {
+		row(w, "name:", k.Name)
+		row(w, "address:", k.Address)
+		row(w, "pub key:", k.PubKey)
+	})
+}
+
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("keys: missing subcommand (add, recover, list, show, export, import)")
+	}
+	switch sub, args := args[0], args[1:]; sub {
+	case "add", "import", "recover":
+		fs, o := newFlags("keys "+sub, "<name>")
+		passFile := passphraseFlag(fs)
+		var (
+			mnemonic     *bool
+			mnemonicFile *string
+			keyFile      *string
+			hdPath       *string
+			index        *uint
+		)
+		switch sub {
+		case "add":
+			mnemonic = fs.Bool("mnemonic", false, "derive the key from a new 24 word mnemonic and print the mnemonic")
+		case "recover":
+			mnemonicFile = fs.String("mnemonic-file", "", "read the mnemonic from this file instead of prompting")
+		case "import":
+			keyFile = fs.String("key-file", "", "read the hex private key from this file instead of prompting")
+		}
+		if sub != "import" {
+			hdPath = fs.String("hd-path", "", "BIP-44 derivation path (default "+keystore.HDPath(0)+" with the -index)")
+			index = fs.Uint("index", 0, "account index in the default derivation path")
+		}
+		pos, err := parse(fs, o, args, 1, 1)
+		if err != nil {
+			return err
+		}
+		if sub == "add" && !*mnemonic && (*hdPath != "" || *index != 0) {
+			return fmt.Errorf("-hd-path and -index need -mnemonic")
+		}
+		ks := keyStore(o)
+		if _, err := ks.Info(pos[0]); err == nil {
+			return fmt.Errorf("%w: %s", keystore.ErrExists, pos[0])
+		}
+		k := &keystore.Key{Name: pos[0]}
+		var phrase string
+		switch {
+		case sub == "import":
+			if k.PrivateKey, err = keystore.ReadPrivateKey(*keyFile); err != nil {
+				return err
+			}
+		case sub == "recover" || *mnemonic:
+			if sub == "recover" {
+				phrase, err = keystore.ReadMnemonic(*mnemonicFile)
+			} else {
+				phrase, err = keystore.NewMnemonic(24)
+			}
+			if err != nil {
+				return err
+			}
+			path := *hdPath
+			if path == "" {
+				path = keystore.HDPath(uint32(*index))
+			}
+			if k.PrivateKey, err = keystore.DeriveKey(phrase, "", path); err != nil {
+				return err
+			}
+		default:
+			if k.PrivateKey, err = crypto.GenerateKey(); err != nil {
+				return err
+			}
+		}
+		k.Address = core.PubKeyToAddress(&k.PrivateKey.PublicKey).Hex()
+		pass, err := keystore.ReadPassphrase(*passFile, "Passphrase to encrypt the key: ", true)
+		if err != nil {
+			return err
+		}
+		if err := ks.Save(k, pass); err != nil {
+			return err
+		}
+		if sub == "add" && *mnemonic {
+			fmt.Fprintln(os.Stderr, "Write down this mnemonic and keep it safe. It recovers the key with \"gfn keys recover\":")
+			fmt.Fprintf(os.Stderr, "\n%s\n\n", phrase)
+		}
+		return printKey(o, k.Info())
+
+	case "show":
+		fs, o := newFlags("keys show", "<name>")
+		pos, err := parse(fs, o, args, 1, 1)
+		if err != nil {
+			return err
+		}
+		info, err := keyStore(o).Info(pos[0])
+		if err != nil {
+			return err
+		}
+		return printKey(o, info)
+
+	case "export":
+		fs, o := newFlags("keys export", "<name>")
+		passFile := passphraseFlag(fs)
+		pos, err := parse(fs, o, args, 1, 1)
+		if err != nil {
+			return err
+		}
+		k, err := unlockKey(o, pos[0], *passFile)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "WARNING: anyone with this key controls the account.")
+		fmt.Println(hex.EncodeToString(crypto.FromECDSA(k.PrivateKey)))
+		return nil
+
+	case "list":
+		fs, o := newFlags("keys list", "")
+		if _, err := parse(fs, o, args, 0, 0); err != nil {
+			return err
+		}
+		keys, err := keyStore(o).List()
+		if err != nil {
+			return err
+		}
+		return o.print(keys, func(w *tabwriter.Writer) {
+			row(w, "NAME", "ADDRESS", "PUB KEY")
+			for _, k := range keys {
+				row(w, k.Name, k.Address, k.PubKey)
+			}
+		})
+
+	default:
+		return fmt.Errorf("keys: unknown subcommand %q", sub)
+	}
+}
@@ -1,37 +1,189 @@
+// Command gfn runs a Graphene node and talks to one over RPC: it manages
+// local account keys, sends transactions and queries the chain.
 package main
 
 import (
-    "fmt"
-    "os"
-    "os/signal"
-    "syscall"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
 
-    "gfn/node"
-    "gfn/store"
+	"github.com/rockandcode4/graphene-proto/client"
 )
 
+const usage = `usage: gfn <command> [flags] [args]
+
+Node:
+  init                                  write a default config to the home directory
+  start                                 run a node from the home directory
+
+Keys:
+  keys add <name>                       generate a key (-mnemonic to derive it from a new mnemonic)
+  keys recover <name>                   derive a key from a mnemonic
+  keys list                             list keys
+  keys show <name>                      show a key's address
+  keys export <name>                    print a key's private key
+  keys import <name>                    import a hex private key (prompted, or -key-file)
+
+Transactions (signed with a local key):
+  tx send <key> <to> <amount>
+  tx stake <key> <amount>
+  tx delegate <key> <validator> <amount>
+  tx undelegate <key> <validator> <amount>
+
+Multisig accounts (files are shared between owners for offline signing):
+  multisig new <threshold> <key|pub key>...   define an account, -out to save it
+  multisig build <multisig file> send|stake|delegate|undelegate [<to|validator>] <amount>
+  multisig sign <tx file> <key>             add a signature
+  multisig combine <tx file>...             merge signatures from several files
+  multisig broadcast <tx file>              send once there are enough signatures
+
+Queries:
+  query balance <address>
+  query block [height|hash]             the latest block by default
+  query tx <hash>
+  query validators
+
+Run "gfn <command> -h" for the flags of a command.
+`
+
 func main() {
-    fmt.Println("Starting GFN Blockchain...")
-
-    // Init node
-    if err := node.InitNode(); err != nil {
-        fmt.Println("Init error:", err)
-        return
-    }
-
-    // Handle shutdown signals (CTRL+C, kill, etc.)
-    quit := make(chan os.Signal, 1)
-    signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-
-    go func() {
-        <-quit
-        fmt.Println("\nShutting down node...")
-        store.CloseDB()
-        os.Exit(0)
-    }()
-
-    // Start node consensus
-    if err := node.StartNode(); err != nil {
-        fmt.Println("Node error:", err)
-    }
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "init":
+		err = runInit(args)
+	case "start":
+		err = runStart(args)
+	case "keys":
+		err = runKeys(args)
+	case "tx":
+		err = runTx(args)
+	case "multisig":
+		err = runMultisig(args)
+	case "query", "q":
+		err = runQuery(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// options are the flags shared by all commands.
+type options struct {
+	home    string
+	node    string
+	token   string
+	output  string
+	timeout time.Duration
+}
+
+func defaultHome() string {
+	if h := os.Getenv("GFN_HOME"); h != "" {
+		return h
+	}
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return ".gfn"
+	}
+	return filepath.Join(dir, ".gfn")
+}
+
+// newFlags returns a flag set for a subcommand with the shared flags.
+func newFlags(name, args string) (*flag.FlagSet, *options) {
+	o := &options{}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&o.home, "home", defaultHome(), "directory holding the config, data and keys (env GFN_HOME)")
+	fs.StringVar(&o.node, "node", "http://127.0.0.1:8545", "RPC address of the node")
+	fs.StringVar(&o.token, "token", os.Getenv("GFN_TOKEN"), "RPC API key or JWT (env GFN_TOKEN)")
+	fs.StringVar(&o.output, "output", "table", "output format: \"table\" or \"json\"")
+	fs.DurationVar(&o.timeout, "timeout", time.Minute, "how long to wait for the node")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gfn %s [flags] %s\n\nflags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs, o
+}
+
+// parse parses args, where flags may come before, between or after the
+// positional arguments, and checks that there are between min and max of
+// those. Everything after "--" is positional.
+func parse(fs *flag.FlagSet, o *options, args []string, min, max int) ([]string, error) {
+	var pos []string
+	for len(args) > 0 {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			pos = append(pos, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		pos = append(pos, rest[0])
+		args = rest[1:]
+	}
+	if o.output != "table" && o.output != "json" {
+		return nil, fmt.Errorf("unknown output format %q", o.output)
+	}
+	if len(pos) < min || len(pos) > max {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return pos, nil
+}
+
+func (o *options) client() (*client.Client, error) {
+	return client.New(client.Config{URL: o.node, Token: o.token})
+}
+
+func (o *options) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), o.timeout)
+}
+
+// print writes v as indented JSON, or as a table drawn by table.
+func (o *options) print(v interface{}, table func(w *tabwriter.Writer)) error {
+	if o.output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// row writes a tab separated table row.
+func row(w *tabwriter.Writer, cols ...interface{}) {
+	for i, c := range cols {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprint(w, c)
+	}
+	fmt.Fprintln(w)
+}
+
+func parseAmount(s string) (uint64, error) {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return n, nil
 }
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/keystore"
+	"github.com/rockandcode4/graphene-proto/rpc"
+)
+
+// captureStdout runs fn with os.Stdout redirected and returns what it
+// printed.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdout := os.Stdout
+	os.Stdout = f
+	err = fn()
+	os.Stdout = stdout
+	bz, rerr := os.ReadFile(f.Name())
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	return string(bz), err
+}
+
+func TestParse(t *testing.T) {
+	fs, o := newFlags("tx send", "<key> <to> <amount>")
+	tip := fs.Uint64("tip", 0, "")
+	pos, err := parse(fs, o, []string{"alice", "-tip", "3", "0xabc", "10", "-output", "json"}, 3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pos, []string{"alice", "0xabc", "10"}) || *tip != 3 || o.output != "json" {
+		t.Fatalf("flags between arguments: %q, tip %d, output %s", pos, *tip, o.output)
+	}
+
+	fs, o = newFlags("tx send", "<amount>")
+	fs.Uint64("tip", 0, "")
+	if pos, err = parse(fs, o, []string{"-tip", "1", "--", "-5"}, 1, 1); err != nil || !reflect.DeepEqual(pos, []string{"-5"}) {
+		t.Fatalf("after --: %q, %v", pos, err)
+	}
+
+	fs, o = newFlags("keys list", "")
+	if _, err := parse(fs, o, []string{"-output", "yaml"}, 0, 0); err == nil {
+		t.Fatal("unknown output format accepted")
+	}
+
+	for _, s := range []string{"0", "-1", "1.5", "", "ten"} {
+		if _, err := parseAmount(s); err == nil {
+			t.Errorf("amount %q accepted", s)
+		}
+	}
+	if n, err := parseAmount("10"); err != nil || n != 10 {
+		t.Errorf("amount 10: %d, %v", n, err)
+	}
+}
+
+func TestKeysImportJSON(t *testing.T) {
+	priv, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	keyFile, passFile := filepath.Join(dir, "key.hex"), filepath.Join(dir, "pw")
+	if err := os.WriteFile(keyFile, []byte("0x"+hex.EncodeToString(crypto.FromECDSA(priv))+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(passFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	home := filepath.Join(dir, "home")
+	want := core.PubKeyToAddress(&priv.PublicKey).Hex()
+
+	for _, args := range [][]string{
+		{"import", "bob", "-home", home, "-key-file", keyFile, "-passphrase-file", passFile, "-output", "json"},
+		{"show", "bob", "-home", home, "-output", "json"},
+	} {
+		out, err := captureStdout(t, func() error { return runKeys(args) })
+		if err != nil {
+			t.Fatalf("keys %s: %v", args[0], err)
+		}
+		var info keystore.Info
+		if err := json.Unmarshal([]byte(out), &info); err != nil {
+			t.Fatalf("keys %s printed %q: %v", args[0], out, err)
+		}
+		if info.Name != "bob" || info.Address != want {
+			t.Fatalf("keys %s: %+v, want address %s", args[0], info, want)
+		}
+	}
+
+	out, err := captureStdout(t, func() error { return runKeys([]string{"show", "bob", "-home", home}) })
+	if err != nil || !strings.Contains(out, "address:") || !strings.Contains(out, want) {
+		t.Fatalf("table output %q: %v", out, err)
+	}
+
+	err = runKeys([]string{"import", "bob", "-home", home, "-key-file", keyFile, "-passphrase-file", passFile})
+	if !errors.Is(err, keystore.ErrExists) {
+		t.Fatalf("second import: %v", err)
+	}
+}
+
+func TestTxUndelegate(t *testing.T) {
+	priv, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	keyFile, passFile := filepath.Join(dir, "key.hex"), filepath.Join(dir, "pw")
+	if err := os.WriteFile(keyFile, []byte(hex.EncodeToString(crypto.FromECDSA(priv))), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(passFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	home := filepath.Join(dir, "home")
+	if err := runKeys([]string{"import", "alice", "-home", home, "-key-file", keyFile, "-passphrase-file", passFile}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a node that knows the account at nonce 4 and accepts any transaction
+	var sent *core.Transaction
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string
+			Params []json.RawMessage
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Params) != 1 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		switch req.Method {
+		case "Graphene.GetAccount":
+			io.WriteString(w, `{"result":{"nonce":4},"error":null,"id":1}`)
+		case "Graphene.SendRawTx":
+			var args rpc.SendRawTxArgs
+			if err := json.Unmarshal(req.Params[0], &args); err != nil {
+				t.Error(err)
+			}
+			bz, err := hex.DecodeString(args.Tx)
+			if err != nil {
+				t.Error(err)
+			}
+			if sent, err = core.DecodeTx(bz); err != nil {
+				t.Error(err)
+			}
+			io.WriteString(w, `{"result":{"ok":true,"hash":"ab"},"error":null,"id":1}`)
+		default:
+			io.WriteString(w, `{"result":null,"error":"unexpected call","id":1}`)
+		}
+	}))
+	defer srv.Close()
+
+	validator := "0x6fac4d18c912343bf86fa7049364dd4e424ab9c0"
+	_, err = captureStdout(t, func() error {
+		return runTx([]string{"undelegate", "alice", validator, "10", "-max-fee", "5", "-home", home, "-passphrase-file", passFile, "-node", srv.URL})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent == nil || sent.Type != core.TxUndelegate || sent.Validator != "0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0" || sent.Amount != 10 || sent.Nonce != 4 || sent.MaxFee != 5 {
+		t.Fatalf("sent %+v", sent)
+	}
+	if err := sent.VerifySignature(); err != nil || sent.From != core.PubKeyToAddress(&priv.PublicKey).Hex() {
+		t.Fatalf("signature by %s: %v", sent.From, err)
+	}
+}
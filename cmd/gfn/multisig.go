@@ -0,0 +1,294 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/rockandcode4/graphene-proto/core"
+)
+
+// multisigFile is a multisig account as shared between its owners. The
+// address is only there for people reading the file; it is checked on
+// reading.
+type multisigFile struct {
+	Address string `json:"address"`
+	*core.Multisig
+}
+
+func runMultisig(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("multisig: missing subcommand (new, build, sign, combine, broadcast)")
+	}
+	switch sub, args := args[0], args[1:]; sub {
+	case "new":
+		fs, o := newFlags("multisig new", "<threshold> <key name or hex pub key>...")
+		out := fs.String("out", "", "also write the multisig to this file, to share with the other owners")
+		pos, err := parse(fs, o, args, 2, 1+core.MaxMultisigKeys)
+		if err != nil {
+			return err
+		}
+		threshold, err := strconv.ParseUint(pos[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid threshold %q", pos[0])
+		}
+		var pubs []*ecdsa.PublicKey
+		for _, arg := range pos[1:] {
+			pub, err := multisigKey(o, arg)
+			if err != nil {
+				return err
+			}
+			pubs = append(pubs, pub)
+		}
+		ms, err := core.NewMultisig(threshold, pubs)
+		if err != nil {
+			return err
+		}
+		f := &multisigFile{Address: ms.Address().Hex(), Multisig: ms}
+		if *out != "" {
+			if err := writeJSON(*out, f); err != nil {
+				return err
+			}
+		}
+		return o.print(f, func(w *tabwriter.Writer) {
+			row(w, "address:", f.Address)
+			row(w, "threshold:", fmt.Sprintf("%d of %d", ms.Threshold, len(ms.PubKeys)))
+			for _, pk := range ms.PubKeys {
+				row(w, "pub key:", hex.EncodeToString(pk))
+			}
+		})
+
+	case "build":
+		fs, o := newFlags("multisig build", "<multisig file> send <to> <amount> | stake <amount> | delegate <validator> <amount>")
+		nonce := fs.Uint64("nonce", 0, "nonce (default: the account's next nonce, from the node)")
+		tip := fs.Uint64("tip", 0, "tip per gas (default: suggested by the node)")
+		maxFee := fs.Uint64("max-fee", 0, "max fee per gas (default: twice the base fee plus the tip)")
+		out := fs.String("out", "", "write the unsigned transaction to this file instead of stdout")
+		pos, err := parse(fs, o, args, 3, 4)
+		if err != nil {
+			return err
+		}
+		ms, err := readMultisig(pos[0])
+		if err != nil {
+			return err
+		}
+		tx, err := multisigTx(pos[1], pos[2:])
+		if err != nil {
+			return err
+		}
+		tx.Nonce, tx.Tip, tx.MaxFee = *nonce, *tip, *maxFee
+		if isSet(fs, "nonce") && *maxFee != 0 {
+			// everything is given, so the node is not needed
+			tx.From, tx.Multisig = ms.Address().Hex(), ms
+			if err := tx.ValidateBasic(); err != nil {
+				return err
+			}
+		} else {
+			c, err := o.client()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := o.context()
+			defer cancel()
+			if err := c.BuildMultisig(ctx, ms, tx); err != nil {
+				return err
+			}
+		}
+		return writeTx(*out, tx)
+
+	case "sign":
+		fs, o := newFlags("multisig sign", "<tx file> <key>")
+		out := fs.String("out", "", "write the signed transaction to this file instead of stdout")
+		passFile := passphraseFlag(fs)
+		pos, err := parse(fs, o, args, 2, 2)
+		if err != nil {
+			return err
+		}
+		tx, err := readTx(pos[0])
+		if err != nil {
+			return err
+		}
+		key, err := unlockKey(o, pos[1], *passFile)
+		if err != nil {
+			return err
+		}
+		if err := tx.SignMultisig(key.PrivateKey); err != nil {
+			return err
+		}
+		return writeTx(*out, tx)
+
+	case "combine":
+		fs, o := newFlags("multisig combine", "<tx file>...")
+		out := fs.String("out", "", "write the combined transaction to this file instead of stdout")
+		pos, err := parse(fs, o, args, 1, core.MaxMultisigKeys)
+		if err != nil {
+			return err
+		}
+		var txs []*core.Transaction
+		for _, p := range pos {
+			tx, err := readTx(p)
+			if err != nil {
+				return err
+			}
+			txs = append(txs, tx)
+		}
+		tx, err := core.CombineSignatures(txs...)
+		if err != nil {
+			return err
+		}
+		return writeTx(*out, tx)
+
+	case "broadcast":
+		fs, o := newFlags("multisig broadcast", "<tx file>")
+		wait := fs.Bool("wait", false, "wait until the transaction is committed and print its receipt")
+		pos, err := parse(fs, o, args, 1, 1)
+		if err != nil {
+			return err
+		}
+		tx, err := readTx(pos[0])
+		if err != nil {
+			return err
+		}
+		if err := tx.VerifySignature(); err != nil {
+			return err
+		}
+		c, err := o.client()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := o.context()
+		defer cancel()
+		hash, err := c.SendSigned(ctx, tx)
+		if err != nil {
+			return err
+		}
+		return printSent(ctx, o, c, hash, *wait)
+
+	default:
+		return fmt.Errorf("multisig: unknown subcommand %q", sub)
+	}
+}
+
+// multisigKey returns the public key of a local key by name, or parses arg
+// as a hex public key of another owner.
+func multisigKey(o *options, arg string) (*ecdsa.PublicKey, error) {
+	if info, err := keyStore(o).Info(arg); err == nil {
+		arg = info.PubKey
+	}
+	bz, err := hex.DecodeString(strings.TrimPrefix(arg, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a local key nor a hex public key", arg)
+	}
+	if len(bz) == 33 {
+		return crypto.DecompressPubkey(bz)
+	}
+	return crypto.UnmarshalPubkey(bz)
+}
+
+// multisigTx returns the unsigned transaction described by kind and its
+// arguments, as for gfn tx.
+func multisigTx(kind string, args []string) (*core.Transaction, error) {
+	want := 2
+	if kind == "stake" {
+		want = 1
+	}
+	if len(args) != want {
+		return nil, fmt.Errorf("multisig build %s: wrong number of arguments", kind)
+	}
+	amount, err := parseAmount(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	var target string
+	if want == 2 {
+		if target, err = core.NormalizeAddress(args[0]); err != nil {
+			return nil, err
+		}
+	}
+	tx, err := newTx(kind, target, amount)
+	if err != nil {
+		return nil, fmt.Errorf("multisig build: %v", err)
+	}
+	return tx, nil
+}
+
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func readMultisig(path string) (*core.Multisig, error) {
+	var f multisigFile
+	if err := readJSON(path, &f); err != nil {
+		return nil, err
+	}
+	if f.Multisig == nil {
+		return nil, fmt.Errorf("%s: not a multisig file", path)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if addr := f.Multisig.Address().Hex(); f.Address != "" && f.Address != addr {
+		return nil, fmt.Errorf("%s: address %s does not match the keys (%s)", path, f.Address, addr)
+	}
+	return f.Multisig, nil
+}
+
+func readTx(path string) (*core.Transaction, error) {
+	var tx core.Transaction
+	if err := readJSON(path, &tx); err != nil {
+		return nil, err
+	}
+	if tx.Multisig == nil {
+		return nil, fmt.Errorf("%s: not a multisig transaction", path)
+	}
+	return &tx, nil
+}
+
+// writeTx writes tx to path, or to stdout if path is empty, and reports
+// how many signatures it has.
+func writeTx(path string, tx *core.Transaction) error {
+	if path == "" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(tx); err != nil {
+			return err
+		}
+	} else if err := writeJSON(path, tx); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d of %d required signatures\n", len(tx.Signatures), tx.Multisig.Threshold)
+	return nil
+}
+
+func readJSON(path string, v interface{}) error {
+	bz, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(bz, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func writeJSON(path string, v interface{}) error {
+	bz, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(bz, '\n'), 0o644)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/rockandcode4/graphene-proto/node"
+)
+
+// configFile is the node config inside the home directory.
+const configFile = "config.json"
+
+func runInit(args []string) error {
+	fs, o := newFlags("init", "")
+	chainID := fs.String("chain-id", "", "chain id (default from the node defaults)")
+	force := fs.Bool("force", false, "overwrite an existing config")
+	if _, err := parse(fs, o, args, 0, 0); err != nil {
+		return err
+	}
+	path := filepath.Join(o.home, configFile)
+	if _, err := os.Stat(path); err == nil && !*force {
+		return fmt.Errorf("%s already exists (use -force to overwrite)", path)
+	}
+	cfg := node.DefaultConfig()
+	cfg.DataDir = filepath.Join(o.home, "data")
+	if *chainID != "" {
+		cfg.ChainID = *chainID
+	}
+	for _, dir := range []string{cfg.DataDir, filepath.Join(o.home, keysDir)} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	bz, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(bz, '\n'), 0o600); err != nil {
+		return err
+	}
+	fmt.Println("Wrote", path)
+	return nil
+}
+
+func runStart(args []string) error {
+	fs, o := newFlags("start", "")
+	if _, err := parse(fs, o, args, 0, 0); err != nil {
+		return err
+	}
+	path := filepath.Join(o.home, configFile)
+	cfg := node.DefaultConfig()
+	if err := node.LoadConfigFromFile(path, cfg); err != nil {
+		return fmt.Errorf("load %s: %w (run gfn init first)", path, err)
+	}
+
+	n, err := node.NewNode(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("start node: %w", err)
+	}
+	log.Printf("Node started. RPC on %s:%d  PeerID=%s", cfg.RPCHost, cfg.RPCPort, n.HostID())
+	for _, a := range n.Addrs() {
+		log.Printf("  listening on %s", a)
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down node...")
+	n.Stop()
+	return nil
+}
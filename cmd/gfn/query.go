@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rockandcode4/graphene-proto/rpc"
+)
+
+type txQueryOutput struct {
+	Tx      *rpc.TxResult      `json:"tx"`
+	Receipt *rpc.ReceiptResult `json:"receipt,omitempty"`
+}
+
+func runQuery(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("query: missing subcommand (balance, block, tx, validators)")
+	}
+	sub, args := args[0], args[1:]
+	switch sub {
+	case "balance":
+		fs, o := newFlags("query balance", "<address>")
+		pos, err := parse(fs, o, args, 1, 1)
+		if err != nil {
+			return err
+		}
+		c, err := o.client()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := o.context()
+		defer cancel()
+		acct, err := c.GetAccount(ctx, pos[0])
+		if err != nil {
+			return err
+		}
+		return o.print(acct, func(w *tabwriter.Writer) {
+			row(w, "address:", acct.Address)
+			row(w, "balance:", acct.Balance)
+			row(w, "nonce:", acct.Nonce)
+			row(w, "staked:", acct.Staked)
+			for _, d := range acct.Delegations {
+				row(w, "delegated:", fmt.Sprintf("%d to %s", d.Amount, d.Validator))
+			}
+		})
+
+	case "block":
+		fs, o := newFlags("query block", "[height|hash]")
+		full := fs.Bool("full", false, "include full transactions")
+		pos, err := parse(fs, o, args, 0, 1)
+		if err != nil {
+			return err
+		}
+		c, err := o.client()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := o.context()
+		defer cancel()
+		var b *rpc.BlockResult
+		if len(pos) == 0 {
+			b, err = c.GetLatestBlock(ctx, *full)
+		} else if h, perr := strconv.ParseUint(pos[0], 10, 64); perr == nil {
+			b, err = c.GetBlockByHeight(ctx, h, *full)
+		} else {
+			b, err = c.GetBlockByHash(ctx, pos[0], *full)
+		}
+		if err != nil {
+			return err
+		}
+		return o.print(b, func(w *tabwriter.Writer) {
+			row(w, "height:", b.Height)
+			row(w, "hash:", b.Hash)
+			row(w, "prev hash:", b.PrevHash)
+			row(w, "time:", time.Unix(b.Time, 0).UTC().Format(time.RFC3339))
+			row(w, "proposer:", b.Proposer)
+			row(w, "state root:", b.StateRoot)
+			row(w, "receipts root:", b.ReceiptsRoot)
+			row(w, "gas used:", b.GasUsed)
+			row(w, "base fee:", b.BaseFee)
+			row(w, "txs:", len(b.TxHashes))
+			for _, h := range b.TxHashes {
+				row(w, "", h)
+			}
+		})
+
+	case "tx":
+		fs, o := newFlags("query tx", "<hash>")
+		pos, err := parse(fs, o, args, 1, 1)
+		if err != nil {
+			return err
+		}
+		c, err := o.client()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := o.context()
+		defer cancel()
+		out := &txQueryOutput{}
+		if out.Tx, err = c.GetTransaction(ctx, pos[0]); err != nil {
+			return err
+		}
+		if !out.Tx.Pending {
+			if out.Receipt, err = c.GetTransactionReceipt(ctx, pos[0]); err != nil {
+				return err
+			}
+		}
+		return o.print(out, func(w *tabwriter.Writer) {
+			tx := out.Tx
+			row(w, "hash:", tx.Hash)
+			row(w, "type:", tx.Type)
+			row(w, "from:", tx.From)
+			if tx.To != "" {
+				row(w, "to:", tx.To)
+			}
+			if tx.Validator != "" {
+				row(w, "validator:", tx.Validator)
+			}
+			row(w, "amount:", tx.Amount)
+			row(w, "nonce:", tx.Nonce)
+			row(w, "max fee:", tx.MaxFee)
+			row(w, "tip:", tx.Tip)
+			if out.Receipt == nil {
+				row(w, "status:", "pending")
+				return
+			}
+			printReceipt(w, out.Receipt)
+		})
+
+	case "validators":
+		fs, o := newFlags("query validators", "")
+		height := fs.Uint64("height", 0, "height to query (default: the latest block)")
+		status := fs.String("status", "", "only \"active\" or \"inactive\" validators")
+		limit := fs.Int("limit", 0, "at most this many validators (default 100)")
+		if _, err := parse(fs, o, args, 0, 0); err != nil {
+			return err
+		}
+		c, err := o.client()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := o.context()
+		defer cancel()
+		vals, err := c.GetValidators(ctx, &rpc.ValidatorsArgs{Height: *height, Status: *status, Limit: *limit})
+		if err != nil {
+			return err
+		}
+		return o.print(vals, func(w *tabwriter.Writer) {
+			row(w, "ADDRESS", "STATUS", "STAKE", "SELF STAKE", "DELEGATED")
+			for _, v := range vals.Validators {
+				row(w, v.Address, v.Status, v.Stake, v.SelfStake, v.Delegated)
+			}
+		})
+
+	default:
+		return fmt.Errorf("query: unknown subcommand %q", sub)
+	}
+}
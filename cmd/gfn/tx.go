@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/rockandcode4/graphene-proto/client"
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/rpc"
+)
+
+type txOutput struct {
+	Hash    string             `json:"hash,omitempty"`
+	Receipt *rpc.ReceiptResult `json:"receipt,omitempty"`
+}
+
+func runTx(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("tx: missing subcommand (send, stake, delegate, undelegate)")
+	}
+	sub, args := args[0], args[1:]
+	var usage string
+	var want int
+	switch sub {
+	case "send":
+		usage, want = "<key> <to> <amount>", 3
+	case "stake":
+		usage, want = "<key> <amount>", 2
+	case "delegate", "undelegate":
+		usage, want = "<key> <validator> <amount>", 3
+	default:
+		return fmt.Errorf("tx: unknown subcommand %q", sub)
+	}
+	fs, o := newFlags("tx "+sub, usage)
+	tip := fs.Uint64("tip", 0, "tip per gas (default: suggested by the node)")
+	maxFee := fs.Uint64("max-fee", 0, "max fee per gas (default: twice the base fee plus the tip)")
+	wait := fs.Bool("wait", false, "wait until the transaction is committed and print its receipt")
+	passFile := passphraseFlag(fs)
+	pos, err := parse(fs, o, args, want, want)
+	if err != nil {
+		return err
+	}
+	amount, err := parseAmount(pos[len(pos)-1])
+	if err != nil {
+		return err
+	}
+	var target string
+	if want == 3 {
+		if target, err = core.NormalizeAddress(pos[1]); err != nil {
+			return err
+		}
+	}
+	tx, err := newTx(sub, target, amount)
+	if err != nil {
+		return err
+	}
+	tx.Tip, tx.MaxFee = *tip, *maxFee
+	key, err := unlockKey(o, pos[0], *passFile)
+	if err != nil {
+		return err
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := o.context()
+	defer cancel()
+
+	hash, err := c.Account(key.PrivateKey).Send(ctx, tx)
+	if err != nil {
+		return err
+	}
+	return printSent(ctx, o, c, hash, *wait)
+}
+
+// newTx returns the unsigned transaction of the given kind, as named on
+// the command line. target is the recipient of send and the validator of
+// delegate and undelegate.
+func newTx(kind, target string, amount uint64) (*core.Transaction, error) {
+	tx := &core.Transaction{Amount: amount}
+	switch kind {
+	case "send":
+		tx.Type, tx.To = core.TxTransfer, target
+	case "stake":
+		tx.Type = core.TxStake
+	case "delegate":
+		tx.Type, tx.Validator = core.TxDelegate, target
+	case "undelegate":
+		tx.Type, tx.Validator = core.TxUndelegate, target
+	default:
+		return nil, fmt.Errorf("unknown transaction %q (send, stake, delegate, undelegate)", kind)
+	}
+	return tx, nil
+}
+
+// printSent prints the hash of a sent transaction and, with wait, its
+// receipt once it is committed.
+func printSent(ctx context.Context, o *options, c *client.Client, hash string, wait bool) error {
+	out := &txOutput{Hash: hash}
+	if wait {
+		var err error
+		if out.Receipt, err = c.WaitForTx(ctx, hash); err != nil {
+			return err
+		}
+	}
+	return o.print(out, func(w *tabwriter.Writer) {
+		row(w, "hash:", out.Hash)
+		if r := out.Receipt; r != nil {
+			printReceipt(w, r)
+		}
+	})
+}
+
+func printReceipt(w *tabwriter.Writer, r *rpc.ReceiptResult) {
+	status := "success"
+	if !r.Success {
+		status = "failed: " + r.Error
+	}
+	row(w, "status:", status)
+	row(w, "block:", fmt.Sprintf("%d (%s)", r.BlockHeight, r.BlockHash))
+	row(w, "gas used:", r.GasUsed)
+	row(w, "gas price:", r.GasPrice)
+	row(w, "fee:", r.Fee)
+	for _, l := range r.Logs {
+		row(w, "log:", fmt.Sprintf("%s %v amount=%d", l.Event, l.Topics, l.Amount))
+	}
+}
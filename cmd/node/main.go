@@ -1,45 +1,60 @@
 package main
 
 import (
-    "context"
-    "flag"
-    "fmt"
-    "log"
-    "os"
-    "time"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
 
-    "github.com/rockandcode4/graphene-proto/node"
+	"github.com/rockandcode4/graphene-proto/node"
 )
 
 func main() {
-    cfgFile := flag.String("config", "", "node config json")
-    datadir := flag.String("datadir", "./data", "data directory")
-    bind := flag.String("bind", "/ip4/127.0.0.1/tcp/0", "libp2p bind multiaddr")
-    port := flag.Int("rpc", 8545, "rpc port")
-    flag.Parse()
+	cfgFile := flag.String("config", "", "node config json")
+	datadir := flag.String("datadir", "./data", "data directory")
+	bind := flag.String("bind", "/ip4/127.0.0.1/tcp/0", "libp2p bind multiaddr")
+	port := flag.Int("rpc", 8545, "rpc port")
+	rpcHost := flag.String("rpc-host", "127.0.0.1", "interface the rpc server listens on (0.0.0.0 for all)")
+	fastSync := flag.Bool("fastsync", false, "restore state from a peer snapshot before syncing blocks")
+	mdns := flag.Bool("mdns", false, "discover peers on the local network via mDNS")
+	useDHT := flag.Bool("dht", false, "discover peers through the Kademlia DHT")
+	relayService := flag.Bool("relay-service", false, "act as a circuit relay for peers behind NAT")
+	privateMode := flag.Bool("private-mode", false, "validator behind sentries: only connect to persistent peers, no discovery")
+	flag.Parse()
 
-    cfg := node.DefaultConfig()
-    cfg.DataDir = *datadir
-    cfg.BindAddr = *bind
-    cfg.RPCPort = *port
-    if *cfgFile != "" {
-        if err := node.LoadConfigFromFile(*cfgFile, cfg); err != nil {
-            log.Println("warning: failed to load config:", err)
-        }
-    }
+	cfg := node.DefaultConfig()
+	cfg.DataDir = *datadir
+	cfg.BindAddr = *bind
+	cfg.RPCPort = *port
+	cfg.RPCHost = *rpcHost
+	cfg.FastSync = *fastSync
+	cfg.MDNS = *mdns
+	cfg.DHT = *useDHT
+	cfg.RelayService = *relayService
+	cfg.PrivateMode = *privateMode
+	if *cfgFile != "" {
+		if err := node.LoadConfigFromFile(*cfgFile, cfg); err != nil {
+			log.Println("warning: failed to load config:", err)
+		}
+	}
 
-    ctx := context.Background()
-    n, err := node.NewNode(ctx, cfg)
-    if err != nil {
-        fmt.Println("failed to start node:", err)
-        os.Exit(1)
-    }
-    defer n.Stop()
+	ctx := context.Background()
+	n, err := node.NewNode(ctx, cfg)
+	if err != nil {
+		fmt.Println("failed to start node:", err)
+		os.Exit(1)
+	}
+	defer n.Stop()
 
-    log.Printf("Node started. RPC on :%d  PeerID=%s", cfg.RPCPort, n.HostID())
+	log.Printf("Node started. RPC on %s:%d  PeerID=%s", cfg.RPCHost, cfg.RPCPort, n.HostID())
+	for _, a := range n.Addrs() {
+		log.Printf("  listening on %s", a)
+	}
 
-    // simple run loop
-    for {
-        time.Sleep(10 * time.Second)
-    }
+	// simple run loop
+	for {
+		time.Sleep(10 * time.Second)
+	}
 }
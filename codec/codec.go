@@ -0,0 +1,182 @@
+// Package codec implements the compact, deterministic binary encoding used
+// for wire messages: unsigned integers are uvarints, signed integers are
+// zig-zag varints and byte strings are length-prefixed.
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var ErrTruncated = errors.New("codec: truncated input")
+
+// errNonMinimal rejects padded varints so every value has exactly one
+// encoding and hashes of encoded data are stable.
+var errNonMinimal = errors.New("codec: non-minimal varint")
+
+type Writer struct {
+	buf []byte
+}
+
+func (w *Writer) Uint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *Writer) Int(v int64) {
+	w.buf = binary.AppendVarint(w.buf, v)
+}
+
+func (w *Writer) Bool(v bool) {
+	if v {
+		w.buf = append(w.buf, 1)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *Writer) Bytes(bz []byte) {
+	w.Uint(uint64(len(bz)))
+	w.buf = append(w.buf, bz...)
+}
+
+func (w *Writer) String(s string) {
+	w.Uint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// BytesList writes a count followed by each element.
+func (w *Writer) BytesList(list [][]byte) {
+	w.Uint(uint64(len(list)))
+	for _, bz := range list {
+		w.Bytes(bz)
+	}
+}
+
+// Out returns the encoded bytes.
+func (w *Writer) Out() []byte {
+	return w.buf
+}
+
+// Reader decodes values written by Writer. The first error is sticky: later
+// reads return zero values and Err reports it.
+type Reader struct {
+	buf []byte
+	err error
+}
+
+func NewReader(bz []byte) *Reader {
+	return &Reader{buf: bz}
+}
+
+func (r *Reader) Uint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = ErrTruncated
+		return 0
+	}
+	if n > 1 && r.buf[n-1] == 0 {
+		r.err = errNonMinimal
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *Reader) Int() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.err = ErrTruncated
+		return 0
+	}
+	if n > 1 && r.buf[n-1] == 0 {
+		r.err = errNonMinimal
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *Reader) Bool() bool {
+	if r.err != nil {
+		return false
+	}
+	if len(r.buf) == 0 {
+		r.err = ErrTruncated
+		return false
+	}
+	v := r.buf[0]
+	r.buf = r.buf[1:]
+	if v > 1 {
+		r.err = fmt.Errorf("codec: invalid bool %d", v)
+	}
+	return v == 1
+}
+
+// Bytes returns a copy of the next byte string. Empty strings decode as nil.
+func (r *Reader) Bytes() []byte {
+	n := r.Uint()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.buf)) {
+		r.err = ErrTruncated
+		return nil
+	}
+	if n == 0 {
+		return nil
+	}
+	out := append([]byte(nil), r.buf[:n]...)
+	r.buf = r.buf[n:]
+	return out
+}
+
+func (r *Reader) String() string {
+	return string(r.Bytes())
+}
+
+// BytesList reads a list written by Writer.BytesList.
+func (r *Reader) BytesList() [][]byte {
+	n := r.Uint()
+	if r.err != nil {
+		return nil
+	}
+	// every element takes at least one byte, which bounds the allocation
+	if n > uint64(len(r.buf)) {
+		r.err = ErrTruncated
+		return nil
+	}
+	out := make([][]byte, 0, n)
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		out = append(out, r.Bytes())
+	}
+	return out
+}
+
+// Len returns the number of bytes left to read.
+func (r *Reader) Len() int {
+	return len(r.buf)
+}
+
+// Err returns the first decoding error.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Done returns the first decoding error, or an error if input is left over.
+// Rejecting trailing bytes keeps the encoding canonical.
+func (r *Reader) Done() error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.buf) != 0 {
+		return fmt.Errorf("codec: %d trailing bytes", len(r.buf))
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package consensus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+// Chain data lives in the state's LevelDB next to, but outside of, the
+// state key space, and is written in the same batch as the state of each
+// block, so the two cannot disagree after a crash.
+const (
+	blockPrefix   = "blk:"
+	receiptPrefix = "rcp:"
+	undoPrefix    = "und:"
+)
+
+var (
+	// headKey holds the number of the last committed block.
+	headKey = []byte("chain:head")
+	// baseKey holds the number of the first block of the chain, if it is
+	// not genesis: the snapshot block after a fast sync.
+	baseKey = []byte("chain:base")
+)
+
+func chainKey(prefix string, n uint64) []byte {
+	return []byte(fmt.Sprintf("%s%016x", prefix, n))
+}
+
+func encodeNumber(n uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, n)
+}
+
+func decodeNumber(bz []byte) (uint64, error) {
+	if len(bz) != 8 {
+		return 0, fmt.Errorf("invalid block number %x", bz)
+	}
+	return binary.BigEndian.Uint64(bz), nil
+}
+
+// blockEntries returns the chain entries that record b, with its receipts
+// and undo entries, as the new head. The undo entries of the block that
+// falls out of StateHistory are deleted.
+func blockEntries(b *Block, receipts []*core.Receipt, undo []state.Entry) ([]state.Entry, error) {
+	rbz, err := json.Marshal(receipts)
+	if err != nil {
+		return nil, err
+	}
+	ubz, err := json.Marshal(undo)
+	if err != nil {
+		return nil, err
+	}
+	entries := []state.Entry{
+		{Key: chainKey(blockPrefix, b.Number), Value: EncodeBlock(b)},
+		{Key: chainKey(receiptPrefix, b.Number), Value: rbz},
+		{Key: chainKey(undoPrefix, b.Number), Value: ubz},
+		{Key: headKey, Value: encodeNumber(b.Number)},
+	}
+	if b.Number >= StateHistory {
+		entries = append(entries, state.Entry{Key: chainKey(undoPrefix, b.Number-StateHistory)})
+	}
+	return entries, nil
+}
+
+// resetEntries returns the entries that replace the stored chain with one
+// starting at b.
+func (c *Consensus) resetEntries(b *Block) ([]state.Entry, error) {
+	var entries []state.Entry
+	for _, prefix := range []string{blockPrefix, receiptPrefix, undoPrefix} {
+		err := c.state.ForEach(prefix, func(key, _ []byte) error {
+			entries = append(entries, state.Entry{Key: append([]byte(nil), key...)})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(entries,
+		state.Entry{Key: chainKey(blockPrefix, b.Number), Value: EncodeBlock(b)},
+		state.Entry{Key: headKey, Value: encodeNumber(b.Number)},
+		state.Entry{Key: baseKey, Value: encodeNumber(b.Number)},
+	), nil
+}
+
+// loadChain reads the stored chain, its receipts and the undo entries of
+// its last StateHistory blocks. A database without a chain keeps genesis.
+// The head must lead to the stored state.
+func (c *Consensus) loadChain() error {
+	hbz, err := c.state.Get(headKey)
+	if err != nil || hbz == nil {
+		return err
+	}
+	head, err := decodeNumber(hbz)
+	if err != nil {
+		return err
+	}
+	var base uint64
+	if bbz, err := c.state.Get(baseKey); err != nil {
+		return err
+	} else if bbz != nil {
+		if base, err = decodeNumber(bbz); err != nil {
+			return err
+		}
+	}
+	chain := make([]*Block, 0, head-base+1)
+	if base == 0 {
+		chain = append(chain, c.chain[0])
+		base = 1
+	}
+	for n := base; n <= head; n++ {
+		b, err := c.loadBlock(n)
+		if err != nil {
+			return err
+		}
+		if len(chain) > 0 && !bytes.Equal(b.Prev, chain[len(chain)-1].Hash) {
+			return fmt.Errorf("stored block %d does not extend block %d", n, n-1)
+		}
+		chain = append(chain, b)
+	}
+	last := chain[len(chain)-1]
+	root, err := c.state.Root()
+	if err != nil {
+		return err
+	}
+	if len(last.StateRoot) > 0 && !bytes.Equal(root, last.StateRoot) {
+		return fmt.Errorf("stored head %d has state root %x, the state is at %x", last.Number, last.StateRoot, root)
+	}
+
+	c.chain = chain
+	for _, b := range chain {
+		c.indexTxs(b)
+		bz, err := c.state.Get(chainKey(receiptPrefix, b.Number))
+		if err != nil {
+			return err
+		}
+		if bz == nil {
+			continue
+		}
+		var receipts []*core.Receipt
+		if err := json.Unmarshal(bz, &receipts); err != nil {
+			return fmt.Errorf("receipts of block %d: %v", b.Number, err)
+		}
+		c.receipts[b.Number] = receipts
+	}
+	return c.state.ForEach(undoPrefix, func(key, value []byte) error {
+		var n uint64
+		if _, err := fmt.Sscanf(string(key[len(undoPrefix):]), "%x", &n); err != nil {
+			return fmt.Errorf("invalid undo key %q", key)
+		}
+		var undo []state.Entry
+		if err := json.Unmarshal(value, &undo); err != nil {
+			return fmt.Errorf("undo entries of block %d: %v", n, err)
+		}
+		c.changes[n] = undo
+		return nil
+	})
+}
+
+func (c *Consensus) loadBlock(n uint64) (*Block, error) {
+	bz, err := c.state.Get(chainKey(blockPrefix, n))
+	if err != nil {
+		return nil, err
+	}
+	if bz == nil {
+		return nil, fmt.Errorf("stored block %d is missing", n)
+	}
+	b, err := DecodeBlock(bz)
+	if err != nil {
+		return nil, fmt.Errorf("stored block %d: %v", n, err)
+	}
+	if b.Number != n || !bytes.Equal(b.ComputeHash(), b.Hash) {
+		return nil, fmt.Errorf("stored block %d is corrupt", n)
+	}
+	return b, nil
+}
@@ -0,0 +1,43 @@
+package consensus
+
+import (
+	"github.com/rockandcode4/graphene-proto/codec"
+)
+
+// EncodeBlock returns the binary encoding of a full block.
+func EncodeBlock(b *Block) []byte {
+	var w codec.Writer
+	w.Uint(b.Number)
+	w.Bytes(b.Prev)
+	w.Int(b.Time)
+	w.BytesList(b.Txns)
+	w.String(b.Proposer)
+	w.Bytes(b.StateRoot)
+	w.Bytes(b.ReceiptsRoot)
+	w.Uint(b.GasUsed)
+	w.Uint(b.BaseFee)
+	w.Bytes(b.Hash)
+	w.Bytes(b.Signature)
+	return w.Out()
+}
+
+func DecodeBlock(bz []byte) (*Block, error) {
+	r := codec.NewReader(bz)
+	b := &Block{
+		Number:       r.Uint(),
+		Prev:         r.Bytes(),
+		Time:         r.Int(),
+		Txns:         r.BytesList(),
+		Proposer:     r.String(),
+		StateRoot:    r.Bytes(),
+		ReceiptsRoot: r.Bytes(),
+		GasUsed:      r.Uint(),
+		BaseFee:      r.Uint(),
+		Hash:         r.Bytes(),
+		Signature:    r.Bytes(),
+	}
+	if err := r.Done(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
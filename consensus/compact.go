@@ -0,0 +1,224 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"time"
+
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/rockandcode4/graphene-proto/codec"
+	"github.com/rockandcode4/graphene-proto/mempool"
+)
+
+const (
+	// shortIDLen is the length of the transaction ids in compact blocks.
+	shortIDLen = 6
+	// maxBlockTxBytes bounds the transactions a proposer puts in a block.
+	maxBlockTxBytes = 1 << 20
+	// maxTxFetchPeers is how many peers are asked for missing transactions
+	// before falling back to a full block sync.
+	maxTxFetchPeers = 3
+	txFetchTimeout  = 10 * time.Second
+)
+
+// CompactBlock announces a block by its header and short ids of its
+// transactions. Receivers rebuild the block from their mempool and fetch
+// only the transactions they have not seen.
+type CompactBlock struct {
+	Header   *Header
+	ShortIDs [][]byte
+}
+
+// NewCompactBlock builds the announcement for b.
+func NewCompactBlock(b *Block) *CompactBlock {
+	cb := &CompactBlock{Header: b.Header(), ShortIDs: make([][]byte, len(b.Txns))}
+	for i, tx := range b.Txns {
+		cb.ShortIDs[i] = ShortTxID(b.Hash, mempool.Key(tx))
+	}
+	return cb
+}
+
+// ShortTxID is the id of a transaction in a compact block. It is keyed by
+// the block hash so collisions cannot be precomputed.
+func ShortTxID(blockHash, txHash []byte) []byte {
+	w := sha256.New()
+	w.Write(blockHash)
+	w.Write(txHash)
+	return w.Sum(nil)[:shortIDLen]
+}
+
+func EncodeCompactBlock(cb *CompactBlock) []byte {
+	var w codec.Writer
+	h := cb.Header
+	w.Uint(h.Number)
+	w.Bytes(h.Prev)
+	w.Int(h.Time)
+	w.Bytes(h.TxRoot)
+	w.String(h.Proposer)
+	w.Bytes(h.StateRoot)
+	w.Bytes(h.ReceiptsRoot)
+	w.Uint(h.GasUsed)
+	w.Uint(h.BaseFee)
+	w.Bytes(h.Hash)
+	w.Bytes(h.Signature)
+	w.Bytes(bytes.Join(cb.ShortIDs, nil))
+	return w.Out()
+}
+
+func DecodeCompactBlock(bz []byte) (*CompactBlock, error) {
+	r := codec.NewReader(bz)
+	h := &Header{
+		Number:       r.Uint(),
+		Prev:         r.Bytes(),
+		Time:         r.Int(),
+		TxRoot:       r.Bytes(),
+		Proposer:     r.String(),
+		StateRoot:    r.Bytes(),
+		ReceiptsRoot: r.Bytes(),
+		GasUsed:      r.Uint(),
+		BaseFee:      r.Uint(),
+		Hash:         r.Bytes(),
+		Signature:    r.Bytes(),
+	}
+	ids := r.Bytes()
+	if err := r.Done(); err != nil {
+		return nil, err
+	}
+	if len(ids)%shortIDLen != 0 {
+		return nil, fmt.Errorf("short ids of %d bytes", len(ids))
+	}
+	cb := &CompactBlock{Header: h, ShortIDs: make([][]byte, 0, len(ids)/shortIDLen)}
+	for i := 0; i < len(ids); i += shortIDLen {
+		cb.ShortIDs = append(cb.ShortIDs, ids[i:i+shortIDLen])
+	}
+	return cb, nil
+}
+
+// ValidateBasic checks the header of an announced block.
+func (cb *CompactBlock) ValidateBasic() error {
+	h := cb.Header
+	if h.Number == 0 {
+		return fmt.Errorf("block number 0 is genesis")
+	}
+	if h.Proposer == "" {
+		return fmt.Errorf("block %d has no proposer", h.Number)
+	}
+	if !bytes.Equal(h.ComputeHash(), h.Hash) {
+		return fmt.Errorf("block %d has invalid hash", h.Number)
+	}
+	if time.Unix(h.Time, 0).After(time.Now().Add(maxClockDrift)) {
+		return fmt.Errorf("block %d is from the future", h.Number)
+	}
+	return nil
+}
+
+// reconstruct rebuilds the full block from the mempool, fetching missing
+// transactions from the peer that relayed the block and then from others.
+func (c *Consensus) reconstruct(ctx context.Context, cb *CompactBlock, from peerstore.ID) (*Block, error) {
+	h := cb.Header
+	txs := make([][]byte, len(cb.ShortIDs))
+	missing := c.fillFromMempool(h.Hash, cb.ShortIDs, txs)
+
+	b := &Block{Number: h.Number, Prev: h.Prev, Time: h.Time, Txns: txs, Proposer: h.Proposer, StateRoot: h.StateRoot, ReceiptsRoot: h.ReceiptsRoot, GasUsed: h.GasUsed, BaseFee: h.BaseFee, Hash: h.Hash, Signature: h.Signature}
+	if len(missing) == 0 && bytes.Equal(TxRoot(txs), h.TxRoot) {
+		return b, b.ValidateBasic()
+	}
+	if len(missing) == 0 {
+		// a mempool transaction collided with a short id; fetch everything
+		missing = make([]uint64, len(txs))
+		for i := range missing {
+			missing[i] = uint64(i)
+		}
+	}
+
+	for _, pid := range c.txFetchPeers(from) {
+		fctx, cancel := context.WithTimeout(ctx, txFetchTimeout)
+		ids := make([][]byte, len(missing))
+		for i, idx := range missing {
+			ids[i] = cb.ShortIDs[idx]
+		}
+		got, err := c.p2p.FetchBlockTxs(fctx, pid, h.Hash, missing, ids)
+		cancel()
+		if err != nil {
+			log.Printf("fetch txs of block %d from %s: %v", h.Number, pid, err)
+			continue
+		}
+		for i, idx := range missing {
+			txs[idx] = got[i]
+		}
+		if bytes.Equal(TxRoot(txs), h.TxRoot) {
+			return b, b.ValidateBasic()
+		}
+		log.Printf("peer %s sent wrong txs for block %d", pid, h.Number)
+	}
+	return nil, fmt.Errorf("block %d: %d transactions unavailable", h.Number, len(missing))
+}
+
+// fillFromMempool places pooled transactions matching ids into txs and
+// returns the indexes still missing. Ids shared by several pooled
+// transactions count as missing.
+func (c *Consensus) fillFromMempool(blockHash []byte, ids [][]byte, txs [][]byte) []uint64 {
+	byID := make(map[string][]byte)
+	if c.pool != nil {
+		c.pool.ForEach(func(hash, tx []byte) {
+			id := string(ShortTxID(blockHash, hash))
+			if _, dup := byID[id]; dup {
+				byID[id] = nil
+			} else {
+				byID[id] = tx
+			}
+		})
+	}
+	var missing []uint64
+	for i, id := range ids {
+		if tx := byID[string(id)]; tx != nil {
+			txs[i] = tx
+		} else {
+			missing = append(missing, uint64(i))
+		}
+	}
+	return missing
+}
+
+// txFetchPeers lists the peer that relayed a block followed by other
+// connected peers.
+func (c *Consensus) txFetchPeers(from peerstore.ID) []peerstore.ID {
+	out := []peerstore.ID{from}
+	for _, pid := range c.p2p.Peers() {
+		if len(out) >= maxTxFetchPeers {
+			break
+		}
+		if pid != from {
+			out = append(out, pid)
+		}
+	}
+	return out
+}
+
+// BlockTxs implements p2p.BlockTxsProvider. Blocks that have not been
+// imported yet, typically because we are reconstructing them ourselves, are
+// answered from the mempool by short id.
+func (c *Consensus) BlockTxs(hash []byte, indexes []uint64, ids [][]byte) ([][]byte, error) {
+	c.mu.Lock()
+	b := c.blockByHash(hash)
+	c.mu.Unlock()
+	if b == nil {
+		out := make([][]byte, len(ids))
+		if missing := c.fillFromMempool(hash, ids, out); len(missing) > 0 {
+			return nil, fmt.Errorf("%d of %d txs unknown", len(missing), len(ids))
+		}
+		return out, nil
+	}
+	out := make([][]byte, len(indexes))
+	for i, idx := range indexes {
+		if idx >= uint64(len(b.Txns)) {
+			return nil, fmt.Errorf("block %d has no tx %d", b.Number, idx)
+		}
+		out[i] = b.Txns[idx]
+	}
+	return out, nil
+}
@@ -1,44 +1,109 @@
 package consensus
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"fmt"
 	"log"
 	"sync"
 	"time"
 
-	"github.com/yourorg/graphene-proto/p2p"
-	"github.com/yourorg/graphene-proto/state"
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/mempool"
+	"github.com/rockandcode4/graphene-proto/p2p"
+	"github.com/rockandcode4/graphene-proto/state"
 )
 
+// EpochLength is the number of blocks per epoch.
+const EpochLength = 100
+
 type Block struct {
-	Number   uint64
-	Prev     []byte
-	Time     int64
-	Txns     [][]byte
-	Proposer string
-	Hash     []byte
+	Number    uint64
+	Prev      []byte
+	Time      int64
+	Txns      [][]byte
+	Proposer  string
+	StateRoot []byte
+	// ReceiptsRoot commits to the receipts of Txns, in order.
+	ReceiptsRoot []byte
+	GasUsed      uint64
+	BaseFee      uint64
+	Hash         []byte
+	// Signature is the proposer's signature over Hash.
+	Signature []byte
 }
 
 type Consensus struct {
-	state *state.StateDB
-	p2p   *p2p.P2P
+	state  *state.StateDB
+	pool   *mempool.Mempool
+	p2p    *p2p.P2P
+	params Params
 
 	mu      sync.Mutex
 	running bool
 
-	// in-memory chain
-	chain []*Block
+	// the chain, loaded from the database on startup and written to it
+	// with the state of each block; chain[0] is genesis, or the snapshot
+	// block after a fast sync
+	chain       []*Block
+	genesisHash []byte
+	txIndex     map[string]txLocation
+	receipts    map[uint64][]*core.Receipt // by block number
+	// changes holds the undo entries of each of the last StateHistory
+	// blocks, by block number
+	changes map[uint64][]state.Entry
 
+	// validators is the active validator set of the state at the head
 	validators []string
+	// validator is the one this node proposes for and key its signing key;
+	// without a key the node only proposes while there are no validators
+	validator string
+	key       *ecdsa.PrivateKey
+
+	// syncing pauses block production while the syncer catches up
+	syncing  bool
+	onBehind func()
+
+	onBlock    []func(*Block)
+	onReceipts []func(*Block, []*core.Receipt)
+	onFinalize []func(*Block)
 }
 
-func NewConsensus(st *state.StateDB, p *p2p.P2P) *Consensus {
-	genesis := &Block{Number: 0, Prev: nil, Time: time.Now().Unix(), Proposer: "genesis"}
-	return &Consensus{
-		state:      st,
-		p2p:        p,
-		chain:      []*Block{genesis},
-		validators: []string{},
+// NewConsensus creates the consensus engine on the chain stored with st, or
+// at genesis if there is none. Zero fields of params take their defaults.
+func NewConsensus(st *state.StateDB, pool *mempool.Mempool, p *p2p.P2P, params Params) (*Consensus, error) {
+	// genesis must be identical on every node, so it carries no wall-clock time
+	genesis := &Block{Number: 0, Prev: nil, Time: 0, Proposer: "genesis"}
+	genesis.Hash = genesis.ComputeHash()
+	c := &Consensus{
+		state:       st,
+		pool:        pool,
+		p2p:         p,
+		params:      params.withDefaults(),
+		chain:       []*Block{genesis},
+		genesisHash: genesis.Hash,
+		txIndex:     make(map[string]txLocation),
+		receipts:    make(map[uint64][]*core.Receipt),
+		changes:     make(map[uint64][]state.Entry),
+		validators:  []string{},
 	}
+	if err := c.loadChain(); err != nil {
+		return nil, fmt.Errorf("failed to load the chain: %v", err)
+	}
+	if err := c.loadValidators(); err != nil {
+		return nil, err
+	}
+	pool.SetAccounts(st)
+	if p != nil {
+		p.SetBlockValidator(c.validateGossipBlock)
+		p.SubscribeBlocks(c.handleGossipBlock)
+		p.ServeBlockTxs(c)
+		p.SubscribeTxs(func(bz []byte) { _ = pool.Add(bz) })
+	}
+	return c, nil
 }
 
 func (c *Consensus) Start() {
@@ -67,31 +132,285 @@ func (c *Consensus) loop() {
 			c.mu.Unlock()
 			break
 		}
+		if c.syncing {
+			c.mu.Unlock()
+			continue
+		}
+		head := c.chain[len(c.chain)-1]
 		proposer := "local-proposer"
+		if c.validator != "" {
+			proposer = c.validator
+		}
 		if len(c.validators) > 0 {
-			proposer = c.validators[len(c.chain)%uint64(len(c.validators))]
+			proposer = c.proposerAt(head.Number + 1)
+			if proposer != c.validator {
+				c.mu.Unlock()
+				continue
+			}
 		}
-		b := &Block{
-			Number:   uint64(len(c.chain)),
-			Prev:     []byte("prevhash"),
-			Time:     time.Now().Unix(),
-			Txns:     [][]byte{},
-			Proposer: proposer,
+		b, receipts, err := c.buildBlock(head, proposer)
+		if err != nil {
+			log.Printf("build block: %v", err)
+			c.mu.Unlock()
+			continue
 		}
-		c.chain = append(c.chain, b)
+		c.appendBlock(b, receipts)
 		log.Printf("Proposed block %d by %s", b.Number, proposer)
 		_ = c.finalizeBlock(b)
 		c.mu.Unlock()
+
+		if c.p2p != nil {
+			if err := c.p2p.PublishBlock(EncodeCompactBlock(NewCompactBlock(b))); err != nil {
+				log.Printf("publish error: %v", err)
+			}
+		}
 	}
 }
 
 func (c *Consensus) finalizeBlock(b *Block) error {
 	log.Printf("Finalized block %d", b.Number)
+	c.pool.Remove(b.Txns)
+	for _, fn := range c.onFinalize {
+		fn(b)
+	}
+	return nil
+}
+
+// OnBlock registers fn to be called when a block is appended to the chain,
+// before it is finalized. The same rules as for OnFinalize apply.
+func (c *Consensus) OnBlock(fn func(*Block)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onBlock = append(c.onBlock, fn)
+}
+
+// OnReceipts registers fn to be called with every block appended to the
+// chain and the receipts of its transactions. The same rules as for
+// OnFinalize apply.
+func (c *Consensus) OnReceipts(fn func(*Block, []*core.Receipt)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onReceipts = append(c.onReceipts, fn)
+}
+
+// OnPendingTx registers fn to be called with every transaction accepted into
+// the mempool. fn must not block.
+func (c *Consensus) OnPendingTx(fn func(bz []byte)) {
+	c.pool.OnAdd(fn)
+}
+
+// OnFinalize registers fn to be called after each block is finalized. fn runs
+// with the consensus lock held and must not call back into Consensus.
+func (c *Consensus) OnFinalize(fn func(*Block)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onFinalize = append(c.onFinalize, fn)
+}
+
+// Params returns the consensus parameters.
+func (c *Consensus) Params() Params {
+	return c.params
+}
+
+// NextBaseFee returns the base fee of the next block.
+func (c *Consensus) NextBaseFee() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.params.NextBaseFee(c.chain[len(c.chain)-1])
+}
+
+// GenesisHash returns the hash of the genesis block.
+func (c *Consensus) GenesisHash() []byte {
+	return c.genesisHash
+}
+
+// Head returns the latest block.
+func (c *Consensus) Head() *Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.chain[len(c.chain)-1]
+}
+
+// BlockByNumber returns the block at height n, or nil if it is not known.
+func (c *Consensus) BlockByNumber(n uint64) *Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.blockByNumber(n)
+}
+
+func (c *Consensus) blockByNumber(n uint64) *Block {
+	base := c.chain[0].Number
+	if n < base || n-base >= uint64(len(c.chain)) {
+		return nil
+	}
+	return c.chain[n-base]
+}
+
+// BlockByHash returns the block with the given hash, or nil if it is not
+// known.
+func (c *Consensus) BlockByHash(hash []byte) *Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.blockByHash(hash)
+}
+
+func (c *Consensus) blockByHash(hash []byte) *Block {
+	for i := len(c.chain) - 1; i >= 0; i-- {
+		if bytes.Equal(c.chain[i].Hash, hash) {
+			return c.chain[i]
+		}
+	}
 	return nil
 }
 
-func (c *Consensus) SubmitTx(from, to string, amount uint64) error {
-	return c.state.Transfer(from, to, amount)
+// ImportBlock appends a block received from a peer. It must extend the
+// current head.
+func (c *Consensus) ImportBlock(b *Block) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.importBlock(b)
+}
+
+func (c *Consensus) importBlock(b *Block) error {
+	head := c.chain[len(c.chain)-1]
+	if b.Number != head.Number+1 {
+		return fmt.Errorf("block %d does not extend head %d", b.Number, head.Number)
+	}
+	if !bytes.Equal(b.Prev, head.Hash) {
+		return fmt.Errorf("block %d prev hash mismatch", b.Number)
+	}
+	if !bytes.Equal(b.ComputeHash(), b.Hash) {
+		return fmt.Errorf("block %d has invalid hash", b.Number)
+	}
+	if err := c.checkProposer(b.Header()); err != nil {
+		return err
+	}
+	ov, receipts, err := c.executeBlock(head, b)
+	if err != nil {
+		return err
+	}
+	if err := c.commitBlock(b, receipts, ov); err != nil {
+		return err
+	}
+	c.appendBlock(b, receipts)
+	log.Printf("Imported block %d by %s", b.Number, b.Proposer)
+	return c.finalizeBlock(b)
+}
+
+// handleGossipBlock imports announced blocks that extend the head and asks
+// the syncer to catch up when a peer is further ahead than one block or the
+// block's transactions cannot be recovered.
+func (c *Consensus) handleGossipBlock(from peerstore.ID, bz []byte) {
+	cb, err := DecodeCompactBlock(bz)
+	if err != nil {
+		log.Printf("invalid block from gossip: %v", err)
+		return
+	}
+	c.mu.Lock()
+	head := c.chain[len(c.chain)-1]
+	behind := c.onBehind
+	skip := c.syncing || cb.Header.Number <= head.Number
+	ahead := cb.Header.Number > head.Number+1
+	c.mu.Unlock()
+	if skip {
+		return
+	}
+	if ahead {
+		if behind != nil {
+			behind()
+		}
+		return
+	}
+
+	b, err := c.reconstruct(context.Background(), cb, from)
+	if err != nil {
+		log.Printf("gossip block rejected: %v", err)
+		if behind != nil {
+			behind()
+		}
+		return
+	}
+	if err := c.ImportBlock(b); err != nil {
+		log.Printf("gossip block rejected: %v", err)
+	}
+}
+
+// Syncing reports whether the node is catching up with its peers.
+func (c *Consensus) Syncing() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.syncing
+}
+
+func (c *Consensus) setSyncing(v bool) {
+	c.mu.Lock()
+	c.syncing = v
+	c.mu.Unlock()
+}
+
+// ResetHead discards the local chain, in memory and in the database, and
+// continues from b. It is used after the state has been restored from a
+// snapshot taken at b, and takes the validator set from that state.
+func (c *Consensus) ResetHead(b *Block) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, err := c.resetEntries(b)
+	if err != nil {
+		return err
+	}
+	if err := c.state.Write(entries); err != nil {
+		return err
+	}
+	c.chain = []*Block{b}
+	c.txIndex = make(map[string]txLocation)
+	c.receipts = make(map[uint64][]*core.Receipt)
+	c.changes = make(map[uint64][]state.Entry)
+	c.indexTxs(b)
+	if err := c.loadValidators(); err != nil {
+		return err
+	}
+	log.Printf("Chain reset to block %d", b.Number)
+	return nil
+}
+
+// BroadcastTx adds an encoded transaction to the mempool and gossips it.
+func (c *Consensus) BroadcastTx(bz []byte) error {
+	if err := c.pool.Add(bz); err != nil {
+		return err
+	}
+	if c.p2p != nil {
+		return c.p2p.PublishTx(bz)
+	}
+	return nil
+}
+
+// SimulateTx executes tx against the state after block height, or after the
+// head if height is 0, in a throwaway overlay, as if it were in the block
+// after it. It returns the receipt and the accounts tx would change. The
+// proposer's tip is not included in the changes. The error reports why tx
+// could not be executed. Heights more than StateHistory blocks below the head
+// are not available.
+func (c *Consensus) SimulateTx(tx *core.Transaction, height uint64) (*core.Receipt, []state.Change, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ov, b, err := c.stateAt(height)
+	if err != nil {
+		return nil, nil, err
+	}
+	rcpt, err := core.ApplyTx(ov, tx, c.params.NextBaseFee(b), b.Number+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes, err := ov.Changes()
+	if err != nil {
+		return nil, nil, err
+	}
+	return rcpt, changes, nil
+}
+
+// GetAccount returns the current state of addr.
+func (c *Consensus) GetAccount(addr string) (*state.Account, error) {
+	return c.state.GetAccount(addr)
 }
 
 func (c *Consensus) GetBalance(addr string) (uint64, error) {
@@ -102,8 +421,13 @@ func (c *Consensus) GetBalance(addr string) (uint64, error) {
 	return a.Balance, nil
 }
 
-func (c *Consensus) SetValidators(vals []string) {
+// SetValidator makes the node propose, and sign, the blocks in the slots of
+// the validator with key, and for it while there is no validator set. By
+// default the node proposes unsigned blocks until there are validators and
+// none after.
+func (c *Consensus) SetValidator(key *ecdsa.PrivateKey) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.validators = vals
+	c.validator = core.PubKeyToAddress(&key.PublicKey).Hex()
+	c.key = key
 }
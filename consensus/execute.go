@@ -0,0 +1,162 @@
+package consensus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+// buildBlock fills the block after head with mempool transactions, by
+// effective tip, that pay at least its base fee and fit in its gas limit,
+// executes them and core.EndBlock and, once the block is sealed, commits
+// the resulting state. Transactions that cannot be included are passed over for the rest
+// of the pool. Those that never can are dropped from the mempool; those
+// waiting for an earlier nonce or a lower base fee stay until the mempool
+// expires them.
+func (c *Consensus) buildBlock(head *Block, proposer string) (*Block, []*core.Receipt, error) {
+	b := &Block{
+		Number:   head.Number + 1,
+		Prev:     head.Hash,
+		Time:     time.Now().Unix(),
+		Txns:     [][]byte{},
+		Proposer: proposer,
+		BaseFee:  c.params.NextBaseFee(head),
+	}
+	ov := state.NewOverlay(c.state)
+	var tips uint64
+	var receipts []*core.Receipt
+	var dropped [][]byte
+	b.Txns = c.pool.Reap(b.BaseFee, maxBlockTxBytes, func(bz []byte) bool {
+		tx, err := core.DecodeTx(bz)
+		if err != nil {
+			dropped = append(dropped, bz)
+			return false
+		}
+		if b.GasUsed+tx.Gas() > c.params.BlockGasLimit {
+			return false
+		}
+		rcpt, err := core.ApplyTx(ov, tx, b.BaseFee, b.Number)
+		if errors.Is(err, core.ErrNonceTooHigh) {
+			return false
+		}
+		if err != nil {
+			dropped = append(dropped, bz)
+			return false
+		}
+		b.GasUsed += rcpt.GasUsed
+		tips += rcpt.Tip
+		receipts = append(receipts, rcpt)
+		return true
+	})
+	c.pool.Remove(dropped)
+
+	if err := core.EndBlock(ov, b.Number, proposer, tips); err != nil {
+		return nil, nil, err
+	}
+	root, err := ov.Root()
+	if err != nil {
+		return nil, nil, err
+	}
+	b.StateRoot = root
+	b.ReceiptsRoot = ReceiptsRoot(receipts)
+	b.Hash = b.ComputeHash()
+	if c.key != nil {
+		if err := b.Sign(c.key); err != nil {
+			return nil, nil, err
+		}
+	}
+	// commit last, so a failure above leaves the state at head
+	if err := c.commit(b, receipts, ov); err != nil {
+		return nil, nil, err
+	}
+	return b, receipts, nil
+}
+
+// executeBlock runs the transactions of b, which extends parent, and
+// core.EndBlock, and returns the resulting state changes, without committing them, and the
+// receipts. Every transaction must be includable, and the base fee, gas
+// used and receipts root must match the header.
+func (c *Consensus) executeBlock(parent, b *Block) (*state.Overlay, []*core.Receipt, error) {
+	if want := c.params.NextBaseFee(parent); b.BaseFee != want {
+		return nil, nil, fmt.Errorf("block %d has base fee %d, want %d", b.Number, b.BaseFee, want)
+	}
+	ov := state.NewOverlay(c.state)
+	var gas, tips uint64
+	receipts := make([]*core.Receipt, 0, len(b.Txns))
+	for i, bz := range b.Txns {
+		tx, err := core.DecodeTx(bz)
+		if err != nil {
+			return nil, nil, fmt.Errorf("block %d tx %d: %v", b.Number, i, err)
+		}
+		rcpt, err := core.ApplyTx(ov, tx, b.BaseFee, b.Number)
+		if err != nil {
+			return nil, nil, fmt.Errorf("block %d tx %d: %v", b.Number, i, err)
+		}
+		gas += rcpt.GasUsed
+		tips += rcpt.Tip
+		receipts = append(receipts, rcpt)
+	}
+	if gas > c.params.BlockGasLimit {
+		return nil, nil, fmt.Errorf("block %d uses %d gas, over the limit of %d", b.Number, gas, c.params.BlockGasLimit)
+	}
+	if gas != b.GasUsed {
+		return nil, nil, fmt.Errorf("block %d uses %d gas, header says %d", b.Number, gas, b.GasUsed)
+	}
+	if !bytes.Equal(ReceiptsRoot(receipts), b.ReceiptsRoot) {
+		return nil, nil, fmt.Errorf("block %d receipts root mismatch", b.Number)
+	}
+	if err := core.EndBlock(ov, b.Number, b.Proposer, tips); err != nil {
+		return nil, nil, err
+	}
+	return ov, receipts, nil
+}
+
+// commitBlock writes the state changes of an imported block if they lead
+// to its state root. On a mismatch nothing is written.
+func (c *Consensus) commitBlock(b *Block, receipts []*core.Receipt, ov *state.Overlay) error {
+	root, err := ov.Root()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(root, b.StateRoot) {
+		return fmt.Errorf("block %d state root mismatch: local %x, block %x", b.Number, root, b.StateRoot)
+	}
+	return c.commit(b, receipts, ov)
+}
+
+// commit writes the state changes of b together with b, its receipts and
+// undo entries as the new head, and reloads the validator set from the new
+// state, so that every node switches to a new set at the same block.
+func (c *Consensus) commit(b *Block, receipts []*core.Receipt, ov *state.Overlay) error {
+	undo := ov.Undo()
+	entries, err := blockEntries(b, receipts, undo)
+	if err != nil {
+		return err
+	}
+	if err := ov.Commit(entries...); err != nil {
+		return err
+	}
+	c.keepChanges(b.Number, undo)
+	return c.loadValidators()
+}
+
+// loadValidators reads the active validators from the state, sorted so
+// that every node rotates proposers in the same order.
+func (c *Consensus) loadValidators() error {
+	vals, err := state.NewOverlay(c.state).Validators()
+	if err != nil {
+		return err
+	}
+	active := []string{}
+	for _, v := range vals {
+		if v.Active {
+			active = append(active, v.Address)
+		}
+	}
+	c.validators = active
+	return nil
+}
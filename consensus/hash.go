@@ -0,0 +1,93 @@
+package consensus
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"github.com/rockandcode4/graphene-proto/core"
+)
+
+// Header is a block without its transactions. Headers are enough to verify
+// chain linkage before the bodies are downloaded.
+type Header struct {
+	Number       uint64
+	Prev         []byte
+	Time         int64
+	TxRoot       []byte
+	Proposer     string
+	StateRoot    []byte
+	ReceiptsRoot []byte
+	GasUsed      uint64
+	BaseFee      uint64
+	Hash         []byte
+	Signature    []byte
+}
+
+func (b *Block) Header() *Header {
+	return &Header{
+		Number:       b.Number,
+		Prev:         b.Prev,
+		Time:         b.Time,
+		TxRoot:       TxRoot(b.Txns),
+		Proposer:     b.Proposer,
+		StateRoot:    b.StateRoot,
+		ReceiptsRoot: b.ReceiptsRoot,
+		GasUsed:      b.GasUsed,
+		BaseFee:      b.BaseFee,
+		Hash:         b.Hash,
+		Signature:    b.Signature,
+	}
+}
+
+// ComputeHash hashes the block header. Transactions are covered through the
+// tx root; the Hash and Signature fields are not.
+func (b *Block) ComputeHash() []byte {
+	return b.Header().ComputeHash()
+}
+
+func (h *Header) ComputeHash() []byte {
+	w := sha256.New()
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], h.Number)
+	w.Write(buf[:])
+	writeBytes(w, h.Prev)
+	binary.BigEndian.PutUint64(buf[:], uint64(h.Time))
+	w.Write(buf[:])
+	writeBytes(w, h.TxRoot)
+	writeBytes(w, []byte(h.Proposer))
+	writeBytes(w, h.StateRoot)
+	writeBytes(w, h.ReceiptsRoot)
+	binary.BigEndian.PutUint64(buf[:], h.GasUsed)
+	w.Write(buf[:])
+	binary.BigEndian.PutUint64(buf[:], h.BaseFee)
+	w.Write(buf[:])
+	return w.Sum(nil)
+}
+
+// TxRoot commits to the ordered list of transactions.
+func TxRoot(txns [][]byte) []byte {
+	w := sha256.New()
+	for _, tx := range txns {
+		sum := sha256.Sum256(tx)
+		w.Write(sum[:])
+	}
+	return w.Sum(nil)
+}
+
+// ReceiptsRoot commits to the ordered list of receipts.
+func ReceiptsRoot(receipts []*core.Receipt) []byte {
+	w := sha256.New()
+	for _, r := range receipts {
+		sum := sha256.Sum256(core.EncodeReceipt(r))
+		w.Write(sum[:])
+	}
+	return w.Sum(nil)
+}
+
+func writeBytes(w io.Writer, bz []byte) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(len(bz)))
+	w.Write(buf[:])
+	w.Write(bz)
+}
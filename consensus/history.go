@@ -0,0 +1,69 @@
+package consensus
+
+import (
+	"fmt"
+
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+// StateHistory is how many blocks below the head SimulateTx, AccountAt and
+// StateAt can rewind the state to.
+const StateHistory = 100 * EpochLength
+
+// keepChanges saves the undo entries of block n, so that the state can be
+// rewound past it, and forgets blocks that fell out of StateHistory.
+func (c *Consensus) keepChanges(n uint64, undo []state.Entry) {
+	c.changes[n] = undo
+	if n >= StateHistory {
+		delete(c.changes, n-StateHistory)
+	}
+}
+
+// stateAt returns an overlay holding the state after block height, or after
+// the head if height is 0, and the block. It must not be committed.
+func (c *Consensus) stateAt(height uint64) (*state.Overlay, *Block, error) {
+	head := c.chain[len(c.chain)-1]
+	if height == 0 {
+		height = head.Number
+	}
+	if height > head.Number {
+		return nil, nil, fmt.Errorf("height %d is above the head %d", height, head.Number)
+	}
+	ov := state.NewOverlay(c.state)
+	for n := head.Number; n > height; n-- {
+		undo, ok := c.changes[n]
+		if !ok {
+			return nil, nil, fmt.Errorf("state at height %d is not available, only the last %d blocks are kept", height, StateHistory)
+		}
+		ov.SetBase(undo)
+	}
+	return ov, c.blockByNumber(height), nil
+}
+
+// AccountAt returns the state of addr after block height, or after the head
+// if height is 0. Heights more than StateHistory blocks below the head are
+// not available.
+func (c *Consensus) AccountAt(addr string, height uint64) (*state.Account, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ov, _, err := c.stateAt(height)
+	if err != nil {
+		return nil, err
+	}
+	return ov.GetAccount(addr)
+}
+
+// StateAt calls fn with the state after block height, or after the head if
+// height is 0, and that block. Heights more than StateHistory blocks below
+// the head are not available. fn runs with the consensus lock held, must
+// not call back into Consensus and must not commit st or use it after
+// returning.
+func (c *Consensus) StateAt(height uint64, fn func(st *state.Overlay, b *Block) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ov, b, err := c.stateAt(height)
+	if err != nil {
+		return err
+	}
+	return fn(ov, b)
+}
@@ -0,0 +1,84 @@
+package consensus
+
+import "math/bits"
+
+// Defaults for Params.
+const (
+	DefaultBlockGasLimit = 10_000_000
+	DefaultMinBaseFee    = 1
+)
+
+const (
+	// elasticityMultiplier sets the gas target to half the block gas limit.
+	elasticityMultiplier = 2
+	// baseFeeChangeDenominator bounds the base fee change to 1/8 per block.
+	baseFeeChangeDenominator = 8
+)
+
+// Params are the consensus parameters. Every node of a chain must use the
+// same values.
+type Params struct {
+	// BlockGasLimit caps the gas used by the transactions of a block.
+	BlockGasLimit uint64
+	// MinBaseFee is the lowest the base fee can go, and so the minimum gas
+	// price.
+	MinBaseFee uint64
+}
+
+func DefaultParams() Params {
+	return Params{BlockGasLimit: DefaultBlockGasLimit, MinBaseFee: DefaultMinBaseFee}
+}
+
+func (p Params) withDefaults() Params {
+	if p.BlockGasLimit == 0 {
+		p.BlockGasLimit = DefaultBlockGasLimit
+	}
+	if p.MinBaseFee == 0 {
+		p.MinBaseFee = DefaultMinBaseFee
+	}
+	return p
+}
+
+// GasTarget is the gas use at which the base fee stays the same.
+func (p Params) GasTarget() uint64 {
+	return p.BlockGasLimit / elasticityMultiplier
+}
+
+// NextBaseFee returns the base fee of the block after parent, as in
+// EIP-1559: it rises by up to 1/8 when parent used more than the gas target
+// and falls by up to 1/8 when it used less, never going below MinBaseFee.
+func (p Params) NextBaseFee(parent *Block) uint64 {
+	base := parent.BaseFee
+	if base < p.MinBaseFee {
+		// genesis, or a MinBaseFee raised since
+		return p.MinBaseFee
+	}
+	target := p.GasTarget()
+	switch {
+	case parent.GasUsed > target:
+		delta := mulDiv(base, parent.GasUsed-target, target) / baseFeeChangeDenominator
+		if delta == 0 {
+			delta = 1
+		}
+		if base > ^uint64(0)-delta {
+			return ^uint64(0)
+		}
+		base += delta
+	case parent.GasUsed < target:
+		base -= mulDiv(base, target-parent.GasUsed, target) / baseFeeChangeDenominator
+	}
+	if base < p.MinBaseFee {
+		base = p.MinBaseFee
+	}
+	return base
+}
+
+// mulDiv returns a*b/c, saturating if the result does not fit.
+func mulDiv(a, b, c uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	if hi >= c {
+		return ^uint64(0)
+	}
+	q, _ := bits.Div64(hi, lo, c)
+	return q
+}
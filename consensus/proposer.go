@@ -0,0 +1,75 @@
+package consensus
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/rockandcode4/graphene-proto/core"
+)
+
+// Sign signs the hash of b with the proposer's key. The signature is not
+// part of the hash.
+func (b *Block) Sign(priv *ecdsa.PrivateKey) error {
+	sig, err := crypto.Sign(b.Hash, priv)
+	if err != nil {
+		return err
+	}
+	b.Signature = sig
+	return nil
+}
+
+// Signer returns the address of the key that signed the header.
+func (h *Header) Signer() (string, error) {
+	if len(h.Signature) != crypto.SignatureLength {
+		return "", fmt.Errorf("block %d is not signed", h.Number)
+	}
+	pub, err := crypto.SigToPub(h.Hash, h.Signature)
+	if err != nil {
+		return "", fmt.Errorf("block %d signature: %v", h.Number, err)
+	}
+	return core.PubKeyToAddress(pub).Hex(), nil
+}
+
+// proposerAt returns the validator whose turn it is to propose block n, or
+// "" while there are no validators.
+func (c *Consensus) proposerAt(n uint64) string {
+	if len(c.validators) == 0 {
+		return ""
+	}
+	return c.validators[n%uint64(len(c.validators))]
+}
+
+// checkProposer verifies that the block of h is signed by its proposer and
+// that the proposer is entitled to it. The next block must come from the
+// validator in its slot; for blocks further ahead the validator set may
+// still change, so any validator is accepted. Until there are validators
+// anyone may propose, and only signed blocks are checked.
+func (c *Consensus) checkProposer(h *Header) error {
+	if len(c.validators) == 0 && len(h.Signature) == 0 {
+		return nil
+	}
+	signer, err := h.Signer()
+	if err != nil {
+		return err
+	}
+	if signer != h.Proposer {
+		return fmt.Errorf("block %d is signed by %s, not its proposer %s", h.Number, signer, h.Proposer)
+	}
+	if len(c.validators) == 0 {
+		return nil
+	}
+	if head := c.chain[len(c.chain)-1]; h.Number == head.Number+1 {
+		if want := c.proposerAt(h.Number); h.Proposer != want {
+			return fmt.Errorf("block %d is proposed by %s, not %s whose slot it is", h.Number, h.Proposer, want)
+		}
+		return nil
+	}
+	for _, v := range c.validators {
+		if v == h.Proposer {
+			return nil
+		}
+	}
+	return fmt.Errorf("block %d is proposed by %s, which is not a validator", h.Number, h.Proposer)
+}
@@ -0,0 +1,260 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/rockandcode4/graphene-proto/p2p"
+)
+
+// bodyBatch is the number of blocks requested from a single peer at once
+// while downloading bodies in parallel.
+const bodyBatch = 16
+
+// SyncStatus implements p2p.ChainProvider.
+func (c *Consensus) SyncStatus() p2p.SyncStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	head := c.chain[len(c.chain)-1]
+	return p2p.SyncStatus{GenesisHash: c.genesisHash, HeadHeight: head.Number, HeadHash: head.Hash}
+}
+
+// HeadersRange implements p2p.ChainProvider.
+func (c *Consensus) HeadersRange(from uint64, count int) ([]json.RawMessage, error) {
+	return c.encodeRange(from, count, func(b *Block) interface{} { return b.Header() })
+}
+
+// BlocksRange implements p2p.ChainProvider.
+func (c *Consensus) BlocksRange(from uint64, count int) ([]json.RawMessage, error) {
+	return c.encodeRange(from, count, func(b *Block) interface{} { return b })
+}
+
+func (c *Consensus) encodeRange(from uint64, count int, view func(*Block) interface{}) ([]json.RawMessage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	base := c.chain[0].Number
+	if from < base {
+		return nil, fmt.Errorf("blocks before %d are not available", base)
+	}
+	var out []json.RawMessage
+	for i := from - base; i < uint64(len(c.chain)) && len(out) < count; i++ {
+		bz, err := json.Marshal(view(c.chain[i]))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, bz)
+	}
+	return out, nil
+}
+
+// Syncer catches the local chain up with its peers over p2p.SyncProtocol:
+// headers are fetched from the best peer and checked for linkage, then
+// bodies are downloaded from every peer that has them in parallel. Once
+// caught up the node follows the chain through gossip again.
+type Syncer struct {
+	cons    *Consensus
+	p2p     *p2p.P2P
+	trigger chan struct{}
+}
+
+func NewSyncer(c *Consensus, p *p2p.P2P) *Syncer {
+	s := &Syncer{cons: c, p2p: p, trigger: make(chan struct{}, 1)}
+	p.ServeSync(c)
+	p.OnConnect(func(peerstore.ID) { s.Trigger() })
+	c.mu.Lock()
+	c.onBehind = s.Trigger
+	c.mu.Unlock()
+	return s
+}
+
+// Start runs a sync round now, whenever Trigger is called, and every 30s.
+func (s *Syncer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			if err := s.Sync(ctx); err != nil {
+				log.Printf("sync: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.trigger:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Trigger schedules a sync round without blocking.
+func (s *Syncer) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Sync runs until the local head reaches the best head advertised by peers
+// at the start of the round.
+func (s *Syncer) Sync(ctx context.Context) error {
+	statuses := s.handshake(ctx)
+	var best peerstore.ID
+	var target uint64
+	for pid, st := range statuses {
+		if st.HeadHeight > target {
+			best, target = pid, st.HeadHeight
+		}
+	}
+	if target <= s.cons.Head().Number {
+		return nil
+	}
+
+	s.cons.setSyncing(true)
+	defer s.cons.setSyncing(false)
+	log.Printf("Syncing from height %d to %d (%d peers)", s.cons.Head().Number, target, len(statuses))
+
+	for {
+		head := s.cons.Head()
+		if head.Number >= target {
+			break
+		}
+		headers, err := s.fetchHeaders(ctx, best, head)
+		if err != nil {
+			return err
+		}
+		last := headers[len(headers)-1].Number
+		var peers []peerstore.ID
+		for pid, st := range statuses {
+			if st.HeadHeight >= last {
+				peers = append(peers, pid)
+			}
+		}
+		blocks, err := s.fetchBodies(ctx, headers, peers)
+		if err != nil {
+			return err
+		}
+		for _, b := range blocks {
+			if err := s.cons.ImportBlock(b); err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("Sync complete at height %d", target)
+	return nil
+}
+
+// handshake exchanges status with every connected peer in parallel and
+// returns the ones on our genesis.
+func (s *Syncer) handshake(ctx context.Context) map[peerstore.ID]p2p.SyncStatus {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	out := map[peerstore.ID]p2p.SyncStatus{}
+	for _, pid := range s.p2p.Peers() {
+		wg.Add(1)
+		go func(pid peerstore.ID) {
+			defer wg.Done()
+			st, err := s.p2p.Handshake(ctx, pid)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			out[pid] = *st
+			mu.Unlock()
+		}(pid)
+	}
+	wg.Wait()
+	return out
+}
+
+// fetchHeaders downloads the next batch of headers after head from pid and
+// verifies that they form a chain on top of it.
+func (s *Syncer) fetchHeaders(ctx context.Context, pid peerstore.ID, head *Block) ([]*Header, error) {
+	raw, err := s.p2p.FetchHeaders(ctx, pid, head.Number+1, p2p.MaxSyncBatch)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("peer %s returned no headers after %d", pid, head.Number)
+	}
+	headers := make([]*Header, len(raw))
+	prevNum, prevHash := head.Number, head.Hash
+	for i, bz := range raw {
+		var h Header
+		if err := json.Unmarshal(bz, &h); err != nil {
+			return nil, err
+		}
+		if h.Number != prevNum+1 || !bytes.Equal(h.Prev, prevHash) || !bytes.Equal(h.ComputeHash(), h.Hash) {
+			return nil, fmt.Errorf("peer %s sent a broken header chain at %d", pid, h.Number)
+		}
+		headers[i] = &h
+		prevNum, prevHash = h.Number, h.Hash
+	}
+	return headers, nil
+}
+
+// fetchBodies downloads the blocks for headers, splitting them into batches
+// spread over peers and retrying a failed batch on the next peer.
+func (s *Syncer) fetchBodies(ctx context.Context, headers []*Header, peers []peerstore.ID) ([]*Block, error) {
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no peers have blocks up to %d", headers[len(headers)-1].Number)
+	}
+	blocks := make([]*Block, len(headers))
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for start, job := 0, 0; start < len(headers); start, job = start+bodyBatch, job+1 {
+		end := start + bodyBatch
+		if end > len(headers) {
+			end = len(headers)
+		}
+		wg.Add(1)
+		go func(start, end, job int) {
+			defer wg.Done()
+			var err error
+			for i := range peers {
+				pid := peers[(job+i)%len(peers)]
+				if err = s.fetchBatch(ctx, pid, headers[start:end], blocks[start:end]); err == nil {
+					return
+				}
+				log.Printf("sync: blocks %d-%d from %s: %v", headers[start].Number, headers[end-1].Number, pid, err)
+			}
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}(start, end, job)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return blocks, nil
+}
+
+// fetchBatch fills out with the blocks matching headers, as served by pid.
+func (s *Syncer) fetchBatch(ctx context.Context, pid peerstore.ID, headers []*Header, out []*Block) error {
+	raw, err := s.p2p.FetchBlocks(ctx, pid, headers[0].Number, len(headers))
+	if err != nil {
+		return err
+	}
+	if len(raw) < len(headers) {
+		return fmt.Errorf("got %d blocks, want %d", len(raw), len(headers))
+	}
+	for i, h := range headers {
+		var b Block
+		if err := json.Unmarshal(raw[i], &b); err != nil {
+			return err
+		}
+		if !bytes.Equal(b.ComputeHash(), h.Hash) {
+			return fmt.Errorf("block %d does not match its header", h.Number)
+		}
+		out[i] = &b
+	}
+	return nil
+}
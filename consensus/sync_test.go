@@ -0,0 +1,222 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/mempool"
+	"github.com/rockandcode4/graphene-proto/p2p"
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+func newTestP2P(t *testing.T) *p2p.P2P {
+	t.Helper()
+	p, err := p2p.NewP2P(context.Background(), p2p.Config{ListenAddr: "/ip4/127.0.0.1/tcp/0", ChainID: "sync-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Stop() })
+	return p
+}
+
+// newTestChain returns a node at genesis whose state funds the account of
+// key.
+func newTestChain(t *testing.T, p *p2p.P2P, key *ecdsa.PrivateKey) *Consensus {
+	t.Helper()
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := state.NewStateDB(db)
+	if err := st.PutAccount(&state.Account{Address: core.PubKeyToAddress(&key.PublicKey).Hex(), Balance: 1000000}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewConsensus(st, mempool.New(100), p, Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// produce builds n blocks on c, the first of them holding a transfer from
+// key.
+func produce(t *testing.T, c *Consensus, key *ecdsa.PrivateKey, n int) {
+	t.Helper()
+	from, err := c.state.GetAccount(core.PubKeyToAddress(&key.PublicKey).Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := &core.Transaction{Type: core.TxTransfer, From: from.Address, To: "0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0", Amount: 30, Nonce: from.Nonce, MaxFee: 2, Tip: 1}
+	if err := tx.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.pool.Add(core.EncodeTx(tx)); err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := 0; i < n; i++ {
+		b, receipts, err := c.buildBlock(c.chain[len(c.chain)-1], "proposer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.appendBlock(b, receipts)
+	}
+	if len(c.chain[len(c.chain)-n].Txns) != 1 {
+		t.Fatal("transfer not included")
+	}
+}
+
+// syncFrom connects a new node to p and runs one sync round on it.
+func syncFrom(t *testing.T, p *p2p.P2P, key *ecdsa.PrivateKey) (*Consensus, error) {
+	t.Helper()
+	local := newTestP2P(t)
+	c := newTestChain(t, local, key)
+	s := NewSyncer(c, local)
+	if err := local.ConnectToPeer(p.Addrs()[0]); err != nil {
+		t.Fatal(err)
+	}
+	return c, s.Sync(context.Background())
+}
+
+func TestSyncCatchesUp(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := newTestP2P(t)
+	ahead := newTestChain(t, remote, key)
+	remote.ServeSync(ahead)
+	// more than one body batch
+	produce(t, ahead, key, 2*bodyBatch+3)
+
+	c, err := syncFrom(t, remote, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.Head(), ahead.Head(); got.Number != want.Number || !bytes.Equal(got.Hash, want.Hash) {
+		t.Fatalf("head %d %x, want %d %x", got.Number, got.Hash, want.Number, want.Hash)
+	}
+	got, _ := c.state.Root()
+	want, _ := ahead.state.Root()
+	if !bytes.Equal(got, want) {
+		t.Fatal("synced state differs")
+	}
+	if c.Syncing() {
+		t.Fatal("still syncing")
+	}
+}
+
+// tamperedChain serves the chain of a Consensus with either its headers or
+// its blocks altered.
+type tamperedChain struct {
+	*Consensus
+	headers bool
+}
+
+func (tc tamperedChain) HeadersRange(from uint64, count int) ([]json.RawMessage, error) {
+	raw, err := tc.Consensus.HeadersRange(from, count)
+	if tc.headers && len(raw) > 1 {
+		// skip a header, breaking the linkage
+		raw = append(raw[:1], raw[2:]...)
+	}
+	return raw, err
+}
+
+func (tc tamperedChain) BlocksRange(from uint64, count int) ([]json.RawMessage, error) {
+	raw, err := tc.Consensus.BlocksRange(from, count)
+	if tc.headers || err != nil || len(raw) == 0 {
+		return raw, err
+	}
+	var b Block
+	if err := json.Unmarshal(raw[0], &b); err != nil {
+		return nil, err
+	}
+	b.Txns = nil
+	raw[0], err = json.Marshal(&b)
+	return raw, err
+}
+
+func TestSyncRejectsBadRange(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		headers bool
+		want    string
+	}{
+		{"broken header chain", true, "broken header chain"},
+		{"block not matching its header", false, "does not match its header"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := crypto.GenerateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			remote := newTestP2P(t)
+			ahead := newTestChain(t, remote, key)
+			remote.ServeSync(tamperedChain{Consensus: ahead, headers: tc.headers})
+			produce(t, ahead, key, 5)
+
+			c, err := syncFrom(t, remote, key)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("got %v, want %q", err, tc.want)
+			}
+			if c.Head().Number != 0 {
+				t.Fatalf("imported up to %d", c.Head().Number)
+			}
+		})
+	}
+}
+
+func TestRestartKeepsChain(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := newTestP2P(t)
+	ahead := newTestChain(t, remote, key)
+	remote.ServeSync(ahead)
+	produce(t, ahead, key, 5)
+	c, err := syncFrom(t, remote, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer := ahead.chain[1].Txns[0]
+
+	// restart on the same database
+	local := newTestP2P(t)
+	restarted, err := NewConsensus(c.state, mempool.New(100), local, Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := restarted.Head(), ahead.Head(); got.Number != want.Number || !bytes.Equal(got.Hash, want.Hash) {
+		t.Fatalf("head after restart %d %x, want %d %x", got.Number, got.Hash, want.Number, want.Hash)
+	}
+	if _, ok := restarted.Receipt(mempool.Key(transfer)); !ok {
+		t.Fatal("receipt lost on restart")
+	}
+	before, err := restarted.AccountAt(core.PubKeyToAddress(&key.PublicKey).Hex(), 1)
+	if err != nil || before.Nonce != 1 {
+		t.Fatalf("state history after restart: %+v, %v", before, err)
+	}
+
+	// and keep syncing from there
+	produce(t, ahead, key, 3)
+	if err := local.ConnectToPeer(remote.Addrs()[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewSyncer(restarted, local).Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := restarted.Head(), ahead.Head(); got.Number != want.Number || !bytes.Equal(got.Hash, want.Hash) {
+		t.Fatalf("head after resync %d %x, want %d %x", got.Number, got.Hash, want.Number, want.Hash)
+	}
+}
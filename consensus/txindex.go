@@ -0,0 +1,83 @@
+package consensus
+
+import (
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/mempool"
+)
+
+// txLocation is where a committed transaction sits in the chain.
+type txLocation struct {
+	number uint64
+	index  int
+}
+
+// TxLookup is a transaction found by hash. Block is nil for transactions
+// that are still pending in the mempool.
+type TxLookup struct {
+	Tx    *core.Transaction
+	Raw   []byte
+	Block *Block
+	Index int
+}
+
+func (c *Consensus) appendBlock(b *Block, receipts []*core.Receipt) {
+	c.chain = append(c.chain, b)
+	c.indexTxs(b)
+	c.receipts[b.Number] = receipts
+	for _, fn := range c.onBlock {
+		fn(b)
+	}
+	for _, fn := range c.onReceipts {
+		fn(b, receipts)
+	}
+}
+
+func (c *Consensus) indexTxs(b *Block) {
+	for i, tx := range b.Txns {
+		c.txIndex[string(mempool.Key(tx))] = txLocation{number: b.Number, index: i}
+	}
+}
+
+// FindTx looks a transaction up by hash among committed blocks and then in
+// the mempool.
+func (c *Consensus) FindTx(hash []byte) (*TxLookup, bool) {
+	c.mu.Lock()
+	loc, ok := c.txIndex[string(hash)]
+	var b *Block
+	if ok {
+		b = c.blockByNumber(loc.number)
+	}
+	c.mu.Unlock()
+
+	var raw []byte
+	if b != nil {
+		raw = b.Txns[loc.index]
+	} else if raw, ok = c.pool.Get(hash); !ok {
+		return nil, false
+	}
+	tx, err := core.DecodeTx(raw)
+	if err != nil {
+		return nil, false
+	}
+	return &TxLookup{Tx: tx, Raw: raw, Block: b, Index: loc.index}, true
+}
+
+// Receipt returns the receipt of a committed transaction.
+func (c *Consensus) Receipt(hash []byte) (*core.Receipt, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	loc, ok := c.txIndex[string(hash)]
+	if !ok || loc.index >= len(c.receipts[loc.number]) {
+		return nil, false
+	}
+	return c.receipts[loc.number][loc.index], true
+}
+
+// BlockReceipts returns the receipts of the transactions of block n, in
+// order, or nil if they are not known. Blocks restored from a snapshot have
+// no receipts.
+func (c *Consensus) BlockReceipts(n uint64) []*core.Receipt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.receipts[n]
+}
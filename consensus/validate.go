@@ -0,0 +1,64 @@
+package consensus
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/p2p"
+)
+
+// maxClockDrift is how far ahead of local time a block timestamp may be.
+const maxClockDrift = 15 * time.Second
+
+// ValidateBasic performs the checks that need no chain context.
+func (b *Block) ValidateBasic() error {
+	if b.Number == 0 {
+		return fmt.Errorf("genesis block cannot be relayed")
+	}
+	if b.Proposer == "" {
+		return fmt.Errorf("block %d has no proposer", b.Number)
+	}
+	if !bytes.Equal(b.ComputeHash(), b.Hash) {
+		return fmt.Errorf("block %d has invalid hash", b.Number)
+	}
+	if time.Unix(b.Time, 0).After(time.Now().Add(maxClockDrift)) {
+		return fmt.Errorf("block %d is from the future", b.Number)
+	}
+	for i, bz := range b.Txns {
+		if _, err := core.CheckTx(bz); err != nil {
+			return fmt.Errorf("block %d tx %d: %v", b.Number, i, err)
+		}
+	}
+	return nil
+}
+
+// validateGossipBlock is the pubsub validator for the blocks topic. Only
+// the header of a compact block can be checked here; transactions are
+// checked once the block has been reconstructed.
+func (c *Consensus) validateGossipBlock(_ peerstore.ID, bz []byte) p2p.Validation {
+	cb, err := DecodeCompactBlock(bz)
+	if err != nil {
+		return p2p.ValidationReject
+	}
+	if err := cb.ValidateBasic(); err != nil {
+		return p2p.ValidationReject
+	}
+
+	h := cb.Header
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if known := c.blockByNumber(h.Number); known != nil && bytes.Equal(known.Hash, h.Hash) {
+		return p2p.ValidationDuplicate
+	}
+	if c.syncing || h.Number <= c.chain[len(c.chain)-1].Number {
+		return p2p.ValidationIgnore
+	}
+	if err := c.checkProposer(h); err != nil {
+		return p2p.ValidationReject
+	}
+	return p2p.ValidationAccept
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// AddressLength is the size of an address in bytes.
+const AddressLength = 20
+
+// Address identifies an account: the last 20 bytes of the Keccak-256 hash
+// of the account's uncompressed public key, as in Ethereum, so keys and
+// addresses carry over to Ethereum wallets and the eth_* RPCs. Its text
+// form is 0x-prefixed hex with the EIP-55 mixed-case checksum; that form is
+// the one used in transactions and as the key of the account state.
+type Address [AddressLength]byte
+
+// PubKeyToAddress derives the address of a public key.
+func PubKeyToAddress(pub *ecdsa.PublicKey) Address {
+	return Address(crypto.PubkeyToAddress(*pub))
+}
+
+// BytesToAddress converts 20 raw bytes to an address.
+func BytesToAddress(b []byte) (Address, error) {
+	var a Address
+	if len(b) != AddressLength {
+		return a, fmt.Errorf("address must be %d bytes, got %d", AddressLength, len(b))
+	}
+	copy(a[:], b)
+	return a, nil
+}
+
+// ParseAddress parses the hex form of an address. All-lowercase and
+// all-uppercase hex is accepted; mixed case must carry a valid checksum.
+func ParseAddress(s string) (Address, error) {
+	var a Address
+	h := strings.TrimPrefix(s, "0x")
+	if len(h) != 2*AddressLength || len(h) == len(s) {
+		return a, fmt.Errorf("invalid address %q: want 0x and %d hex digits", s, 2*AddressLength)
+	}
+	if _, err := hex.Decode(a[:], []byte(h)); err != nil {
+		return a, fmt.Errorf("invalid address %q: %v", s, err)
+	}
+	if h != strings.ToLower(h) && h != strings.ToUpper(h) && a.Hex() != s {
+		return a, fmt.Errorf("invalid address %q: bad checksum", s)
+	}
+	return a, nil
+}
+
+// NormalizeAddress parses s and returns it in checksummed form, for
+// addresses given by users.
+func NormalizeAddress(s string) (string, error) {
+	a, err := ParseAddress(s)
+	if err != nil {
+		return "", err
+	}
+	return a.Hex(), nil
+}
+
+// ValidateAddress checks that s is an address in checksummed form, as
+// required wherever addresses are stored.
+func ValidateAddress(s string) error {
+	a, err := ParseAddress(s)
+	if err != nil {
+		return err
+	}
+	if a.Hex() != s {
+		return fmt.Errorf("address %q is not checksummed, use %s", s, a.Hex())
+	}
+	return nil
+}
+
+// Hex returns the checksummed hex form of a.
+func (a Address) Hex() string {
+	return common.Address(a).Hex()
+}
+
+func (a Address) String() string {
+	return a.Hex()
+}
+
+func (a Address) Bytes() []byte {
+	return a[:]
+}
+
+func (a Address) IsZero() bool {
+	return a == Address{}
+}
+
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.Hex()), nil
+}
+
+func (a *Address) UnmarshalText(b []byte) error {
+	p, err := ParseAddress(string(b))
+	if err != nil {
+		return err
+	}
+	*a = p
+	return nil
+}
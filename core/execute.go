@@ -0,0 +1,133 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+var (
+	ErrNonceTooLow  = errors.New("nonce too low")
+	ErrNonceTooHigh = errors.New("nonce too high")
+)
+
+// State is the store transactions execute against, in practice a
+// state.Overlay on top of the StateDB.
+type State interface {
+	GetAccount(addr string) (*state.Account, error)
+	PutAccount(a *state.Account) error
+	GetValidator(addr string) (*state.Validator, error)
+	PutValidator(v *state.Validator) error
+	GetDelegation(validator, delegator string) (*state.Delegation, error)
+	PutDelegation(d *state.Delegation) error
+	Delegations(validator string) ([]*state.Delegation, error)
+	GetUnbonding(height uint64, delegator, validator string) (*state.Unbonding, error)
+	PutUnbonding(u *state.Unbonding) error
+	Unbondings(height uint64) ([]*state.Unbonding, error)
+	GetReward(addr, validator string) (*state.Reward, error)
+	PutReward(r *state.Reward) error
+	Rewards(addr string) ([]*state.Reward, error)
+}
+
+// ApplyTx executes tx against st in block height with the given base fee:
+// it checks and bumps the sender's nonce, charges the fee and moves the
+// amount. Stake and delegate transactions bond the amount to a validator
+// in st, so the validator set is part of the state; undelegate
+// transactions unbond it until UnbondingBlocks after height. The base fee
+// part of the fee is burned; paying the tip is up to EndBlock. The
+// signature is not checked here.
+//
+// An error means tx cannot be included in the block: it is malformed, has
+// the wrong nonce or cannot pay its fee. Such transactions leave st
+// untouched. Other errors come from st itself and may leave it partly
+// written, so callers should execute on an Overlay. A transaction that pays
+// its fee but cannot move its amount is included with a failed receipt.
+func ApplyTx(st State, tx *Transaction, baseFee, height uint64) (*Receipt, error) {
+	if err := tx.ValidateBasic(); err != nil {
+		return nil, err
+	}
+	if tx.MaxFee < baseFee {
+		return nil, fmt.Errorf("max fee %d is below the base fee %d", tx.MaxFee, baseFee)
+	}
+	gas := tx.Gas()
+	fee, err := mulGas(gas, tx.GasPrice(baseFee))
+	if err != nil {
+		return nil, err
+	}
+	burned := gas * baseFee
+
+	from, err := st.GetAccount(tx.From)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case tx.Nonce < from.Nonce:
+		return nil, fmt.Errorf("%w: %d, account nonce is %d", ErrNonceTooLow, tx.Nonce, from.Nonce)
+	case tx.Nonce > from.Nonce:
+		return nil, fmt.Errorf("%w: %d, account nonce is %d", ErrNonceTooHigh, tx.Nonce, from.Nonce)
+	}
+	if from.Balance < fee {
+		return nil, fmt.Errorf("insufficient balance for fee: have %d, need %d", from.Balance, fee)
+	}
+	from.Nonce++
+	from.Balance -= fee
+	rcpt := &Receipt{TxHash: tx.Hash(), GasUsed: gas, Fee: fee, Burned: burned, Tip: fee - burned}
+	reason, err := cannotMove(st, tx, from)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		rcpt.Error = reason
+		if err := st.PutAccount(from); err != nil {
+			return nil, err
+		}
+		return rcpt, nil
+	}
+	from.Balance -= tx.Value()
+	if err := st.PutAccount(from); err != nil {
+		return nil, err
+	}
+	switch tx.Type {
+	case TxTransfer:
+		to, err := st.GetAccount(tx.To)
+		if err != nil {
+			return nil, err
+		}
+		to.Balance += tx.Amount
+		if err := st.PutAccount(to); err != nil {
+			return nil, err
+		}
+	case TxStake:
+		if err := bond(st, tx.From, tx.Amount); err != nil {
+			return nil, err
+		}
+	case TxDelegate:
+		if err := delegate(st, tx.From, tx.Validator, tx.Amount); err != nil {
+			return nil, err
+		}
+	case TxUndelegate:
+		if err := undelegate(st, tx.From, tx.Validator, tx.Amount, height+UnbondingBlocks); err != nil {
+			return nil, err
+		}
+	}
+	rcpt.Success = true
+	rcpt.Logs = txLogs(tx)
+	return rcpt, nil
+}
+
+// cannotMove returns why tx cannot move its amount, or "" if it can. from
+// has paid the fee already.
+func cannotMove(st State, tx *Transaction, from *state.Account) (string, error) {
+	if tx.Type == TxUndelegate {
+		bonded, err := bondedBy(st, tx.From, tx.Validator)
+		if err != nil || bonded >= tx.Amount {
+			return "", err
+		}
+		return fmt.Sprintf("insufficient stake: %d bonded to %s, need %d", bonded, tx.Validator, tx.Amount), nil
+	}
+	if from.Balance < tx.Value() {
+		return fmt.Sprintf("insufficient balance: have %d after the fee, need %d", from.Balance, tx.Value()), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"fmt"
+	"math"
+)
+
+// Gas charged per transaction type, plus GasPerSignature for each
+// signature of a multisig transaction. The cost is known from the
+// transaction alone, so transactions carry no gas limit.
+const (
+	GasTransfer     = 21000
+	GasStake        = 50000
+	GasDelegate     = 40000
+	GasUndelegate   = 40000
+	GasPerSignature = 3000
+)
+
+// GasCost returns the gas a transaction of the given type uses, or 0 for
+// unknown types.
+func GasCost(txType string) uint64 {
+	switch txType {
+	case TxTransfer:
+		return GasTransfer
+	case TxStake:
+		return GasStake
+	case TxDelegate:
+		return GasDelegate
+	case TxUndelegate:
+		return GasUndelegate
+	}
+	return 0
+}
+
+// Gas returns the gas tx uses.
+func (tx *Transaction) Gas() uint64 {
+	return GasCost(tx.Type) + uint64(len(tx.Signatures))*GasPerSignature
+}
+
+// EffectiveTip is the tip per gas tx pays in a block with the given base
+// fee: its Tip, capped so that base fee and tip stay within MaxFee.
+func (tx *Transaction) EffectiveTip(baseFee uint64) uint64 {
+	if tx.MaxFee <= baseFee {
+		return 0
+	}
+	if left := tx.MaxFee - baseFee; left < tx.Tip {
+		return left
+	}
+	return tx.Tip
+}
+
+// GasPrice is the price per gas tx pays in a block with the given base fee.
+func (tx *Transaction) GasPrice(baseFee uint64) uint64 {
+	return baseFee + tx.EffectiveTip(baseFee)
+}
+
+// mulGas returns gas*price, failing on overflow.
+func mulGas(gas, price uint64) (uint64, error) {
+	if price != 0 && gas > math.MaxUint64/price {
+		return 0, fmt.Errorf("fee overflows")
+	}
+	return gas * price, nil
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/rockandcode4/graphene-proto/codec"
+)
+
+// MaxMultisigKeys bounds the number of keys of a multisig account.
+const MaxMultisigKeys = 16
+
+// Multisig is an M-of-N account: a transaction from its address needs
+// signatures by Threshold of PubKeys. The address commits to both, so the
+// definition travels with every transaction instead of living in the
+// state.
+type Multisig struct {
+	Threshold uint64   `json:"threshold"`
+	PubKeys   [][]byte `json:"pub_keys"` // compressed, sorted
+}
+
+// NewMultisig returns the threshold-of-len(pubs) account of pubs. The
+// order of pubs does not matter.
+func NewMultisig(threshold uint64, pubs []*ecdsa.PublicKey) (*Multisig, error) {
+	m := &Multisig{Threshold: threshold}
+	for _, p := range pubs {
+		m.PubKeys = append(m.PubKeys, crypto.CompressPubkey(p))
+	}
+	sort.Slice(m.PubKeys, func(i, j int) bool { return bytes.Compare(m.PubKeys[i], m.PubKeys[j]) < 0 })
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Validate checks the threshold and that the keys are valid, sorted and
+// distinct.
+func (m *Multisig) Validate() error {
+	n := len(m.PubKeys)
+	if n == 0 || n > MaxMultisigKeys {
+		return fmt.Errorf("multisig needs 1 to %d keys, has %d", MaxMultisigKeys, n)
+	}
+	if m.Threshold == 0 || m.Threshold > uint64(n) {
+		return fmt.Errorf("multisig threshold %d out of range 1-%d", m.Threshold, n)
+	}
+	for i, pk := range m.PubKeys {
+		if _, err := crypto.DecompressPubkey(pk); err != nil {
+			return fmt.Errorf("multisig key %d: %v", i, err)
+		}
+		if i > 0 && bytes.Compare(m.PubKeys[i-1], pk) >= 0 {
+			return fmt.Errorf("multisig keys are not sorted and distinct")
+		}
+	}
+	return nil
+}
+
+// Address derives the account address from the threshold and keys.
+func (m *Multisig) Address() Address {
+	var w codec.Writer
+	w.String("multisig")
+	w.Uint(m.Threshold)
+	w.BytesList(m.PubKeys)
+	var a Address
+	copy(a[:], crypto.Keccak256(w.Out())[32-AddressLength:])
+	return a
+}
+
+// index returns the position of pub among the keys, or -1.
+func (m *Multisig) index(pub *ecdsa.PublicKey) int {
+	pk := crypto.CompressPubkey(pub)
+	i := sort.Search(len(m.PubKeys), func(i int) bool { return bytes.Compare(m.PubKeys[i], pk) >= 0 })
+	if i < len(m.PubKeys) && bytes.Equal(m.PubKeys[i], pk) {
+		return i
+	}
+	return -1
+}
+
+// signers returns the key index of the signer of each of sigs over hash.
+func (m *Multisig) signers(hash []byte, sigs [][]byte) ([]int, error) {
+	out := make([]int, len(sigs))
+	for i, sig := range sigs {
+		if len(sig) != crypto.SignatureLength {
+			return nil, fmt.Errorf("signature %d is malformed", i)
+		}
+		pub, err := crypto.SigToPub(hash, sig)
+		if err != nil {
+			return nil, fmt.Errorf("signature %d: %v", i, err)
+		}
+		if !crypto.VerifySignature(crypto.FromECDSAPub(pub), hash, sig[:64]) {
+			return nil, fmt.Errorf("signature %d is invalid", i)
+		}
+		if out[i] = m.index(pub); out[i] < 0 {
+			return nil, fmt.Errorf("signature %d is not by a key of the multisig", i)
+		}
+	}
+	return out, nil
+}
+
+// SignMultisig adds a signature by priv, one of the keys of tx.Multisig,
+// to tx. A transaction may be signed by each owner separately and the
+// copies merged with CombineSignatures.
+func (tx *Transaction) SignMultisig(priv *ecdsa.PrivateKey) error {
+	if tx.Multisig == nil {
+		return fmt.Errorf("not a multisig transaction")
+	}
+	if tx.Multisig.index(&priv.PublicKey) < 0 {
+		return fmt.Errorf("key %x is not part of the multisig", crypto.CompressPubkey(&priv.PublicKey))
+	}
+	sig, err := crypto.Sign(tx.SigningHash(), priv)
+	if err != nil {
+		return err
+	}
+	return tx.addSignatures([][]byte{sig})
+}
+
+// addSignatures merges sigs into tx.Signatures, keeping them in key order
+// with one per signer.
+func (tx *Transaction) addSignatures(sigs [][]byte) error {
+	hash := tx.SigningHash()
+	all := append(append([][]byte{}, tx.Signatures...), sigs...)
+	idx, err := tx.Multisig.signers(hash, all)
+	if err != nil {
+		return err
+	}
+	bySigner := make(map[int][]byte, len(all))
+	for i, sig := range all {
+		bySigner[idx[i]] = sig
+	}
+	tx.Signatures = tx.Signatures[:0]
+	for i := range tx.Multisig.PubKeys {
+		if sig, ok := bySigner[i]; ok {
+			tx.Signatures = append(tx.Signatures, sig)
+		}
+	}
+	return nil
+}
+
+// CombineSignatures merges copies of a multisig transaction signed by
+// different owners into one carrying all their signatures.
+func CombineSignatures(txs ...*Transaction) (*Transaction, error) {
+	if len(txs) == 0 {
+		return nil, fmt.Errorf("no transactions to combine")
+	}
+	first := txs[0]
+	if first.Multisig == nil {
+		return nil, fmt.Errorf("not a multisig transaction")
+	}
+	out := *first
+	out.Signatures = nil
+	hash := first.SigningHash()
+	for i, tx := range txs {
+		if tx.Multisig == nil || !bytes.Equal(tx.SigningHash(), hash) || tx.Multisig.Address() != first.Multisig.Address() {
+			return nil, fmt.Errorf("transaction %d differs from the first", i)
+		}
+		if err := out.addSignatures(tx.Signatures); err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
+		}
+	}
+	return &out, nil
+}
+
+// verifyMultisig checks that tx is signed by enough keys of its multisig
+// and that the multisig is the sender.
+func (tx *Transaction) verifyMultisig() error {
+	m := tx.Multisig
+	if len(tx.Signatures) > len(m.PubKeys) {
+		return fmt.Errorf("%d signatures for %d multisig keys", len(tx.Signatures), len(m.PubKeys))
+	}
+	if addr := m.Address().Hex(); addr != tx.From {
+		return fmt.Errorf("multisig address %s is not the sender %s", addr, tx.From)
+	}
+	idx, err := m.signers(tx.SigningHash(), tx.Signatures)
+	if err != nil {
+		return err
+	}
+	for i := 1; i < len(idx); i++ {
+		if idx[i] <= idx[i-1] {
+			return fmt.Errorf("multisig signatures are not in key order or repeat a signer")
+		}
+	}
+	if uint64(len(idx)) < m.Threshold {
+		return fmt.Errorf("%d of %d required multisig signatures", len(idx), m.Threshold)
+	}
+	return nil
+}
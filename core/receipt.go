@@ -0,0 +1,103 @@
+package core
+
+import "github.com/rockandcode4/graphene-proto/codec"
+
+// Log event types.
+const (
+	EventTransfer  = "Transfer"
+	EventStaked    = "Staked"
+	EventDelegated = "Delegated"
+	// EventUndelegated is emitted when stake starts unbonding, by its owner
+	// or by a validator reducing its own stake.
+	EventUndelegated = "Undelegated"
+	// EventSlashed is reserved for slashing, which is not implemented yet.
+	EventSlashed = "Slashed"
+)
+
+// Topic is an indexed field of a log: an address and its role in the
+// event, such as "from" or "validator".
+type Topic struct {
+	Name  string
+	Value string
+}
+
+// Log is an event emitted by a transaction. Logs can be looked up by any
+// of their topics.
+type Log struct {
+	Event  string
+	Topics []Topic
+	Amount uint64
+}
+
+// Receipt is the outcome of executing a transaction. Fee is what the sender
+// paid: Burned is the base fee part, Tip the part owed to the proposer. A
+// failed transaction still pays its fee but emits no logs.
+type Receipt struct {
+	TxHash  []byte
+	Success bool
+	Error   string
+	GasUsed uint64
+	Fee     uint64
+	Burned  uint64
+	Tip     uint64
+	Logs    []Log
+}
+
+// Topic returns the value of the named topic, or "" if l has none.
+func (l *Log) Topic(name string) string {
+	for _, t := range l.Topics {
+		if t.Name == name {
+			return t.Value
+		}
+	}
+	return ""
+}
+
+// HasAddress reports whether addr is one of l's topics.
+func (l *Log) HasAddress(addr string) bool {
+	for _, t := range l.Topics {
+		if t.Value == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// txLogs returns the logs of a successful tx.
+func txLogs(tx *Transaction) []Log {
+	switch tx.Type {
+	case TxTransfer:
+		return []Log{{Event: EventTransfer, Topics: []Topic{{"from", tx.From}, {"to", tx.To}}, Amount: tx.Amount}}
+	case TxStake:
+		return []Log{{Event: EventStaked, Topics: []Topic{{"validator", tx.From}}, Amount: tx.Amount}}
+	case TxDelegate:
+		return []Log{{Event: EventDelegated, Topics: []Topic{{"delegator", tx.From}, {"validator", tx.Validator}}, Amount: tx.Amount}}
+	case TxUndelegate:
+		return []Log{{Event: EventUndelegated, Topics: []Topic{{"delegator", tx.From}, {"validator", tx.Validator}}, Amount: tx.Amount}}
+	}
+	return nil
+}
+
+// EncodeReceipt returns the binary encoding of r that the receipts root
+// commits to.
+func EncodeReceipt(r *Receipt) []byte {
+	var w codec.Writer
+	w.Bytes(r.TxHash)
+	w.Bool(r.Success)
+	w.String(r.Error)
+	w.Uint(r.GasUsed)
+	w.Uint(r.Fee)
+	w.Uint(r.Burned)
+	w.Uint(r.Tip)
+	w.Uint(uint64(len(r.Logs)))
+	for _, l := range r.Logs {
+		w.String(l.Event)
+		w.Uint(uint64(len(l.Topics)))
+		for _, t := range l.Topics {
+			w.String(t.Name)
+			w.String(t.Value)
+		}
+		w.Uint(l.Amount)
+	}
+	return w.Out()
+}
@@ -0,0 +1,194 @@
+package core
+
+import "math/bits"
+
+// UnbondingBlocks is how many blocks undelegated stake stays locked before
+// it returns to the balance of its owner.
+const UnbondingBlocks = 200
+
+// RewardInterval is how often, in blocks, pending staking rewards are paid
+// out to balances: once an epoch.
+const RewardInterval = 100
+
+// bond adds amount to addr's own stake and activates it as a validator. A
+// validator that stakes again keeps its stake and delegations.
+func bond(st State, addr string, amount uint64) error {
+	v, err := st.GetValidator(addr)
+	if err != nil {
+		return err
+	}
+	v.Stake += amount
+	v.SelfStake += amount
+	v.Active = true
+	return st.PutValidator(v)
+}
+
+// delegate adds amount to delegator's delegation to validator. Delegating
+// to an address that has not staked creates an inactive validator, which
+// becomes active once it stakes itself.
+func delegate(st State, delegator, validator string, amount uint64) error {
+	d, err := st.GetDelegation(validator, delegator)
+	if err != nil {
+		return err
+	}
+	d.Amount += amount
+	if err := st.PutDelegation(d); err != nil {
+		return err
+	}
+	v, err := st.GetValidator(validator)
+	if err != nil {
+		return err
+	}
+	v.Stake += amount
+	return st.PutValidator(v)
+}
+
+// bondedBy returns the stake delegator has bonded to validator: its own
+// stake if delegator is the validator, its delegation otherwise.
+func bondedBy(st State, delegator, validator string) (uint64, error) {
+	if delegator == validator {
+		v, err := st.GetValidator(validator)
+		if err != nil {
+			return 0, err
+		}
+		return v.SelfStake, nil
+	}
+	d, err := st.GetDelegation(validator, delegator)
+	if err != nil {
+		return 0, err
+	}
+	return d.Amount, nil
+}
+
+// undelegate moves amount of the stake delegator has bonded to validator
+// into unbonding until block release. A validator left without own stake
+// is deactivated; delegations to it stay until they are undelegated. The
+// caller checks that the stake is there, see bondedBy.
+func undelegate(st State, delegator, validator string, amount, release uint64) error {
+	v, err := st.GetValidator(validator)
+	if err != nil {
+		return err
+	}
+	if delegator == validator {
+		v.SelfStake -= amount
+		v.Active = v.SelfStake > 0
+	} else {
+		d, err := st.GetDelegation(validator, delegator)
+		if err != nil {
+			return err
+		}
+		d.Amount -= amount
+		if err := st.PutDelegation(d); err != nil {
+			return err
+		}
+	}
+	v.Stake -= amount
+	if err := st.PutValidator(v); err != nil {
+		return err
+	}
+	u, err := st.GetUnbonding(release, delegator, validator)
+	if err != nil {
+		return err
+	}
+	u.Amount += amount
+	return st.PutUnbonding(u)
+}
+
+// EndBlock finishes block height once its transactions have run: it pays
+// the tips of the block to its proposer, returns the stake whose unbonding
+// completes at height and, every RewardInterval blocks, pays out the
+// pending rewards.
+//
+// An active validator shares the tips of the blocks it proposes with its
+// delegators, pro rata to their stake, as pending rewards, and keeps the
+// rest as its own. Any other proposer is paid at once.
+func EndBlock(st State, height uint64, proposer string, tips uint64) error {
+	if err := payTips(st, proposer, tips); err != nil {
+		return err
+	}
+	unbonded, err := st.Unbondings(height)
+	if err != nil {
+		return err
+	}
+	for _, u := range unbonded {
+		if err := credit(st, u.Delegator, u.Amount); err != nil {
+			return err
+		}
+		u.Amount = 0
+		if err := st.PutUnbonding(u); err != nil {
+			return err
+		}
+	}
+	if height%RewardInterval != 0 {
+		return nil
+	}
+	rewards, err := st.Rewards("")
+	if err != nil {
+		return err
+	}
+	for _, r := range rewards {
+		if err := credit(st, r.Address, r.Amount); err != nil {
+			return err
+		}
+		r.Amount = 0
+		if err := st.PutReward(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func payTips(st State, proposer string, tips uint64) error {
+	if tips == 0 {
+		return nil
+	}
+	v, err := st.GetValidator(proposer)
+	if err != nil {
+		return err
+	}
+	if !v.Active {
+		return credit(st, proposer, tips)
+	}
+	dels, err := st.Delegations(proposer)
+	if err != nil {
+		return err
+	}
+	left := tips
+	for _, d := range dels {
+		share := mulDiv(tips, d.Amount, v.Stake)
+		if share == 0 {
+			continue
+		}
+		if err := addReward(st, d.Delegator, proposer, share); err != nil {
+			return err
+		}
+		left -= share
+	}
+	return addReward(st, proposer, proposer, left)
+}
+
+func addReward(st State, addr, validator string, amount uint64) error {
+	r, err := st.GetReward(addr, validator)
+	if err != nil {
+		return err
+	}
+	r.Amount += amount
+	return st.PutReward(r)
+}
+
+func credit(st State, addr string, amount uint64) error {
+	acct, err := st.GetAccount(addr)
+	if err != nil {
+		return err
+	}
+	acct.Balance += amount
+	return st.PutAccount(acct)
+}
+
+// mulDiv returns a*b/c rounded down. b must not exceed c, so the result
+// fits.
+func mulDiv(a, b, c uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	q, _ := bits.Div64(hi, lo, c)
+	return q
+}
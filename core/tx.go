@@ -0,0 +1,223 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/rockandcode4/graphene-proto/codec"
+)
+
+const (
+	TxTransfer   = "transfer"
+	TxStake      = "stake"
+	TxDelegate   = "delegate"
+	TxUndelegate = "undelegate"
+)
+
+// MaxTxSize bounds the encoded size of a single transaction.
+const MaxTxSize = 16 << 10
+
+// Transaction is a signed state transition. The signature is a recoverable
+// secp256k1 signature over SigningHash, so the sender's public key does not
+// need to be carried separately. A transaction from a multisig account
+// carries the account's Multisig and the Signatures of its owners instead.
+type Transaction struct {
+	Type      string `json:"type"`
+	From      string `json:"from"`
+	To        string `json:"to,omitempty"`
+	Validator string `json:"validator,omitempty"` // target of "delegate" and "undelegate"
+	Amount    uint64 `json:"amount"`
+	Nonce     uint64 `json:"nonce"`
+	// MaxFee is the most the sender pays per unit of gas, base fee and tip
+	// together; Tip is the part of it offered to the block proposer.
+	MaxFee    uint64 `json:"max_fee"`
+	Tip       uint64 `json:"tip"`
+	Signature []byte `json:"signature,omitempty"`
+
+	Multisig   *Multisig `json:"multisig,omitempty"`
+	Signatures [][]byte  `json:"signatures,omitempty"` // in the order of Multisig.PubKeys
+}
+
+// SigningHash is the digest the sender signs: the encoding of the
+// transaction without its signature.
+func (tx *Transaction) SigningHash() []byte {
+	var w codec.Writer
+	tx.encodeFields(&w)
+	sum := sha256.Sum256(w.Out())
+	return sum[:]
+}
+
+// Hash identifies the transaction, signature included.
+func (tx *Transaction) Hash() []byte {
+	sum := sha256.Sum256(EncodeTx(tx))
+	return sum[:]
+}
+
+func (tx *Transaction) HashHex() string {
+	return hex.EncodeToString(tx.Hash())
+}
+
+func (tx *Transaction) Sign(priv *ecdsa.PrivateKey) error {
+	sig, err := crypto.Sign(tx.SigningHash(), priv)
+	if err != nil {
+		return err
+	}
+	tx.Signature = sig
+	return nil
+}
+
+// SenderPubKey recovers the public key that produced the signature. Multisig
+// transactions have no single sender key.
+func (tx *Transaction) SenderPubKey() (*ecdsa.PublicKey, error) {
+	if tx.Multisig != nil {
+		return nil, fmt.Errorf("multisig transaction has no single signer")
+	}
+	if len(tx.Signature) != crypto.SignatureLength {
+		return nil, fmt.Errorf("missing or malformed signature")
+	}
+	return crypto.SigToPub(tx.SigningHash(), tx.Signature)
+}
+
+// VerifySignature checks that the transaction carries a valid signature
+// by the key of its sender, or enough signatures by the keys of its
+// multisig sender.
+func (tx *Transaction) VerifySignature() error {
+	if tx.Multisig != nil {
+		return tx.verifyMultisig()
+	}
+	pub, err := tx.SenderPubKey()
+	if err != nil {
+		return err
+	}
+	if !crypto.VerifySignature(crypto.FromECDSAPub(pub), tx.SigningHash(), tx.Signature[:64]) {
+		return fmt.Errorf("invalid signature")
+	}
+	if signer := PubKeyToAddress(pub).Hex(); signer != tx.From {
+		return fmt.Errorf("signed by %s, not by the sender %s", signer, tx.From)
+	}
+	return nil
+}
+
+// ValidateBasic performs stateless checks on the transaction fields.
+func (tx *Transaction) ValidateBasic() error {
+	if err := ValidateAddress(tx.From); err != nil {
+		return fmt.Errorf("sender: %w", err)
+	}
+	if tx.Amount == 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	if tx.Multisig != nil {
+		if err := tx.Multisig.Validate(); err != nil {
+			return err
+		}
+		if len(tx.Signature) != 0 {
+			return fmt.Errorf("multisig transaction with a single signature")
+		}
+	} else if len(tx.Signatures) != 0 {
+		return fmt.Errorf("multisig signatures without a multisig")
+	}
+	if tx.Tip > tx.MaxFee {
+		return fmt.Errorf("tip %d exceeds max fee %d", tx.Tip, tx.MaxFee)
+	}
+	switch tx.Type {
+	case TxTransfer:
+		if tx.To == "" {
+			return fmt.Errorf("transfer without recipient")
+		}
+		if err := ValidateAddress(tx.To); err != nil {
+			return fmt.Errorf("recipient: %w", err)
+		}
+	case TxStake:
+	case TxDelegate, TxUndelegate:
+		if tx.Validator == "" {
+			return fmt.Errorf("%s without validator", tx.Type)
+		}
+		if err := ValidateAddress(tx.Validator); err != nil {
+			return fmt.Errorf("validator: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown tx type %q", tx.Type)
+	}
+	return nil
+}
+
+// Value is what tx takes from the sender's balance besides its fee: the
+// amount, except for undelegate, whose amount comes out of bonded stake.
+func (tx *Transaction) Value() uint64 {
+	if tx.Type == TxUndelegate {
+		return 0
+	}
+	return tx.Amount
+}
+
+func (tx *Transaction) encodeFields(w *codec.Writer) {
+	w.String(tx.Type)
+	w.String(tx.From)
+	w.String(tx.To)
+	w.String(tx.Validator)
+	w.Uint(tx.Amount)
+	w.Uint(tx.Nonce)
+	w.Uint(tx.MaxFee)
+	w.Uint(tx.Tip)
+}
+
+// EncodeTx returns the canonical binary encoding used on the wire, in blocks
+// and for hashing. The multisig part is only present for multisig
+// transactions, so other transactions encode as before it existed.
+func EncodeTx(tx *Transaction) []byte {
+	var w codec.Writer
+	tx.encodeFields(&w)
+	w.Bytes(tx.Signature)
+	if tx.Multisig != nil {
+		w.Uint(tx.Multisig.Threshold)
+		w.BytesList(tx.Multisig.PubKeys)
+		w.BytesList(tx.Signatures)
+	}
+	return w.Out()
+}
+
+func DecodeTx(bz []byte) (*Transaction, error) {
+	if len(bz) > MaxTxSize {
+		return nil, fmt.Errorf("transaction of %d bytes exceeds limit", len(bz))
+	}
+	r := codec.NewReader(bz)
+	tx := &Transaction{
+		Type:      r.String(),
+		From:      r.String(),
+		To:        r.String(),
+		Validator: r.String(),
+		Amount:    r.Uint(),
+		Nonce:     r.Uint(),
+		MaxFee:    r.Uint(),
+		Tip:       r.Uint(),
+		Signature: r.Bytes(),
+	}
+	if r.Len() > 0 {
+		tx.Multisig = &Multisig{Threshold: r.Uint(), PubKeys: r.BytesList()}
+		tx.Signatures = r.BytesList()
+	}
+	if err := r.Done(); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// CheckTx decodes a transaction and runs all stateless checks, including the
+// signature.
+func CheckTx(bz []byte) (*Transaction, error) {
+	tx, err := DecodeTx(bz)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.ValidateBasic(); err != nil {
+		return nil, err
+	}
+	if err := tx.VerifySignature(); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
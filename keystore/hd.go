@@ -0,0 +1,122 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// DefaultHDPath is the BIP-44 path of the first account key. It uses coin
+// type 60, as Ethereum does, so a mnemonic yields the same keys here as in
+// Ethereum wallets.
+const DefaultHDPath = "m/44'/60'/0'/0/0"
+
+// ErrInvalidMnemonic is returned for a phrase with unknown words or a bad
+// checksum.
+var ErrInvalidMnemonic = errors.New("keystore: invalid mnemonic")
+
+// HDPath returns the BIP-44 path of the account key with the given index,
+// m/44'/60'/0'/0/index.
+func HDPath(index uint32) string {
+	return fmt.Sprintf("m/44'/60'/0'/0/%d", index)
+}
+
+// NewMnemonic returns a new random BIP-39 phrase of 12 or 24 English words.
+func NewMnemonic(words int) (string, error) {
+	if words != 12 && words != 24 {
+		return "", fmt.Errorf("keystore: mnemonic must have 12 or 24 words, not %d", words)
+	}
+	entropy, err := bip39.NewEntropy(words * 32 / 3)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// NormalizeMnemonic lowercases a phrase and collapses its whitespace.
+func NormalizeMnemonic(mnemonic string) string {
+	return strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+}
+
+// ValidateMnemonic checks the words and checksum of a BIP-39 phrase.
+func ValidateMnemonic(mnemonic string) error {
+	if !bip39.IsMnemonicValid(NormalizeMnemonic(mnemonic)) {
+		return ErrInvalidMnemonic
+	}
+	return nil
+}
+
+// DeriveKey returns the key at path (such as DefaultHDPath) in the BIP-32
+// tree seeded by a BIP-39 mnemonic and optional BIP-39 passphrase.
+func DeriveKey(mnemonic, passphrase, path string) (*ecdsa.PrivateKey, error) {
+	dp, err := accounts.ParseDerivationPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	seed, err := bip39.NewSeedWithErrorChecking(NormalizeMnemonic(mnemonic), passphrase)
+	if err != nil {
+		return nil, ErrInvalidMnemonic
+	}
+	k, chain, err := masterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range dp {
+		if k, chain, err = childKey(k, chain, i); err != nil {
+			return nil, err
+		}
+	}
+	return crypto.ToECDSA(k)
+}
+
+// masterKey derives the BIP-32 master key and chain code from a seed.
+func masterKey(seed []byte) (key, chain []byte, err error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	if k := new(big.Int).SetBytes(sum[:32]); k.Sign() == 0 || k.Cmp(crypto.S256().Params().N) >= 0 {
+		return nil, nil, errors.New("keystore: unusable seed")
+	}
+	return sum[:32], sum[32:], nil
+}
+
+// childKey derives private child i of a BIP-32 key. Indices from 2^31 up
+// are hardened.
+func childKey(key, chain []byte, i uint32) ([]byte, []byte, error) {
+	var data []byte
+	if i >= 0x80000000 {
+		data = append([]byte{0}, key...)
+	} else {
+		priv, err := crypto.ToECDSA(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = crypto.CompressPubkey(&priv.PublicKey)
+	}
+	data = binary.BigEndian.AppendUint32(data, i)
+
+	mac := hmac.New(sha512.New, chain)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	n := crypto.S256().Params().N
+	il := new(big.Int).SetBytes(sum[:32])
+	if il.Cmp(n) >= 0 {
+		return nil, nil, fmt.Errorf("keystore: invalid child key %d, use the next index", i)
+	}
+	k := il.Add(il, new(big.Int).SetBytes(key))
+	k.Mod(k, n)
+	if k.Sign() == 0 {
+		return nil, nil, fmt.Errorf("keystore: invalid child key %d, use the next index", i)
+	}
+	return k.FillBytes(make([]byte, 32)), sum[32:], nil
+}
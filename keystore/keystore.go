@@ -0,0 +1,266 @@
+// Package keystore stores secp256k1 keys encrypted with a passphrase. Key
+// files use the Ethereum keystore v3 format (scrypt and AES-128-CTR), so
+// other tools can read them, plus the name of the key.
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	gethks "github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/rockandcode4/graphene-proto/core"
+)
+
+// Scrypt parameters. The light ones unlock much faster and are meant for
+// tests and throwaway keys.
+const (
+	StandardScryptN = gethks.StandardScryptN
+	StandardScryptP = gethks.StandardScryptP
+	LightScryptN    = gethks.LightScryptN
+	LightScryptP    = gethks.LightScryptP
+)
+
+var (
+	ErrNotFound = errors.New("keystore: key not found")
+	ErrExists   = errors.New("keystore: key already exists")
+	// ErrDecrypt is returned for a wrong passphrase.
+	ErrDecrypt = errors.New("keystore: wrong passphrase")
+)
+
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Key is an unlocked key. Address is the account it signs for, which is
+// derived from the key; Decrypt fills it in.
+type Key struct {
+	Name       string
+	Address    string
+	PrivateKey *ecdsa.PrivateKey
+}
+
+// Info describes a stored key without unlocking it.
+type Info struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	PubKey  string `json:"pub_key"` // compressed, hex
+}
+
+// keyJSON is a v3 key file. Name and PubKey are ours; other readers ignore
+// them. Account was the chain address of the key when it could be set
+// freely; it is no longer written or read.
+type keyJSON struct {
+	Version    int               `json:"version"`
+	ID         string            `json:"id"`
+	EthAddress string            `json:"address"`
+	Crypto     gethks.CryptoJSON `json:"crypto"`
+
+	Name   string `json:"name,omitempty"`
+	PubKey string `json:"pub_key,omitempty"`
+}
+
+// Info returns the public part of k.
+func (k *Key) Info() *Info {
+	return &Info{
+		Name:    k.Name,
+		Address: core.PubKeyToAddress(&k.PrivateKey.PublicKey).Hex(),
+		PubKey:  hex.EncodeToString(crypto.CompressPubkey(&k.PrivateKey.PublicKey)),
+	}
+}
+
+// Encrypt returns k as a key file locked with passphrase.
+func Encrypt(k *Key, passphrase string, scryptN, scryptP int) ([]byte, error) {
+	cj, err := gethks.EncryptDataV3(crypto.FromECDSA(k.PrivateKey), []byte(passphrase), scryptN, scryptP)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	info := k.Info()
+	return json.MarshalIndent(keyJSON{
+		Version:    3,
+		ID:         id,
+		EthAddress: hex.EncodeToString(crypto.PubkeyToAddress(k.PrivateKey.PublicKey).Bytes()),
+		Crypto:     cj,
+		Name:       k.Name,
+		PubKey:     info.PubKey,
+	}, "", "  ")
+}
+
+// Decrypt unlocks a key file.
+func Decrypt(bz []byte, passphrase string) (*Key, error) {
+	var kj keyJSON
+	if err := json.Unmarshal(bz, &kj); err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	if kj.Version != 3 {
+		return nil, fmt.Errorf("keystore: unsupported version %d", kj.Version)
+	}
+	raw, err := gethks.DecryptDataV3(kj.Crypto, passphrase)
+	if errors.Is(err, gethks.ErrDecrypt) {
+		return nil, ErrDecrypt
+	}
+	if err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	priv, err := crypto.ToECDSA(raw)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	return &Key{Name: kj.Name, Address: core.PubKeyToAddress(&priv.PublicKey).Hex(), PrivateKey: priv}, nil
+}
+
+// ReadKeyFile unlocks the key file at path.
+func ReadKeyFile(path, passphrase string) (*Key, error) {
+	bz, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	k, err := Decrypt(bz, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return k, nil
+}
+
+// WriteKeyFile writes k to path, locked with passphrase. It does not
+// overwrite an existing file.
+func WriteKeyFile(path string, k *Key, passphrase string, scryptN, scryptP int) error {
+	bz, err := Encrypt(k, passphrase, scryptN, scryptP)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if os.IsExist(err) {
+		return fmt.Errorf("%s: %w", path, ErrExists)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(bz, '\n')); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// Store is a directory of key files, one per key name.
+type Store struct {
+	dir string
+	// ScryptN and ScryptP are used for newly saved keys.
+	ScryptN int
+	ScryptP int
+}
+
+// NewStore returns the store in dir, which is created on first save.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir, ScryptN: StandardScryptN, ScryptP: StandardScryptP}
+}
+
+func (s *Store) path(name string) (string, error) {
+	if !nameRe.MatchString(name) {
+		return "", fmt.Errorf("keystore: invalid key name %q", name)
+	}
+	return filepath.Join(s.dir, name+".json"), nil
+}
+
+// Save stores k under k.Name, locked with passphrase.
+func (s *Store) Save(k *Key, passphrase string) error {
+	path, err := s.path(k.Name)
+	if err != nil {
+		return err
+	}
+	err = WriteKeyFile(path, k, passphrase, s.ScryptN, s.ScryptP)
+	if errors.Is(err, ErrExists) {
+		return fmt.Errorf("%w: %s", ErrExists, k.Name)
+	}
+	return err
+}
+
+// Load unlocks the key called name.
+func (s *Store) Load(name, passphrase string) (*Key, error) {
+	bz, err := s.read(name)
+	if err != nil {
+		return nil, err
+	}
+	k, err := Decrypt(bz, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	k.Name = name
+	return k, nil
+}
+
+// Info describes the key called name without unlocking it.
+func (s *Store) Info(name string) (*Info, error) {
+	bz, err := s.read(name)
+	if err != nil {
+		return nil, err
+	}
+	var kj keyJSON
+	if err := json.Unmarshal(bz, &kj); err != nil {
+		return nil, fmt.Errorf("keystore: %s: %w", name, err)
+	}
+	return &Info{Name: name, Address: common.HexToAddress(kj.EthAddress).Hex(), PubKey: kj.PubKey}, nil
+}
+
+// List describes every key, by name.
+func (s *Store) List() ([]*Info, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	out := []*Info{}
+	for _, p := range paths {
+		name := strings.TrimSuffix(filepath.Base(p), ".json")
+		if !nameRe.MatchString(name) {
+			continue
+		}
+		info, err := s.Info(name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+func (s *Store) read(name string) ([]byte, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	bz, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return bz, err
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,113 @@
+package keystore
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/term"
+)
+
+// stdin is shared by the prompts so that lines piped in for several of
+// them are not lost to a reader's buffer. It is only used when stdin is not
+// a terminal.
+var stdin = bufio.NewReader(os.Stdin)
+
+// ReadPassphrase returns the first line of file or, if file is empty,
+// prompts for a passphrase without echoing it. With confirm, a prompted
+// passphrase must be entered twice and may not be empty, as when locking
+// a new key.
+func ReadPassphrase(file, prompt string, confirm bool) (string, error) {
+	if file != "" {
+		bz, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("passphrase file: %w", err)
+		}
+		line, _, _ := strings.Cut(string(bz), "\n")
+		return strings.TrimRight(line, "\r"), nil
+	}
+	pass, err := promptLine(prompt)
+	if err != nil || !confirm {
+		return pass, err
+	}
+	if pass == "" {
+		return "", errors.New("empty passphrase")
+	}
+	again, err := promptLine("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if again != pass {
+		return "", errors.New("passphrases do not match")
+	}
+	return pass, nil
+}
+
+// ReadMnemonic returns the BIP-39 phrase in file or, if file is empty,
+// prompts for it, and checks it.
+func ReadMnemonic(file string) (string, error) {
+	var (
+		m   string
+		err error
+	)
+	if file != "" {
+		var bz []byte
+		if bz, err = os.ReadFile(file); err != nil {
+			return "", fmt.Errorf("mnemonic file: %w", err)
+		}
+		m = string(bz)
+	} else if m, err = promptLine("Mnemonic: "); err != nil {
+		return "", err
+	}
+	m = NormalizeMnemonic(m)
+	if err := ValidateMnemonic(m); err != nil {
+		return "", err
+	}
+	return m, nil
+}
+
+// ReadPrivateKey returns the hex private key in file or, if file is empty,
+// prompts for it without echoing it.
+func ReadPrivateKey(file string) (*ecdsa.PrivateKey, error) {
+	var (
+		s   string
+		err error
+	)
+	if file != "" {
+		var bz []byte
+		if bz, err = os.ReadFile(file); err != nil {
+			return nil, fmt.Errorf("key file: %w", err)
+		}
+		s = string(bz)
+	} else if s, err = promptLine("Private key (hex): "); err != nil {
+		return nil, err
+	}
+	priv, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return priv, nil
+}
+
+// promptLine prints prompt to stderr and reads a line from stdin. A
+// terminal does not echo the input; piped input is read line by line.
+func promptLine(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		bz, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("read stdin: %w", err)
+		}
+		return string(bz), nil
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("read stdin: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,383 @@
+// Package mempool holds validated transactions until a proposer includes
+// them in a block.
+package mempool
+
+import (
+	"container/heap"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+// DefaultSize is the default maximum number of pooled transactions.
+const DefaultSize = 10000
+
+const (
+	// MaxNonceGap is how far ahead of its account's nonce a transaction may
+	// be, which also bounds the transactions pooled per sender.
+	MaxNonceGap = 64
+	// MaxTxAge is how long a transaction stays pooled if no block includes
+	// it, for example because its max fee is below the base fee or it waits
+	// for a nonce that never comes.
+	MaxTxAge = time.Hour
+)
+
+var (
+	ErrKnown = errors.New("transaction already in mempool")
+	ErrFull  = errors.New("mempool is full")
+	// ErrUnderpriced is returned for transactions whose max fee is below
+	// the minimum gas price, or that do not pay more than the transaction
+	// they would replace.
+	ErrUnderpriced = errors.New("transaction underpriced")
+	// ErrNonceGap is returned for transactions too far ahead of their
+	// account's nonce.
+	ErrNonceGap = errors.New("nonce too far ahead")
+	// ErrInsufficientFunds is returned when the sender cannot pay the
+	// amount and the maximum fee of a transaction.
+	ErrInsufficientFunds = errors.New("insufficient funds for amount and max fee")
+)
+
+// Accounts is the state transactions are checked against on admission.
+type Accounts interface {
+	GetAccount(addr string) (*state.Account, error)
+}
+
+// entry is a pooled transaction.
+type entry struct {
+	bz     []byte
+	from   string
+	nonce  uint64
+	tip    uint64
+	maxFee uint64
+	added  time.Time
+	seq    uint64 // arrival order
+}
+
+// effectiveTip is the tip per gas e pays in a block with the given base fee.
+func (e *entry) effectiveTip(baseFee uint64) uint64 {
+	tx := core.Transaction{Tip: e.tip, MaxFee: e.maxFee}
+	return tx.EffectiveTip(baseFee)
+}
+
+// Mempool is a bounded set of encoded transactions keyed by hash. Reap
+// returns them by effective tip, each sender's in nonce order. A sender has
+// at most one transaction per nonce; a transaction with a higher tip
+// replaces it.
+type Mempool struct {
+	mu          sync.Mutex
+	max         int
+	minGasPrice uint64
+	accounts    Accounts
+	txs         map[string]*entry
+	order       []string
+	bySender    map[string]map[uint64]string // sender -> nonce -> key
+	seq         uint64
+	onAdd       []func([]byte)
+}
+
+func New(max int) *Mempool {
+	if max <= 0 {
+		max = DefaultSize
+	}
+	return &Mempool{max: max, txs: make(map[string]*entry), bySender: make(map[string]map[uint64]string)}
+}
+
+// Key returns the pool key of an encoded transaction, the same value as
+// core.Transaction.Hash.
+func Key(bz []byte) []byte {
+	sum := sha256.Sum256(bz)
+	return sum[:]
+}
+
+// SetMinGasPrice sets the lowest max fee per gas a transaction must offer
+// to be accepted.
+func (m *Mempool) SetMinGasPrice(price uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.minGasPrice = price
+}
+
+// SetAccounts makes the pool check the nonce and balance of senders
+// against accs.
+func (m *Mempool) SetAccounts(accs Accounts) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accounts = accs
+}
+
+// Add checks bz and adds it to the pool. Transactions whose nonce is used
+// up, that are more than MaxNonceGap ahead or whose sender cannot pay the
+// amount and max fee are rejected. When the pool is full the transaction
+// with the lowest tip makes room for one with a higher tip.
+func (m *Mempool) Add(bz []byte) error {
+	tx, err := core.CheckTx(bz)
+	if err != nil {
+		return err
+	}
+	k := string(Key(bz))
+
+	m.mu.Lock()
+	if err := m.admit(tx, k); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.insert(k, &entry{bz: bz, from: tx.From, nonce: tx.Nonce, tip: tx.Tip, maxFee: tx.MaxFee, added: time.Now()})
+	hooks := m.onAdd
+	m.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn(bz)
+	}
+	return nil
+}
+
+// admit checks tx against the pool and the sender's account and makes room
+// for it, dropping the transaction it replaces or the one it evicts.
+func (m *Mempool) admit(tx *core.Transaction, k string) error {
+	if tx.MaxFee < m.minGasPrice {
+		return fmt.Errorf("%w: max fee %d, minimum gas price %d", ErrUnderpriced, tx.MaxFee, m.minGasPrice)
+	}
+	if _, ok := m.txs[k]; ok {
+		return ErrKnown
+	}
+	if m.accounts != nil {
+		acct, err := m.accounts.GetAccount(tx.From)
+		if err != nil {
+			return err
+		}
+		switch {
+		case tx.Nonce < acct.Nonce:
+			return fmt.Errorf("%w: %d, account nonce is %d", core.ErrNonceTooLow, tx.Nonce, acct.Nonce)
+		case tx.Nonce-acct.Nonce >= MaxNonceGap:
+			return fmt.Errorf("%w: %d, account nonce is %d", ErrNonceGap, tx.Nonce, acct.Nonce)
+		}
+		if cost, ok := maxCost(tx); !ok || acct.Balance < cost {
+			return fmt.Errorf("%w: balance %d", ErrInsufficientFunds, acct.Balance)
+		}
+	}
+	if old, ok := m.bySender[tx.From][tx.Nonce]; ok {
+		if tx.Tip <= m.txs[old].tip {
+			return fmt.Errorf("%w: nonce %d is taken by a transaction with tip %d", ErrUnderpriced, tx.Nonce, m.txs[old].tip)
+		}
+		m.remove(old)
+	}
+	if len(m.txs) < m.max {
+		return nil
+	}
+	cheapest := ""
+	for _, key := range m.order {
+		if cheapest == "" || m.txs[key].tip < m.txs[cheapest].tip {
+			cheapest = key
+		}
+	}
+	if m.txs[cheapest].tip >= tx.Tip {
+		return ErrFull
+	}
+	m.remove(cheapest)
+	return nil
+}
+
+// maxCost is the most tx can take from its sender's balance: its value
+// plus the fee at its max fee per gas.
+func maxCost(tx *core.Transaction) (uint64, bool) {
+	gas := tx.Gas()
+	if tx.MaxFee != 0 && gas > math.MaxUint64/tx.MaxFee {
+		return 0, false
+	}
+	fee := gas * tx.MaxFee
+	if tx.Value() > math.MaxUint64-fee {
+		return 0, false
+	}
+	return fee + tx.Value(), true
+}
+
+func (m *Mempool) insert(k string, e *entry) {
+	m.seq++
+	e.seq = m.seq
+	m.txs[k] = e
+	m.order = append(m.order, k)
+	if m.bySender[e.from] == nil {
+		m.bySender[e.from] = make(map[uint64]string)
+	}
+	m.bySender[e.from][e.nonce] = k
+}
+
+// remove drops one transaction. It is linear in the pool size; Remove
+// drops a whole block in one pass.
+func (m *Mempool) remove(k string) {
+	m.drop(k)
+	m.compact()
+}
+
+// drop deletes k from the maps; compact must follow to fix up the order.
+func (m *Mempool) drop(k string) bool {
+	e, ok := m.txs[k]
+	if !ok {
+		return false
+	}
+	delete(m.txs, k)
+	if nonces := m.bySender[e.from]; nonces[e.nonce] == k {
+		delete(nonces, e.nonce)
+		if len(nonces) == 0 {
+			delete(m.bySender, e.from)
+		}
+	}
+	return true
+}
+
+func (m *Mempool) compact() {
+	order := m.order[:0]
+	for _, k := range m.order {
+		if _, ok := m.txs[k]; ok {
+			order = append(order, k)
+		}
+	}
+	m.order = order
+}
+
+// OnAdd registers fn to be called with every transaction added to the pool.
+// fn runs on the caller's goroutine and must not block.
+func (m *Mempool) OnAdd(fn func(bz []byte)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onAdd = append(m.onAdd, fn)
+}
+
+// Has reports whether the transaction with the given hash is pooled.
+func (m *Mempool) Has(hash []byte) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.txs[string(hash)]
+	return ok
+}
+
+// Get returns the pooled transaction with the given hash.
+func (m *Mempool) Get(hash []byte) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.txs[string(hash)]
+	if !ok {
+		return nil, false
+	}
+	return e.bz, true
+}
+
+// Reap picks transactions for a block with the given base fee, up to
+// maxBytes in total. Senders are taken by the effective tip of their lowest
+// pooled nonce, highest first and in arrival order on ties, and each
+// sender's transactions in nonce order. include is called with every
+// candidate and reports whether the block took it. When it does not, or
+// the transaction pays less than the base fee or does not fit, the sender's
+// later nonces are skipped as well and Reap goes on with the other senders.
+// include runs with the pool locked and must not call into it. The
+// transactions stay in the pool until Remove is called.
+func (m *Mempool) Reap(baseFee uint64, maxBytes int, include func(bz []byte) bool) [][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := &senderHeap{baseFee: baseFee}
+	for _, nonces := range m.bySender {
+		q := make([]*entry, 0, len(nonces))
+		for _, k := range nonces {
+			q = append(q, m.txs[k])
+		}
+		sort.Slice(q, func(i, j int) bool { return q[i].nonce < q[j].nonce })
+		h.queues = append(h.queues, q)
+	}
+	heap.Init(h)
+	out := [][]byte{}
+	size := 0
+	for h.Len() > 0 && size < maxBytes {
+		q := h.queues[0]
+		e := q[0]
+		if e.maxFee < baseFee || size+len(e.bz) > maxBytes || !include(e.bz) {
+			heap.Pop(h)
+			continue
+		}
+		size += len(e.bz)
+		out = append(out, e.bz)
+		if len(q) == 1 {
+			heap.Pop(h)
+			continue
+		}
+		h.queues[0] = q[1:]
+		heap.Fix(h, 0)
+	}
+	return out
+}
+
+// senderHeap orders the nonce-sorted transactions of each sender by the
+// effective tip of the first one, highest first, then by arrival.
+type senderHeap struct {
+	baseFee uint64
+	queues  [][]*entry
+}
+
+func (h *senderHeap) Len() int { return len(h.queues) }
+
+func (h *senderHeap) Less(i, j int) bool {
+	a, b := h.queues[i][0], h.queues[j][0]
+	if ta, tb := a.effectiveTip(h.baseFee), b.effectiveTip(h.baseFee); ta != tb {
+		return ta > tb
+	}
+	return a.seq < b.seq
+}
+
+func (h *senderHeap) Swap(i, j int) { h.queues[i], h.queues[j] = h.queues[j], h.queues[i] }
+
+func (h *senderHeap) Push(x interface{}) { h.queues = append(h.queues, x.([]*entry)) }
+
+func (h *senderHeap) Pop() interface{} {
+	q := h.queues[len(h.queues)-1]
+	h.queues = h.queues[:len(h.queues)-1]
+	return q
+}
+
+// Remove drops the given transactions, typically those of a committed
+// block, along with transactions pooled for longer than MaxTxAge.
+func (m *Mempool) Remove(txs [][]byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := false
+	for _, bz := range txs {
+		if m.drop(string(Key(bz))) {
+			removed = true
+		}
+	}
+	// the order is by arrival, so the expired transactions come first
+	cutoff := time.Now().Add(-MaxTxAge)
+	for _, k := range m.order {
+		e, ok := m.txs[k]
+		if !ok {
+			continue
+		}
+		if !e.added.Before(cutoff) {
+			break
+		}
+		removed = m.drop(k) || removed
+	}
+	if removed {
+		m.compact()
+	}
+}
+
+// ForEach calls fn with the hash and encoding of every pooled transaction.
+func (m *Mempool) ForEach(fn func(hash, tx []byte)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.order {
+		fn([]byte(k), m.txs[k].bz)
+	}
+}
+
+func (m *Mempool) Size() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.txs)
+}
@@ -1,29 +1,155 @@
 package node
 
 import (
-    "encoding/json"
-    "os"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/rpc"
 )
 
 type Config struct {
-    DataDir    string `json:"data_dir"`
-    BindAddr   string `json:"bind_addr"`
-    Bootstrap  []string `json:"bootstrap"`
-    RPCPort    int    `json:"rpc_port"`
-    Genesis    string `json:"genesis_json"`
-    NodeKeyHex string `json:"node_key_hex"`
+	DataDir   string   `json:"data_dir"`
+	BindAddr  string   `json:"bind_addr"`
+	Bootstrap []string `json:"bootstrap"`
+	RPCPort   int      `json:"rpc_port"`
+	// RPCHost is the interface the RPC server listens on; empty means all.
+	RPCHost    string `json:"rpc_host"`
+	Genesis    string `json:"genesis_json"`
+	NodeKeyHex string `json:"node_key_hex"`
+	ChainID    string `json:"chain_id"`
+	// EthChainID is the numeric id reported by eth_chainId; 0 derives it
+	// from ChainID.
+	EthChainID uint64 `json:"eth_chain_id"`
+	// WebSocket subscription limits: open connections and subscriptions
+	// per connection.
+	WSMaxConnections   int `json:"ws_max_connections"`
+	WSMaxSubscriptions int `json:"ws_max_subscriptions"`
+
+	// RPC access control. Requests must carry one of RPCAPIKeys or a JWT
+	// signed with the hex secret in RPCJWTSecretFile when either is set.
+	// RPCNamespaces sets "public", "local" or "off" per namespace
+	// (graphene, admin, eth, ws); RPCTLSCert/Key enable HTTPS.
+	RPCAPIKeys       []string          `json:"rpc_api_keys"`
+	RPCJWTSecretFile string            `json:"rpc_jwt_secret_file"`
+	RPCCORSOrigins   []string          `json:"rpc_cors_origins"`
+	RPCNamespaces    map[string]string `json:"rpc_namespaces"`
+	RPCTLSCert       string            `json:"rpc_tls_cert"`
+	RPCTLSKey        string            `json:"rpc_tls_key"`
+
+	// RPC request limits. RPCRateLimit is calls per second per client IP
+	// (0 disables it) with bursts of RPCRateBurst; each call in a batch
+	// counts. RPCMaxConcurrent caps in-flight calls per method, with
+	// per-method overrides in RPCMethodConcurrency.
+	RPCRateLimit         float64        `json:"rpc_rate_limit"`
+	RPCRateBurst         int            `json:"rpc_rate_burst"`
+	RPCMaxBodyBytes      int64          `json:"rpc_max_body_bytes"`
+	RPCRequestTimeout    int            `json:"rpc_request_timeout"` // seconds
+	RPCMaxConcurrent     int            `json:"rpc_max_concurrent"`
+	RPCMethodConcurrency map[string]int `json:"rpc_method_concurrency"`
+	RPCMaxBatchSize      int            `json:"rpc_max_batch_size"`
+
+	// Peer discovery: mDNS on the local network and/or a Kademlia DHT
+	// rendezvous on the chain ID, dialing until TargetPeers are connected.
+	MDNS        bool `json:"mdns"`
+	DHT         bool `json:"dht"`
+	TargetPeers int  `json:"target_peers"`
+
+	// Connection limits and access control. Persistent peers (multiaddrs)
+	// are redialed on disconnect and exempt from the limits; allow/deny
+	// entries are peer IDs, IPs or CIDR ranges.
+	MaxInboundPeers  int      `json:"max_inbound_peers"`
+	MaxOutboundPeers int      `json:"max_outbound_peers"`
+	PersistentPeers  []string `json:"persistent_peers"`
+	AllowPeers       []string `json:"allow_peers"`
+	DenyPeers        []string `json:"deny_peers"`
+
+	// NAT traversal (all opt-in): gateway port mapping, serving AutoNAT to
+	// peers, hole punching, acting as a circuit relay, and static relays to
+	// reserve a slot on when this node is not reachable. ExternalAddrs are
+	// advertised in addition to the listen address; Reachability
+	// ("public", "private", "auto") overrides AutoNAT.
+	NATPortMap    bool     `json:"nat_port_map"`
+	AutoNAT       bool     `json:"autonat"`
+	HolePunching  bool     `json:"hole_punching"`
+	RelayService  bool     `json:"relay_service"`
+	Relays        []string `json:"relays"`
+	ExternalAddrs []string `json:"external_addrs"`
+	Reachability  string   `json:"reachability"`
+
+	// Sentry architecture. A validator sets PrivateMode and lists its
+	// sentries in PersistentPeers: it then dials only the sentries, refuses
+	// everyone else and runs no discovery. Sentries list the validator's
+	// peer ID in PrivatePeers so it is always admitted and never revealed.
+	PrivateMode  bool     `json:"private_mode"`
+	PrivatePeers []string `json:"private_peers"`
+
+	// ValidatorKeyFile is the encrypted key (see gfn keys and tools/keygen)
+	// of the validator this node proposes blocks for. It is unlocked with
+	// the first line of ValidatorPassphraseFile, or a passphrase prompted
+	// for on startup. Without it the node proposes only until there are
+	// validators, since blocks in a validator's slot must carry its
+	// signature.
+	ValidatorKeyFile        string `json:"validator_key_file"`
+	ValidatorPassphraseFile string `json:"validator_passphrase_file"`
+
+	// P2PCompression snappy-compresses gossip payloads.
+	P2PCompression bool `json:"p2p_compression"`
+	// MempoolSize is the maximum number of pending transactions.
+	MempoolSize int `json:"mempool_size"`
+	// MinGasPrice is the lowest max fee per gas the mempool accepts; it is
+	// never below the chain's min_base_fee.
+	MinGasPrice uint64 `json:"min_gas_price"`
+
+	// Consensus parameters; every node of a chain must use the same values.
+	BlockGasLimit uint64 `json:"block_gas_limit"`
+	MinBaseFee    uint64 `json:"min_base_fee"`
+
+	// SnapshotInterval is the number of epochs between state snapshots; 0 disables them.
+	SnapshotInterval   uint64 `json:"snapshot_interval"`
+	SnapshotKeepRecent int    `json:"snapshot_keep_recent"`
+	// FastSync restores state from a peer snapshot on startup instead of replaying every block.
+	FastSync    bool   `json:"fast_sync"`
+	TrustedHash string `json:"trusted_hash"` // hex block hash the fast-sync snapshot must match
 }
 
 func DefaultConfig() *Config {
-    return &Config{
-        DataDir:  "./data",
-        BindAddr: "/ip4/127.0.0.1/tcp/0",
-        RPCPort:  8545,
-    }
+	return &Config{
+		DataDir:  "./data",
+		BindAddr: "/ip4/127.0.0.1/tcp/0",
+		RPCPort:  8545,
+		RPCHost:  "127.0.0.1",
+		ChainID:  "graphene-local",
+
+		WSMaxConnections:   rpc.DefaultWSMaxConnections,
+		WSMaxSubscriptions: rpc.DefaultWSMaxSubscriptions,
+
+		RPCRateLimit:      50,
+		RPCRateBurst:      100,
+		RPCMaxBodyBytes:   rpc.DefaultMaxBodyBytes,
+		RPCRequestTimeout: int(rpc.DefaultRequestTimeout / time.Second),
+		RPCMaxConcurrent:  rpc.DefaultMaxConcurrent,
+		RPCMaxBatchSize:   rpc.DefaultMaxBatchSize,
+
+		TargetPeers:      8,
+		MaxInboundPeers:  40,
+		MaxOutboundPeers: 10,
+		P2PCompression:   true,
+		MempoolSize:      10000,
+
+		BlockGasLimit: consensus.DefaultBlockGasLimit,
+		MinBaseFee:    consensus.DefaultMinBaseFee,
+
+		SnapshotInterval:   1,
+		SnapshotKeepRecent: 2,
+	}
 }
 
 func LoadConfigFromFile(path string, cfg *Config) error {
-    b, err := os.ReadFile(path)
-    if err != nil { return err }
-    return json.Unmarshal(b, cfg)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, cfg)
 }
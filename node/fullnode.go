@@ -0,0 +1,274 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/keystore"
+	"github.com/rockandcode4/graphene-proto/mempool"
+	"github.com/rockandcode4/graphene-proto/p2p"
+	"github.com/rockandcode4/graphene-proto/rpc"
+	"github.com/rockandcode4/graphene-proto/snapshot"
+	"github.com/rockandcode4/graphene-proto/staking"
+	"github.com/rockandcode4/graphene-proto/state"
+	"github.com/rockandcode4/graphene-proto/store"
+)
+
+// NodeKeyFile is the name of the libp2p key file in the data directory, used
+// when node_key_hex is not set.
+const NodeKeyFile = "node.key"
+
+// Node wires storage, state, networking, consensus, staking and RPC together.
+type Node struct {
+	cfg       *Config
+	p2p       *p2p.P2P
+	state     *state.StateDB
+	cons      *consensus.Consensus
+	syncer    *consensus.Syncer
+	stake     *staking.Manager
+	rpc       *rpc.Server
+	snapshots *snapshot.Store
+}
+
+// NewNode opens the data directory, joins the network, fast syncs if
+// configured and catches up with peers before starting consensus and the RPC
+// server.
+func NewNode(ctx context.Context, cfg *Config) (*Node, error) {
+	var validator *keystore.Key
+	if cfg.ValidatorKeyFile != "" {
+		pass, err := keystore.ReadPassphrase(cfg.ValidatorPassphraseFile, "Validator key passphrase: ", false)
+		if err != nil {
+			return nil, err
+		}
+		if validator, err = keystore.ReadKeyFile(cfg.ValidatorKeyFile, pass); err != nil {
+			return nil, fmt.Errorf("failed to unlock validator key: %v", err)
+		}
+	}
+	if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := store.OpenDB(filepath.Join(cfg.DataDir, "chaindata")); err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	st := state.NewStateDB(store.GetDB())
+
+	priv, err := p2p.LoadIdentity(cfg.NodeKeyHex, filepath.Join(cfg.DataDir, NodeKeyFile))
+	if err != nil {
+		store.CloseDB()
+		return nil, fmt.Errorf("failed to load node key: %v", err)
+	}
+	p, err := p2p.NewP2P(ctx, p2p.Config{
+		ListenAddr: cfg.BindAddr,
+		PrivKey:    priv,
+		BanFile:    filepath.Join(cfg.DataDir, "banned_peers.json"),
+		ChainID:    cfg.ChainID,
+		Compress:   cfg.P2PCompression,
+
+		MaxInbound:      cfg.MaxInboundPeers,
+		MaxOutbound:     cfg.MaxOutboundPeers,
+		PersistentPeers: cfg.PersistentPeers,
+		AllowList:       cfg.AllowPeers,
+		DenyList:        cfg.DenyPeers,
+
+		NATPortMap:    cfg.NATPortMap,
+		AutoNAT:       cfg.AutoNAT,
+		HolePunching:  cfg.HolePunching,
+		RelayService:  cfg.RelayService,
+		Relays:        cfg.Relays,
+		ExternalAddrs: cfg.ExternalAddrs,
+		Reachability:  cfg.Reachability,
+
+		PrivatePeers: cfg.PrivatePeers,
+		PrivateMode:  cfg.PrivateMode,
+	})
+	if err != nil {
+		store.CloseDB()
+		return nil, err
+	}
+	p.SetTxValidator(validateGossipTx)
+	params := consensus.Params{BlockGasLimit: cfg.BlockGasLimit, MinBaseFee: cfg.MinBaseFee}
+	pool := mempool.New(cfg.MempoolSize)
+	cons, err := consensus.NewConsensus(st, pool, p, params)
+	if err != nil {
+		_ = p.Stop()
+		store.CloseDB()
+		return nil, err
+	}
+	if validator != nil {
+		cons.SetValidator(validator.PrivateKey)
+		log.Printf("Proposing as validator %s", validator.Address)
+	}
+	minGasPrice := cons.Params().MinBaseFee
+	if cfg.MinGasPrice > minGasPrice {
+		minGasPrice = cfg.MinGasPrice
+	}
+	pool.SetMinGasPrice(minGasPrice)
+	stk := staking.NewManager(cons)
+	rpcSrv, err := rpc.NewServer(cons, stk, p, rpc.Config{
+		Host:       cfg.RPCHost,
+		Port:       cfg.RPCPort,
+		ChainID:    cfg.ChainID,
+		EthChainID: cfg.EthChainID,
+
+		WSMaxConnections:   cfg.WSMaxConnections,
+		WSMaxSubscriptions: cfg.WSMaxSubscriptions,
+
+		APIKeys:       cfg.RPCAPIKeys,
+		JWTSecretFile: cfg.RPCJWTSecretFile,
+		CORSOrigins:   cfg.RPCCORSOrigins,
+		Namespaces:    cfg.RPCNamespaces,
+		TLSCertFile:   cfg.RPCTLSCert,
+		TLSKeyFile:    cfg.RPCTLSKey,
+
+		RateLimit:         cfg.RPCRateLimit,
+		RateBurst:         cfg.RPCRateBurst,
+		MaxBodyBytes:      cfg.RPCMaxBodyBytes,
+		RequestTimeout:    time.Duration(cfg.RPCRequestTimeout) * time.Second,
+		MaxConcurrent:     cfg.RPCMaxConcurrent,
+		MethodConcurrency: cfg.RPCMethodConcurrency,
+		MaxBatchSize:      cfg.RPCMaxBatchSize,
+	})
+	if err != nil {
+		_ = p.Stop()
+		store.CloseDB()
+		return nil, err
+	}
+	n := &Node{cfg: cfg, p2p: p, state: st, cons: cons, stake: stk, rpc: rpcSrv}
+	n.syncer = consensus.NewSyncer(cons, p)
+
+	if err := n.setupSnapshots(); err != nil {
+		n.Stop()
+		return nil, err
+	}
+
+	p.ConnectToPeers(cfg.Bootstrap)
+	err = p.StartDiscovery(p2p.DiscoveryConfig{
+		Namespace:   "graphene/" + cfg.ChainID,
+		MDNS:        cfg.MDNS,
+		DHT:         cfg.DHT,
+		TargetPeers: cfg.TargetPeers,
+	})
+	if err != nil {
+		n.Stop()
+		return nil, err
+	}
+	if cfg.FastSync {
+		if err := n.fastSync(ctx); err != nil {
+			n.Stop()
+			return nil, err
+		}
+	}
+
+	// catch up over the sync protocol before producing or following gossip
+	if err := n.syncer.Sync(ctx); err != nil {
+		log.Printf("initial sync: %v", err)
+	}
+	n.syncer.Start(ctx)
+	cons.Start()
+	rpcSrv.Start()
+	return n, nil
+}
+
+// validateGossipTx rejects transactions that do not decode, fail basic
+// checks or carry a bad signature.
+func validateGossipTx(_ peer.ID, bz []byte) p2p.Validation {
+	if _, err := core.CheckTx(bz); err != nil {
+		return p2p.ValidationReject
+	}
+	return p2p.ValidationAccept
+}
+
+// HostID returns the libp2p peer id of this node.
+func (n *Node) HostID() string {
+	return n.p2p.HostID()
+}
+
+// Addrs returns the multiaddrs peers can use to reach this node.
+func (n *Node) Addrs() []string {
+	return n.p2p.Addrs()
+}
+
+// Stop shuts down all services and closes the database.
+func (n *Node) Stop() {
+	n.rpc.Stop()
+	n.cons.Stop()
+	if err := n.p2p.Stop(); err != nil {
+		log.Println("p2p stop:", err)
+	}
+	store.CloseDB()
+}
+
+// setupSnapshots serves stored snapshots to peers and, unless disabled,
+// takes a new one every SnapshotInterval epochs.
+func (n *Node) setupSnapshots() error {
+	s, err := snapshot.NewStore(filepath.Join(n.cfg.DataDir, "snapshots"), n.cfg.SnapshotKeepRecent)
+	if err != nil {
+		return err
+	}
+	n.snapshots = s
+	n.p2p.ServeSnapshots(s)
+	if n.cfg.SnapshotInterval == 0 {
+		return nil
+	}
+
+	every := n.cfg.SnapshotInterval * consensus.EpochLength
+	n.cons.OnFinalize(func(b *consensus.Block) {
+		if b.Number == 0 || b.Number%every != 0 {
+			return
+		}
+		// take the view synchronously so it matches b, write it out in the background
+		view, err := n.state.View()
+		if err != nil {
+			log.Printf("snapshot at %d: %v", b.Number, err)
+			return
+		}
+		go func() {
+			defer view.Release()
+			m, err := s.Create(view, b)
+			if err != nil {
+				log.Printf("snapshot at %d: %v", b.Number, err)
+				return
+			}
+			log.Printf("Snapshot taken at height %d (%d chunks)", m.Height, len(m.Chunks))
+		}()
+	})
+	return nil
+}
+
+// fastSync restores the state from a snapshot offered by peers. If no
+// snapshot can be restored the node continues from its local state; an
+// error means it cannot start.
+func (n *Node) fastSync(ctx context.Context) error {
+	cfg := snapshot.SyncConfig{MinPeers: 2, PeerTimeout: 30 * time.Second}
+	if n.cfg.TrustedHash != "" {
+		h, err := hex.DecodeString(n.cfg.TrustedHash)
+		if err != nil {
+			return fmt.Errorf("invalid trusted_hash: %v", err)
+		}
+		cfg.TrustedHash = h
+		cfg.MinPeers = 1
+	}
+	// a failed restore leaves the state alone; should it have been changed
+	// anyway, the node must not continue from a state matching no block
+	before, err := n.state.Root()
+	if err != nil {
+		return err
+	}
+	if _, err := snapshot.FastSync(ctx, n.p2p, n.state, n.cons, cfg); err != nil {
+		if after, rerr := n.state.Root(); rerr != nil || !bytes.Equal(after, before) {
+			return fmt.Errorf("fast sync failed after changing the local state: %v", err)
+		}
+		log.Printf("fast sync failed, continuing from local state: %v", err)
+	}
+	return nil
+}
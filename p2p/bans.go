@@ -0,0 +1,93 @@
+package p2p
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+)
+
+// banList tracks banned peers and their expiry. It doubles as the pubsub
+// blacklist and is consulted by the connection gater.
+type banList struct {
+	mu    sync.Mutex
+	path  string // empty keeps bans in memory only
+	until map[peerstore.ID]time.Time
+}
+
+// loadBans reads the ban file at path, dropping expired entries.
+func loadBans(path string) (*banList, error) {
+	b := &banList{path: path, until: make(map[peerstore.ID]time.Time)}
+	if path == "" {
+		return b, nil
+	}
+	bz, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved map[string]int64
+	if err := json.Unmarshal(bz, &saved); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for s, unix := range saved {
+		pid, err := peerstore.Decode(s)
+		if err != nil {
+			continue
+		}
+		if t := time.Unix(unix, 0); t.After(now) {
+			b.until[pid] = t
+		}
+	}
+	return b, nil
+}
+
+func (b *banList) ban(pid peerstore.ID, until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.until[pid] = until
+	b.save()
+}
+
+// Add implements pubsub.Blacklist.
+func (b *banList) Add(pid peerstore.ID) bool {
+	b.ban(pid, time.Now().Add(banDuration))
+	return true
+}
+
+// Contains implements pubsub.Blacklist.
+func (b *banList) Contains(pid peerstore.ID) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.until[pid]
+	if !ok {
+		return false
+	}
+	if time.Now().After(t) {
+		delete(b.until, pid)
+		b.save()
+		return false
+	}
+	return true
+}
+
+// save writes the list to disk. Must be called with b.mu held.
+func (b *banList) save() {
+	if b.path == "" {
+		return
+	}
+	out := make(map[string]int64, len(b.until))
+	for pid, t := range b.until {
+		out[pid.String()] = t.Unix()
+	}
+	bz, _ := json.MarshalIndent(out, "", "  ")
+	if err := os.WriteFile(b.path, bz, 0o644); err != nil {
+		log.Printf("saving ban list: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// BlockTxsProtocol fetches transactions of a recent block by index. Peers
+// use it to fill in transactions missing from their mempool when
+// reconstructing a compact block.
+const BlockTxsProtocol = protocol.ID("/graphene/blocktxs/1")
+
+const (
+	maxBlockTxsRequest  = 256 << 10
+	maxBlockTxsResponse = 8 << 20
+)
+
+// BlockTxsProvider returns the encoded transactions at the given indexes of
+// the block with the given hash. ids are the matching short ids from the
+// compact block, for providers that do not have the block yet.
+type BlockTxsProvider interface {
+	BlockTxs(hash []byte, indexes []uint64, ids [][]byte) ([][]byte, error)
+}
+
+type blockTxsRequest struct {
+	Hash    []byte   `json:"hash"`
+	Indexes []uint64 `json:"indexes"`
+	IDs     [][]byte `json:"ids"`
+}
+
+type blockTxsResponse struct {
+	Txs   [][]byte `json:"txs,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// ServeBlockTxs answers block transaction requests from peers using bp.
+func (p *P2P) ServeBlockTxs(bp BlockTxsProvider) {
+	p.serve(BlockTxsProtocol, maxBlockTxsRequest,
+		func() interface{} { return new(blockTxsRequest) },
+		func(_ peerstore.ID, v interface{}) interface{} {
+			req := v.(*blockTxsRequest)
+			var resp blockTxsResponse
+			if len(req.IDs) != len(req.Indexes) {
+				return &blockTxsResponse{Error: "ids and indexes differ in length"}
+			}
+			txs, err := bp.BlockTxs(req.Hash, req.Indexes, req.IDs)
+			if err != nil {
+				resp.Error = err.Error()
+			} else {
+				resp.Txs = txs
+			}
+			return &resp
+		})
+}
+
+// FetchBlockTxs requests the transactions at indexes, with the given short
+// ids, of the block with the given hash from pid.
+func (p *P2P) FetchBlockTxs(ctx context.Context, pid peerstore.ID, hash []byte, indexes []uint64, ids [][]byte) ([][]byte, error) {
+	var resp blockTxsResponse
+	req := &blockTxsRequest{Hash: hash, Indexes: indexes, IDs: ids}
+	if err := p.request(ctx, pid, BlockTxsProtocol, req, &resp, maxBlockTxsResponse); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("peer %s: %s", pid, resp.Error)
+	}
+	if len(resp.Txs) != len(indexes) {
+		return nil, fmt.Errorf("peer %s: got %d txs, asked for %d", pid, len(resp.Txs), len(indexes))
+	}
+	return resp.Txs, nil
+}
@@ -0,0 +1,135 @@
+package p2p
+
+import (
+	"context"
+	"log"
+	"time"
+
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
+)
+
+// discoveryInterval is how often the peer count is checked against the target.
+const discoveryInterval = 30 * time.Second
+
+type DiscoveryConfig struct {
+	// Namespace is the chain-specific rendezvous string used for both mDNS
+	// and the DHT, e.g. "graphene/<chain id>".
+	Namespace string
+	MDNS      bool
+	DHT       bool
+	// TargetPeers is the number of connections discovery tries to maintain.
+	TargetPeers int
+}
+
+// StartDiscovery enables the configured discovery mechanisms. Found peers are
+// dialed until the node has cfg.TargetPeers connections.
+func (p *P2P) StartDiscovery(cfg DiscoveryConfig) error {
+	if cfg.TargetPeers <= 0 {
+		cfg.TargetPeers = 8
+	}
+	p.targetPeers = cfg.TargetPeers
+	if p.peers.privateMode {
+		log.Printf("private mode: peer discovery disabled")
+		return nil
+	}
+
+	if cfg.MDNS {
+		svc := mdns.NewMdnsService(p.host, cfg.Namespace, &mdnsNotifee{p: p})
+		if err := svc.Start(); err != nil {
+			return err
+		}
+		p.mdns = svc
+		log.Printf("mDNS discovery enabled (namespace %s)", cfg.Namespace)
+	}
+
+	if cfg.DHT {
+		// a private protocol prefix keeps us out of the public IPFS DHT
+		kad, err := dht.New(p.ctx, p.host,
+			dht.Mode(dht.ModeAutoServer),
+			dht.ProtocolPrefix("/graphene"),
+			// private peers must never be handed out to other nodes
+			dht.RoutingTableFilter(func(_ interface{}, pid peerstore.ID) bool {
+				return !p.peers.private[pid]
+			}),
+		)
+		if err != nil {
+			return err
+		}
+		if err := kad.Bootstrap(p.ctx); err != nil {
+			_ = kad.Close()
+			return err
+		}
+		p.dht = kad
+		rd := drouting.NewRoutingDiscovery(kad)
+		dutil.Advertise(p.ctx, rd, cfg.Namespace)
+		go p.maintainPeers(rd, cfg.Namespace)
+		log.Printf("DHT discovery enabled (namespace %s, target %d peers)", cfg.Namespace, cfg.TargetPeers)
+	}
+	return nil
+}
+
+// maintainPeers looks up the rendezvous namespace whenever the node is
+// below its target peer count.
+func (p *P2P) maintainPeers(rd *drouting.RoutingDiscovery, ns string) {
+	ticker := time.NewTicker(discoveryInterval)
+	defer ticker.Stop()
+	for {
+		if missing := p.targetPeers - len(p.Peers()); missing > 0 {
+			p.findPeers(rd, ns, missing)
+		}
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *P2P) findPeers(rd *drouting.RoutingDiscovery, ns string, want int) {
+	ctx, cancel := context.WithTimeout(p.ctx, discoveryInterval)
+	defer cancel()
+	ch, err := rd.FindPeers(ctx, ns)
+	if err != nil {
+		log.Printf("dht find peers: %v", err)
+		return
+	}
+	for pi := range ch {
+		if want <= 0 {
+			return
+		}
+		if p.dialDiscovered(pi) {
+			want--
+		}
+	}
+}
+
+// dialDiscovered connects to a discovered peer unless it is ourselves, is
+// already connected, or we have enough peers. It reports whether a new
+// connection was made.
+func (p *P2P) dialDiscovered(pi peerstore.AddrInfo) bool {
+	if pi.ID == p.host.ID() || len(pi.Addrs) == 0 {
+		return false
+	}
+	if len(p.host.Network().ConnsToPeer(pi.ID)) > 0 || len(p.Peers()) >= p.targetPeers {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(p.ctx, 5*time.Second)
+	defer cancel()
+	if err := p.host.Connect(ctx, pi); err != nil {
+		return false
+	}
+	log.Printf("Connected to discovered peer %s", pi.ID)
+	return true
+}
+
+type mdnsNotifee struct {
+	p *P2P
+}
+
+func (n *mdnsNotifee) HandlePeerFound(pi peerstore.AddrInfo) {
+	go n.p.dialDiscovered(pi)
+}
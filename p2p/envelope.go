@@ -0,0 +1,122 @@
+package p2p
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang/snappy"
+
+	"github.com/rockandcode4/graphene-proto/codec"
+)
+
+// ProtocolVersion is the envelope version this node speaks. Messages with
+// another version are rejected.
+const ProtocolVersion = 1
+
+// MsgType identifies the payload carried by an envelope.
+type MsgType uint8
+
+// Types 1 (full block) and 3 (vote) are retired and must not be reused.
+const (
+	MsgTx MsgType = 2
+	// MsgCompactBlock is a block header plus short transaction ids.
+	MsgCompactBlock MsgType = 4
+)
+
+// maxPayload bounds the decoded payload per message type. Compressed
+// payloads are checked against the limit before they are decompressed.
+var maxPayload = map[MsgType]int{
+	MsgTx:           64 << 10,
+	MsgCompactBlock: 1 << 20,
+}
+
+// maxEnvelopeSize is the largest message gossipsub accepts on any topic.
+const maxEnvelopeSize = 1<<20 + 1024
+
+// flagSnappy marks a snappy-compressed payload.
+const flagSnappy = 1 << 0
+
+// compressMin is the payload size below which compression is not attempted.
+const compressMin = 256
+
+// Envelope wraps every gossip message.
+type Envelope struct {
+	Version uint8
+	Type    MsgType
+	ChainID string
+	Payload []byte
+}
+
+var errUnknownType = errors.New("unknown message type")
+
+// encodeEnvelope serialises a message as
+// version | type | flags | chain id | payload, compressing the payload with
+// snappy when that makes it smaller.
+func encodeEnvelope(t MsgType, chainID string, payload []byte, compress bool) ([]byte, error) {
+	max, ok := maxPayload[t]
+	if !ok {
+		return nil, errUnknownType
+	}
+	if len(payload) > max {
+		return nil, fmt.Errorf("%d byte payload exceeds the %d byte limit for type %d", len(payload), max, t)
+	}
+	var flags uint8
+	if compress && len(payload) >= compressMin {
+		if c := snappy.Encode(nil, payload); len(c) < len(payload) {
+			payload = c
+			flags |= flagSnappy
+		}
+	}
+	var w codec.Writer
+	w.Uint(ProtocolVersion)
+	w.Uint(uint64(t))
+	w.Uint(uint64(flags))
+	w.String(chainID)
+	w.Bytes(payload)
+	return w.Out(), nil
+}
+
+// decodeEnvelope parses and checks a message received on a topic that
+// carries messages of type want.
+func decodeEnvelope(bz []byte, want MsgType, chainID string) (*Envelope, error) {
+	if len(bz) > maxEnvelopeSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds limit", len(bz))
+	}
+	r := codec.NewReader(bz)
+	version := r.Uint()
+	t := MsgType(r.Uint())
+	flags := r.Uint()
+	chain := r.String()
+	payload := r.Bytes()
+	if err := r.Done(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case version != ProtocolVersion:
+		return nil, fmt.Errorf("unsupported protocol version %d", version)
+	case t != want:
+		return nil, fmt.Errorf("unexpected message type %d", t)
+	case chain != chainID:
+		return nil, fmt.Errorf("message for chain %q", chain)
+	case flags&^flagSnappy != 0:
+		return nil, fmt.Errorf("unknown flags %#x", flags)
+	}
+
+	max := maxPayload[t]
+	if flags&flagSnappy != 0 {
+		n, err := snappy.DecodedLen(payload)
+		if err != nil {
+			return nil, err
+		}
+		if n > max {
+			return nil, fmt.Errorf("%d byte payload exceeds the %d byte limit for type %d", n, max, t)
+		}
+		if payload, err = snappy.Decode(nil, payload); err != nil {
+			return nil, err
+		}
+	} else if len(payload) > max {
+		return nil, fmt.Errorf("%d byte payload exceeds the %d byte limit for type %d", len(payload), max, t)
+	}
+	return &Envelope{Version: uint8(version), Type: t, ChainID: chain, Payload: payload}, nil
+}
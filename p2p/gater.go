@@ -0,0 +1,54 @@
+package p2p
+
+import (
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// gater refuses connections to and from banned or denied peers and enforces
+// the inbound and outbound connection limits. Persistent and private peers
+// are exempt from the limits and access lists, but not from bans. In
+// private mode nothing but persistent peers is dialed.
+type gater struct {
+	p *P2P
+}
+
+func (g *gater) InterceptPeerDial(pid peerstore.ID) bool {
+	p := g.p
+	if p.bans.Contains(pid) {
+		return false
+	}
+	if p.peers.isPersistent(pid) {
+		return true
+	}
+	if p.peers.privateMode || p.peers.deny.matchPeer(pid) {
+		return false
+	}
+	return p.connCount(network.DirOutbound) < p.peers.maxOutbound
+}
+
+func (g *gater) InterceptAddrDial(pid peerstore.ID, addr ma.Multiaddr) bool {
+	return g.p.peers.trusted(pid) || !g.p.peers.deny.matchAddr(addr)
+}
+
+func (g *gater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	// the peer id is not known yet; only denied IPs can be refused here
+	return !g.p.peers.deny.matchAddr(addrs.RemoteMultiaddr())
+}
+
+func (g *gater) InterceptSecured(dir network.Direction, pid peerstore.ID, addrs network.ConnMultiaddrs) bool {
+	p := g.p
+	if p.bans.Contains(pid) || !p.peers.admits(pid, addrs.RemoteMultiaddr()) {
+		return false
+	}
+	if dir == network.DirInbound && !p.peers.trusted(pid) {
+		return p.connCount(network.DirInbound) < p.peers.maxInbound
+	}
+	return true
+}
+
+func (g *gater) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
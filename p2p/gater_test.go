@@ -0,0 +1,118 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func newPeerID(t *testing.T) peerstore.ID {
+	t.Helper()
+	_, pub, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := peerstore.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pid
+}
+
+// connAddrs implements network.ConnMultiaddrs for a remote address.
+type connAddrs struct {
+	remote ma.Multiaddr
+}
+
+func (c connAddrs) LocalMultiaddr() ma.Multiaddr  { return ma.StringCast("/ip4/127.0.0.1/tcp/4001") }
+func (c connAddrs) RemoteMultiaddr() ma.Multiaddr { return c.remote }
+
+// newTestGater returns a gater for a node without a host, so with no
+// connections counted against the limits.
+func newTestGater(t *testing.T, cfg Config) *gater {
+	t.Helper()
+	peers, err := newPeerManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bans, err := loadBans("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gater{p: &P2P{bans: bans, peers: peers}}
+}
+
+func TestGater(t *testing.T) {
+	plain, banned, denied, private, bannedPrivate := newPeerID(t), newPeerID(t), newPeerID(t), newPeerID(t), newPeerID(t)
+	g := newTestGater(t, Config{
+		DenyList:     []string{denied.String(), "10.0.0.0/8"},
+		PrivatePeers: []string{private.String(), bannedPrivate.String()},
+	})
+	until := time.Now().Add(time.Hour)
+	g.p.bans.ban(banned, until)
+	g.p.bans.ban(bannedPrivate, until)
+
+	public := connAddrs{ma.StringCast("/ip4/203.0.113.7/tcp/4001")}
+	deniedIP := connAddrs{ma.StringCast("/ip4/10.1.2.3/tcp/4001")}
+	for _, tc := range []struct {
+		name  string
+		pid   peerstore.ID
+		addrs connAddrs
+		want  bool
+	}{
+		{"plain peer", plain, public, true},
+		{"plain peer from a denied IP", plain, deniedIP, false},
+		{"banned peer", banned, public, false},
+		{"denied peer", denied, public, false},
+		// private peers skip the access lists but not bans
+		{"private peer from a denied IP", private, deniedIP, true},
+		{"banned private peer", bannedPrivate, public, false},
+	} {
+		if got := g.InterceptSecured(network.DirInbound, tc.pid, tc.addrs); got != tc.want {
+			t.Errorf("%s: secured %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		pid  peerstore.ID
+		want bool
+	}{
+		{"plain peer", plain, true},
+		{"banned peer", banned, false},
+		{"denied peer", denied, false},
+		{"banned private peer", bannedPrivate, false},
+	} {
+		if got := g.InterceptPeerDial(tc.pid); got != tc.want {
+			t.Errorf("%s: dial %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	if g.InterceptAccept(deniedIP) || !g.InterceptAccept(public) {
+		t.Error("accept does not apply the denied IPs")
+	}
+}
+
+func TestGaterPrivateMode(t *testing.T) {
+	sentry, private, plain := newPeerID(t), newPeerID(t), newPeerID(t)
+	g := newTestGater(t, Config{
+		PrivateMode:     true,
+		PersistentPeers: []string{"/ip4/203.0.113.8/tcp/4001/p2p/" + sentry.String()},
+		PrivatePeers:    []string{private.String()},
+	})
+	addrs := connAddrs{ma.StringCast("/ip4/203.0.113.7/tcp/4001")}
+
+	if !g.InterceptPeerDial(sentry) || g.InterceptPeerDial(plain) || g.InterceptPeerDial(private) {
+		t.Error("private mode dials peers other than the persistent ones")
+	}
+	if !g.InterceptSecured(network.DirInbound, sentry, addrs) || !g.InterceptSecured(network.DirInbound, private, addrs) {
+		t.Error("private mode refuses a trusted peer")
+	}
+	if g.InterceptSecured(network.DirInbound, plain, addrs) {
+		t.Error("private mode admits an untrusted peer")
+	}
+}
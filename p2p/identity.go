@@ -0,0 +1,73 @@
+package p2p
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+)
+
+// GenerateIdentity creates a new Ed25519 host key.
+func GenerateIdentity() (crypto.PrivKey, error) {
+	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	return priv, err
+}
+
+// EncodeIdentity returns the hex encoding of the protobuf-marshalled key, the
+// format accepted by node_key_hex and stored in key files.
+func EncodeIdentity(priv crypto.PrivKey) (string, error) {
+	bz, err := crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bz), nil
+}
+
+// DecodeIdentity parses a key produced by EncodeIdentity.
+func DecodeIdentity(s string) (crypto.PrivKey, error) {
+	bz, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("node key is not hex: %v", err)
+	}
+	return crypto.UnmarshalPrivateKey(bz)
+}
+
+// PeerIDFromKey returns the peer id that priv will be known by.
+func PeerIDFromKey(priv crypto.PrivKey) (peerstore.ID, error) {
+	return peerstore.IDFromPrivateKey(priv)
+}
+
+// LoadIdentity returns the host key from keyHex if set, otherwise from the
+// key file at path, generating and saving a new key there on first run.
+func LoadIdentity(keyHex, path string) (crypto.PrivKey, error) {
+	if keyHex != "" {
+		return DecodeIdentity(keyHex)
+	}
+	bz, err := os.ReadFile(path)
+	if err == nil {
+		priv, err := DecodeIdentity(string(bz))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return priv, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	priv, err := GenerateIdentity()
+	if err != nil {
+		return nil, err
+	}
+	enc, err := EncodeIdentity(priv)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(enc+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	return priv, nil
+}
@@ -0,0 +1,114 @@
+package p2p
+
+import (
+	"fmt"
+	"log"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// natOptions translates the NAT traversal settings into libp2p options.
+// Everything is off unless configured.
+func natOptions(cfg Config) ([]libp2p.Option, error) {
+	var opts []libp2p.Option
+	if cfg.PrivateMode {
+		if len(cfg.Relays) > 0 || len(cfg.ExternalAddrs) > 0 || cfg.RelayService {
+			return nil, fmt.Errorf("private mode cannot be combined with relays or external addresses")
+		}
+		// advertise nothing; sentries know us only by the connections we open
+		opts = append(opts, libp2p.AddrsFactory(func([]ma.Multiaddr) []ma.Multiaddr { return nil }))
+	}
+	if cfg.NATPortMap {
+		opts = append(opts, libp2p.NATPortMap())
+	}
+	if cfg.AutoNAT {
+		opts = append(opts, libp2p.EnableNATService())
+	}
+	if cfg.HolePunching {
+		opts = append(opts, libp2p.EnableHolePunching())
+	}
+	if cfg.RelayService {
+		opts = append(opts, libp2p.EnableRelayService())
+	}
+	if len(cfg.Relays) > 0 {
+		relays := make([]peerstore.AddrInfo, 0, len(cfg.Relays))
+		for _, s := range cfg.Relays {
+			info, err := parseAddrInfo(s)
+			if err != nil {
+				return nil, fmt.Errorf("relay %s: %v", s, err)
+			}
+			relays = append(relays, *info)
+		}
+		opts = append(opts, libp2p.EnableAutoRelayWithStaticRelays(relays))
+	}
+
+	switch cfg.Reachability {
+	case "", "auto":
+	case "public":
+		opts = append(opts, libp2p.ForceReachabilityPublic())
+	case "private":
+		opts = append(opts, libp2p.ForceReachabilityPrivate())
+	default:
+		return nil, fmt.Errorf("unknown reachability %q", cfg.Reachability)
+	}
+
+	if len(cfg.ExternalAddrs) > 0 {
+		external := make([]ma.Multiaddr, 0, len(cfg.ExternalAddrs))
+		for _, s := range cfg.ExternalAddrs {
+			addr, err := ma.NewMultiaddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("external addr %s: %v", s, err)
+			}
+			external = append(external, addr)
+		}
+		opts = append(opts, libp2p.AddrsFactory(func(addrs []ma.Multiaddr) []ma.Multiaddr {
+			return appendMissing(addrs, external)
+		}))
+	}
+	return opts, nil
+}
+
+func appendMissing(addrs, extra []ma.Multiaddr) []ma.Multiaddr {
+	out := append([]ma.Multiaddr(nil), addrs...)
+	for _, e := range extra {
+		found := false
+		for _, a := range addrs {
+			if a.Equal(e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// logReachability logs what AutoNAT concludes about this node.
+func (p *P2P) logReachability() {
+	sub, err := p.host.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
+	if err != nil {
+		return
+	}
+	defer sub.Close()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case ev, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			r := ev.(event.EvtLocalReachabilityChanged).Reachability
+			log.Printf("reachability: %s", r)
+			if r == network.ReachabilityPrivate {
+				log.Printf("node is not publicly reachable; configure relays or external_addrs")
+			}
+		}
+	}
+}
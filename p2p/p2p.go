@@ -2,17 +2,22 @@ package p2p
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	libp2p "github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
-	ma "github.com/multiformats/go-multiaddr"
-	peerstore "github.com/libp2p/go-libp2p/core/peer"
-	host "github.com/libp2p/go-libp2p/core/host"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	host "github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 const (
@@ -20,6 +25,12 @@ const (
 	TxTopic     = "graphene-tx"
 )
 
+// topicTypes is the message type carried on each gossip topic.
+var topicTypes = map[string]MsgType{
+	BlocksTopic: MsgCompactBlock,
+	TxTopic:     MsgTx,
+}
+
 // P2P wraps libp2p host + pubsub
 type P2P struct {
 	ctx    context.Context
@@ -28,56 +39,171 @@ type P2P struct {
 	blocks *pubsub.Topic
 	tx     *pubsub.Topic
 	sub    *pubsub.Subscription
+	txSub  *pubsub.Subscription
+
+	chainID  string
+	compress bool
+
+	chain ChainProvider
+
+	// discovery
+	mdns        mdns.Service
+	dht         *dht.IpfsDHT
+	targetPeers int
+
+	bans      *banList
+	penalties penalties
+	peers     *peerManager
+
+	mu         sync.Mutex
+	statuses   map[peerstore.ID]SyncStatus
+	validators map[string]MessageValidator
+}
+
+// Config holds the settings for NewP2P.
+type Config struct {
+	// ListenAddr is a multiaddr string like "/ip4/0.0.0.0/tcp/0"
+	ListenAddr string
+	// PrivKey is the host identity; see LoadIdentity. If nil an ephemeral
+	// key is generated and the peer id changes on every start.
+	PrivKey crypto.PrivKey
+	// BanFile persists banned peers across restarts; empty keeps bans in
+	// memory only.
+	BanFile string
+	// ChainID is stamped on every gossip message; messages for other chains
+	// are rejected.
+	ChainID string
+	// Compress snappy-compresses gossip payloads where it saves space.
+	Compress bool
+
+	// MaxInbound and MaxOutbound cap the number of connected peers in each
+	// direction; zero selects the defaults (40 and 10).
+	MaxInbound  int
+	MaxOutbound int
+	// PersistentPeers are multiaddrs that are always admitted and redialed
+	// whenever they disconnect.
+	PersistentPeers []string
+	// AllowList, if not empty, admits only the listed peers. DenyList refuses
+	// the listed peers. Entries are peer ids, IP addresses or CIDR ranges.
+	AllowList []string
+	DenyList  []string
+
+	// NAT traversal, all opt-in. NATPortMap requests a port mapping from
+	// the gateway (UPnP/NAT-PMP). AutoNAT serves reachability checks to
+	// other peers. HolePunching upgrades relayed connections to direct
+	// ones. RelayService makes this node a circuit relay v2 for others;
+	// Relays are static relays this node reserves a slot on when it is not
+	// publicly reachable.
+	NATPortMap   bool
+	AutoNAT      bool
+	HolePunching bool
+	RelayService bool
+	Relays       []string
+	// ExternalAddrs are advertised in addition to the listen addresses,
+	// e.g. "/ip4/203.0.113.7/tcp/4001" behind a port forward.
+	ExternalAddrs []string
+	// Reachability overrides AutoNAT: "public", "private" or "auto".
+	Reachability string
+
+	// PrivatePeers are peer ids, typically validators behind this sentry,
+	// that are always admitted but never revealed: they are left out of the
+	// DHT routing table and the peer list.
+	PrivatePeers []string
+	// PrivateMode is for validators behind sentries: only persistent peers
+	// are dialed or admitted, no addresses are advertised and discovery is
+	// disabled.
+	PrivateMode bool
 }
 
 // NewP2P creates a new libp2p host and gossip pubsub instance.
-// listenAddr is a multiaddr string like "/ip4/0.0.0.0/tcp/0"
-func NewP2P(ctx context.Context, listenAddr string) (*P2P, error) {
-	// generate ephemeral keypair for this host
-	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+func NewP2P(ctx context.Context, cfg Config) (*P2P, error) {
+	priv := cfg.PrivKey
+	if priv == nil {
+		var err error
+		if priv, err = GenerateIdentity(); err != nil {
+			return nil, err
+		}
+	}
+
+	bans, err := loadBans(cfg.BanFile)
 	if err != nil {
 		return nil, err
 	}
-
-	// create host
-	h, err := libp2p.New(libp2p.ListenAddrStrings(listenAddr), libp2p.Identity(priv))
+	peers, err := newPeerManager(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	// create pubsub
-	ps, err := pubsub.NewGossipSub(ctx, h)
+	p := &P2P{
+		ctx:      ctx,
+		bans:     bans,
+		peers:    peers,
+		chainID:  cfg.ChainID,
+		compress: cfg.Compress,
+
+		statuses:   make(map[peerstore.ID]SyncStatus),
+		validators: make(map[string]MessageValidator),
+	}
+	p.penalties.scores = make(map[peerstore.ID]float64)
+
+	natOpts, err := natOptions(cfg)
 	if err != nil {
-		_ = h.Close()
 		return nil, err
 	}
 
-	blocksTopic, err := ps.Join(BlocksTopic)
+	// create host
+	h, err := libp2p.New(append([]libp2p.Option{
+		libp2p.ListenAddrStrings(cfg.ListenAddr),
+		libp2p.Identity(priv),
+		libp2p.ConnectionGater(&gater{p: p}),
+	}, natOpts...)...)
 	if err != nil {
-		_ = h.Close()
 		return nil, err
 	}
-	txTopic, err := ps.Join(TxTopic)
+	p.host = h
+
+	// create pubsub; message ids are content hashes so the same payload
+	// relayed by several peers is only validated and delivered once.
+	// Messages carry no author or signature, so relaying a validator's
+	// block does not reveal its peer id; peer exchange stays disabled for
+	// the same reason.
+	ps, err := pubsub.NewGossipSub(ctx, h,
+		pubsub.WithNoAuthor(),
+		pubsub.WithMessageIdFn(func(m *pb.Message) string {
+			sum := sha256.Sum256(m.Data)
+			return string(sum[:])
+		}),
+		pubsub.WithPeerScore(peerScoreParams(p.appScore), peerScoreThresholds),
+		pubsub.WithPeerScoreInspect(pubsub.PeerScoreInspectFn(p.inspectScores), 10*time.Second),
+		pubsub.WithBlacklist(bans),
+		pubsub.WithMaxMessageSize(maxEnvelopeSize),
+	)
 	if err != nil {
 		_ = h.Close()
 		return nil, err
 	}
-	sub, err := blocksTopic.Subscribe()
-	if err != nil {
+
+	p.ps = ps
+	if p.blocks, p.sub, err = p.join(BlocksTopic); err != nil {
 		_ = h.Close()
 		return nil, err
 	}
-
-	p := &P2P{
-		ctx:    ctx,
-		host:   h,
-		ps:     ps,
-		blocks: blocksTopic,
-		tx:     txTopic,
-		sub:    sub,
+	if p.tx, p.txSub, err = p.join(TxTopic); err != nil {
+		_ = h.Close()
+		return nil, err
 	}
+	go p.decayPenalties()
+	go p.maintainPersistent()
+	go p.logReachability()
+	h.Network().Notify(&network.NotifyBundle{
+		DisconnectedF: func(_ network.Network, c network.Conn) {
+			p.mu.Lock()
+			delete(p.statuses, c.RemotePeer())
+			p.mu.Unlock()
+		},
+	})
 
-	log.Printf("libp2p host started: id=%s addrs=%v\n", h.ID().Pretty(), h.Addrs())
+	log.Printf("libp2p host started: id=%s addrs=%v\n", h.ID().String(), h.Addrs())
 	return p, nil
 }
 
@@ -86,7 +212,20 @@ func (p *P2P) HostID() string {
 	if p == nil || p.host == nil {
 		return ""
 	}
-	return p.host.ID().Pretty()
+	return p.host.ID().String()
+}
+
+// Addrs returns the addresses this node advertises, including external and
+// relay addresses, each ending in /p2p/<peer id>.
+func (p *P2P) Addrs() []string {
+	if p == nil || p.host == nil {
+		return nil
+	}
+	out := []string{}
+	for _, a := range p.host.Addrs() {
+		out = append(out, fmt.Sprintf("%s/p2p/%s", a, p.host.ID()))
+	}
+	return out
 }
 
 // ConnectToPeer dials a peer by multiaddr string like "/ip4/127.0.0.1/tcp/4001/p2p/Qm..."
@@ -107,7 +246,7 @@ func (p *P2P) ConnectToPeer(maddr string) error {
 	if err := p.host.Connect(ctx, *pi); err != nil {
 		return err
 	}
-	log.Printf("Connected to peer %s\n", pi.ID.Pretty())
+	log.Printf("Connected to peer %s\n", pi.ID.String())
 	return nil
 }
 
@@ -122,43 +261,103 @@ func (p *P2P) ConnectToPeers(addrs []string) {
 	}
 }
 
-// PublishBlock publishes a JSON-encoded block to the blocks topic.
-func (p *P2P) PublishBlock(v interface{}) error {
-	if p == nil || p.blocks == nil {
-		return fmt.Errorf("blocks topic not ready")
+// OnConnect calls fn in a new goroutine whenever a peer connects.
+func (p *P2P) OnConnect(fn func(peerstore.ID)) {
+	p.host.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			go fn(c.RemotePeer())
+		},
+	})
+}
+
+// join joins a gossip topic, installs the envelope validator and subscribes.
+func (p *P2P) join(name string) (*pubsub.Topic, *pubsub.Subscription, error) {
+	if err := p.ps.RegisterTopicValidator(name, p.validateTopic(name)); err != nil {
+		return nil, nil, err
 	}
-	bz, err := json.Marshal(v)
+	t, err := p.ps.Join(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	sub, err := t.Subscribe()
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, sub, nil
+}
+
+// publish wraps payload in an envelope and publishes it on topic.
+func (p *P2P) publish(t *pubsub.Topic, name string, payload []byte) error {
+	if p == nil || t == nil {
+		return fmt.Errorf("%s topic not ready", name)
+	}
+	bz, err := encodeEnvelope(topicTypes[name], p.chainID, payload, p.compress)
 	if err != nil {
 		return err
 	}
-	return p.blocks.Publish(p.ctx, bz)
+	return t.Publish(p.ctx, bz)
 }
 
-// SubscribeBlocks starts a goroutine that reads blocks from pubsub and calls the handler for each message.
-// Handler should unmarshal the message and process it.
-func (p *P2P) SubscribeBlocks(handler func(msg []byte)) {
+// subscribe starts a goroutine that calls handler with the relaying peer
+// and the decoded payload of every message received from peers that passed
+// validation.
+func (p *P2P) subscribe(sub *pubsub.Subscription, name string, handler func(from peerstore.ID, msg []byte)) {
 	go func() {
 		for {
-			msg, err := p.sub.Next(p.ctx)
+			msg, err := sub.Next(p.ctx)
 			if err != nil {
 				// context closed or subscription error
-				log.Printf("blocks sub next err: %v\n", err)
+				log.Printf("%s sub next err: %v\n", name, err)
 				return
 			}
 			// ignore our own published messages
 			if msg.ReceivedFrom == p.host.ID() {
 				continue
 			}
-			// deliver payload to handler
-			handler(msg.Data)
+			// the validator stored the decoded payload
+			if payload, ok := msg.ValidatorData.([]byte); ok {
+				handler(msg.ReceivedFrom, payload)
+			}
 		}
 	}()
 }
 
+// PublishBlock publishes an encoded block to the blocks topic.
+func (p *P2P) PublishBlock(bz []byte) error {
+	return p.publish(p.blocks, BlocksTopic, bz)
+}
+
+// SubscribeBlocks calls handler for every block received from peers that
+// passed validation. from is the peer that relayed the block, which can be
+// asked for transactions missing from a compact block.
+func (p *P2P) SubscribeBlocks(handler func(from peerstore.ID, msg []byte)) {
+	p.subscribe(p.sub, BlocksTopic, handler)
+}
+
+// PublishTx publishes an encoded transaction to the tx topic.
+func (p *P2P) PublishTx(bz []byte) error {
+	return p.publish(p.tx, TxTopic, bz)
+}
+
+// SubscribeTxs calls handler for every transaction received from peers that
+// passed validation.
+func (p *P2P) SubscribeTxs(handler func(msg []byte)) {
+	p.subscribe(p.txSub, TxTopic, func(_ peerstore.ID, msg []byte) { handler(msg) })
+}
+
 // Stop closes host and pubsub
 func (p *P2P) Stop() error {
+	if p.mdns != nil {
+		_ = p.mdns.Close()
+	}
+	if p.dht != nil {
+		_ = p.dht.Close()
+	}
 	if p.sub != nil {
-		_ = p.sub.Cancel()
+		p.sub.Cancel()
+	}
+	if p.txSub != nil {
+		p.txSub.Cancel()
 	}
 	if p.host != nil {
 		return p.host.Close()
@@ -0,0 +1,315 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+const (
+	defaultMaxInbound  = 40
+	defaultMaxOutbound = 10
+
+	// persistent peers are redialed with exponential backoff between
+	// minRedial and maxRedial
+	minRedial = 5 * time.Second
+	maxRedial = 5 * time.Minute
+)
+
+// PeerInfo describes a connected peer.
+type PeerInfo struct {
+	ID         string  `json:"id"`
+	Address    string  `json:"address"`
+	Direction  string  `json:"direction"` // "inbound" or "outbound"
+	Persistent bool    `json:"persistent"`
+	LatencyMs  float64 `json:"latency_ms"`
+	HeadHeight uint64  `json:"head_height"`
+	Score      float64 `json:"score"`
+}
+
+// accessList matches peers by id or by the IP they connect from.
+type accessList struct {
+	peers map[peerstore.ID]bool
+	nets  []*net.IPNet
+}
+
+// parseAccessList accepts peer ids, IP addresses and CIDR ranges.
+func parseAccessList(entries []string) (accessList, error) {
+	l := accessList{peers: make(map[peerstore.ID]bool)}
+	for _, e := range entries {
+		if pid, err := peerstore.Decode(e); err == nil {
+			l.peers[pid] = true
+			continue
+		}
+		if _, n, err := net.ParseCIDR(e); err == nil {
+			l.nets = append(l.nets, n)
+			continue
+		}
+		ip := net.ParseIP(e)
+		if ip == nil {
+			return l, fmt.Errorf("%q is not a peer id, IP or CIDR", e)
+		}
+		bits := 8 * len(ip)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		l.nets = append(l.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return l, nil
+}
+
+func (l accessList) empty() bool {
+	return len(l.peers) == 0 && len(l.nets) == 0
+}
+
+func (l accessList) matchPeer(pid peerstore.ID) bool {
+	return l.peers[pid]
+}
+
+func (l accessList) matchAddr(addr ma.Multiaddr) bool {
+	if addr == nil || len(l.nets) == 0 {
+		return false
+	}
+	ip, err := manet.ToIP(addr)
+	if err != nil {
+		return false
+	}
+	for _, n := range l.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type persistentPeer struct {
+	info    peerstore.AddrInfo
+	backoff time.Duration
+	next    time.Time
+}
+
+// peerManager enforces connection limits and access lists and keeps
+// persistent peers connected.
+type peerManager struct {
+	maxInbound  int
+	maxOutbound int
+	allow       accessList
+	deny        accessList
+	private     map[peerstore.ID]bool
+	privateMode bool
+
+	mu         sync.Mutex
+	persistent map[peerstore.ID]*persistentPeer
+	scores     map[peerstore.ID]float64 // last gossipsub scores
+}
+
+func newPeerManager(cfg Config) (*peerManager, error) {
+	m := &peerManager{
+		maxInbound:  cfg.MaxInbound,
+		maxOutbound: cfg.MaxOutbound,
+		private:     make(map[peerstore.ID]bool),
+		privateMode: cfg.PrivateMode,
+		persistent:  make(map[peerstore.ID]*persistentPeer),
+		scores:      make(map[peerstore.ID]float64),
+	}
+	if m.maxInbound <= 0 {
+		m.maxInbound = defaultMaxInbound
+	}
+	if m.maxOutbound <= 0 {
+		m.maxOutbound = defaultMaxOutbound
+	}
+	var err error
+	if m.allow, err = parseAccessList(cfg.AllowList); err != nil {
+		return nil, fmt.Errorf("allow list: %v", err)
+	}
+	if m.deny, err = parseAccessList(cfg.DenyList); err != nil {
+		return nil, fmt.Errorf("deny list: %v", err)
+	}
+	for _, s := range cfg.PrivatePeers {
+		pid, err := peerstore.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("private peer %s: %v", s, err)
+		}
+		m.private[pid] = true
+	}
+	if m.privateMode && len(cfg.PersistentPeers) == 0 {
+		return nil, fmt.Errorf("private mode needs persistent peers (sentries) to connect to")
+	}
+	for _, s := range cfg.PersistentPeers {
+		info, err := parseAddrInfo(s)
+		if err != nil {
+			return nil, fmt.Errorf("persistent peer %s: %v", s, err)
+		}
+		m.persistent[info.ID] = &persistentPeer{info: *info, backoff: minRedial}
+	}
+	return m, nil
+}
+
+func parseAddrInfo(s string) (*peerstore.AddrInfo, error) {
+	addr, err := ma.NewMultiaddr(s)
+	if err != nil {
+		return nil, err
+	}
+	return peerstore.AddrInfoFromP2pAddr(addr)
+}
+
+func (m *peerManager) isPersistent(pid peerstore.ID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.persistent[pid] != nil
+}
+
+// trusted reports whether pid is a persistent or private peer. Trusted
+// peers are exempt from the connection limits and access lists.
+func (m *peerManager) trusted(pid peerstore.ID) bool {
+	return m.private[pid] || m.isPersistent(pid)
+}
+
+// admits applies the access lists. In private mode only trusted peers are
+// admitted.
+func (m *peerManager) admits(pid peerstore.ID, addr ma.Multiaddr) bool {
+	if m.trusted(pid) {
+		return true
+	}
+	if m.privateMode || m.deny.matchPeer(pid) || m.deny.matchAddr(addr) {
+		return false
+	}
+	return m.allow.empty() || m.allow.matchPeer(pid) || m.allow.matchAddr(addr)
+}
+
+// connCount returns the number of distinct peers connected in direction dir.
+func (p *P2P) connCount(dir network.Direction) int {
+	if p.host == nil {
+		return 0
+	}
+	seen := make(map[peerstore.ID]bool)
+	for _, c := range p.host.Network().Conns() {
+		if c.Stat().Direction == dir {
+			seen[c.RemotePeer()] = true
+		}
+	}
+	return len(seen)
+}
+
+// AddPeer adds a persistent peer given as a multiaddr with a /p2p component
+// and dials it. The peer stays persistent even if the first dial fails.
+func (p *P2P) AddPeer(addr string) (peerstore.ID, error) {
+	info, err := parseAddrInfo(addr)
+	if err != nil {
+		return "", err
+	}
+	p.peers.mu.Lock()
+	p.peers.persistent[info.ID] = &persistentPeer{info: *info, backoff: minRedial}
+	p.peers.mu.Unlock()
+
+	p.host.Peerstore().AddAddrs(info.ID, info.Addrs, pstore.PermanentAddrTTL)
+	ctx, cancel := context.WithTimeout(p.ctx, 5*time.Second)
+	defer cancel()
+	return info.ID, p.host.Connect(ctx, *info)
+}
+
+// RemovePeer forgets a persistent peer and closes any connection to pid.
+func (p *P2P) RemovePeer(pid peerstore.ID) error {
+	p.peers.mu.Lock()
+	delete(p.peers.persistent, pid)
+	p.peers.mu.Unlock()
+	return p.host.Network().ClosePeer(pid)
+}
+
+// PeerInfos describes every connected peer except private ones.
+func (p *P2P) PeerInfos() []PeerInfo {
+	out := []PeerInfo{}
+	seen := make(map[peerstore.ID]bool)
+	for _, c := range p.host.Network().Conns() {
+		pid := c.RemotePeer()
+		if seen[pid] || p.peers.private[pid] {
+			continue
+		}
+		seen[pid] = true
+		dir := "outbound"
+		if c.Stat().Direction == network.DirInbound {
+			dir = "inbound"
+		}
+		info := PeerInfo{
+			ID:         pid.String(),
+			Address:    c.RemoteMultiaddr().String(),
+			Direction:  dir,
+			Persistent: p.peers.isPersistent(pid),
+			LatencyMs:  float64(p.host.Peerstore().LatencyEWMA(pid)) / float64(time.Millisecond),
+		}
+		if st, ok := p.PeerStatus(pid); ok {
+			info.HeadHeight = st.HeadHeight
+		}
+		p.peers.mu.Lock()
+		info.Score = p.peers.scores[pid]
+		p.peers.mu.Unlock()
+		out = append(out, info)
+	}
+	return out
+}
+
+func (p *P2P) recordScores(scores map[peerstore.ID]float64) {
+	p.peers.mu.Lock()
+	p.peers.scores = scores
+	p.peers.mu.Unlock()
+}
+
+// maintainPersistent redials disconnected persistent peers with backoff.
+func (p *P2P) maintainPersistent() {
+	ticker := time.NewTicker(minRedial)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		var due []*persistentPeer
+		p.peers.mu.Lock()
+		for pid, pp := range p.peers.persistent {
+			if p.host.Network().Connectedness(pid) == network.Connected {
+				pp.backoff = minRedial
+				continue
+			}
+			if now.After(pp.next) {
+				// no new attempt until this one has had time to finish
+				pp.next = now.Add(pp.backoff)
+				due = append(due, pp)
+			}
+		}
+		p.peers.mu.Unlock()
+
+		for _, pp := range due {
+			go p.redial(pp)
+		}
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *P2P) redial(pp *persistentPeer) {
+	ctx, cancel := context.WithTimeout(p.ctx, 5*time.Second)
+	defer cancel()
+	err := p.host.Connect(ctx, pp.info)
+
+	p.peers.mu.Lock()
+	defer p.peers.mu.Unlock()
+	if err == nil {
+		pp.backoff = minRedial
+		pp.next = time.Time{}
+		log.Printf("Reconnected to persistent peer %s", pp.info.ID)
+		return
+	}
+	if pp.backoff *= 2; pp.backoff > maxRedial {
+		pp.backoff = maxRedial
+	}
+}
@@ -0,0 +1,203 @@
+package p2p
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Validation is the outcome of checking a gossip message.
+type Validation int
+
+const (
+	// ValidationAccept delivers and forwards the message.
+	ValidationAccept Validation = iota
+	// ValidationIgnore drops the message without blaming the sender, e.g.
+	// while syncing.
+	ValidationIgnore
+	// ValidationDuplicate drops data we already have and applies a small
+	// penalty to the forwarding peer.
+	ValidationDuplicate
+	// ValidationReject drops an invalid message; gossipsub and the
+	// application score both penalise the sender.
+	ValidationReject
+)
+
+// MessageValidator checks a gossip payload received from a peer before it
+// is delivered locally or forwarded.
+type MessageValidator func(from peerstore.ID, data []byte) Validation
+
+const (
+	invalidPenalty   = 20.0
+	duplicatePenalty = 1.0
+	// penaltyDecay is applied to application penalties every minute.
+	penaltyDecay = 0.9
+
+	// peers whose gossipsub score drops below banThreshold are banned
+	banThreshold = -100.0
+	banDuration  = 24 * time.Hour
+)
+
+// SetBlockValidator registers fn for the blocks topic.
+func (p *P2P) SetBlockValidator(fn MessageValidator) {
+	p.setValidator(BlocksTopic, fn)
+}
+
+// SetTxValidator registers fn for the transactions topic.
+func (p *P2P) SetTxValidator(fn MessageValidator) {
+	p.setValidator(TxTopic, fn)
+}
+
+func (p *P2P) setValidator(topic string, fn MessageValidator) {
+	p.mu.Lock()
+	p.validators[topic] = fn
+	p.mu.Unlock()
+}
+
+// validateTopic returns the pubsub validator for topic. It unwraps the
+// envelope, hands the payload to the application validator and keeps the
+// payload as the message's ValidatorData for subscribers.
+func (p *P2P) validateTopic(topic string) pubsub.ValidatorEx {
+	want := topicTypes[topic]
+	return func(_ context.Context, from peerstore.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		env, err := decodeEnvelope(msg.Data, want, p.chainID)
+		if err != nil {
+			if from == p.host.ID() {
+				return pubsub.ValidationIgnore
+			}
+			p.penalize(from, invalidPenalty)
+			return pubsub.ValidationReject
+		}
+		msg.ValidatorData = env.Payload
+		// our own messages were checked before publishing
+		if from == p.host.ID() {
+			return pubsub.ValidationAccept
+		}
+
+		p.mu.Lock()
+		fn := p.validators[topic]
+		p.mu.Unlock()
+		if fn == nil {
+			return pubsub.ValidationAccept
+		}
+		switch fn(from, env.Payload) {
+		case ValidationAccept:
+			return pubsub.ValidationAccept
+		case ValidationDuplicate:
+			p.penalize(from, duplicatePenalty)
+			return pubsub.ValidationIgnore
+		case ValidationReject:
+			p.penalize(from, invalidPenalty)
+			return pubsub.ValidationReject
+		default:
+			return pubsub.ValidationIgnore
+		}
+	}
+}
+
+// penalties is the application-specific part of the gossipsub peer score.
+type penalties struct {
+	mu     sync.Mutex
+	scores map[peerstore.ID]float64
+}
+
+func (p *P2P) penalize(pid peerstore.ID, amount float64) {
+	p.penalties.mu.Lock()
+	p.penalties.scores[pid] += amount
+	p.penalties.mu.Unlock()
+}
+
+func (p *P2P) appScore(pid peerstore.ID) float64 {
+	p.penalties.mu.Lock()
+	defer p.penalties.mu.Unlock()
+	return -p.penalties.scores[pid]
+}
+
+func (p *P2P) decayPenalties() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		p.penalties.mu.Lock()
+		for pid, s := range p.penalties.scores {
+			if s *= penaltyDecay; s < 0.1 {
+				delete(p.penalties.scores, pid)
+			} else {
+				p.penalties.scores[pid] = s
+			}
+		}
+		p.penalties.mu.Unlock()
+	}
+}
+
+// inspectScores records the current scores and bans peers whose overall
+// score fell below banThreshold.
+func (p *P2P) inspectScores(scores map[peerstore.ID]float64) {
+	p.recordScores(scores)
+	for pid, s := range scores {
+		if s < banThreshold && !p.bans.Contains(pid) {
+			log.Printf("banning peer %s (score %.1f)", pid, s)
+			p.Ban(pid, banDuration)
+		}
+	}
+}
+
+// Ban disconnects pid and refuses connections and messages from it for d.
+// Bans are persisted if a ban file is configured.
+func (p *P2P) Ban(pid peerstore.ID, d time.Duration) {
+	p.bans.ban(pid, time.Now().Add(d))
+	_ = p.host.Network().ClosePeer(pid)
+}
+
+func peerScoreParams(appScore func(peerstore.ID) float64) *pubsub.PeerScoreParams {
+	topic := func(weight float64) *pubsub.TopicScoreParams {
+		return &pubsub.TopicScoreParams{
+			TopicWeight: weight,
+
+			TimeInMeshWeight:  0.01,
+			TimeInMeshQuantum: time.Second,
+			TimeInMeshCap:     3600,
+
+			FirstMessageDeliveriesWeight: 1,
+			FirstMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+			FirstMessageDeliveriesCap:    50,
+
+			// P4 grows with the square of invalid deliveries, so a few bad
+			// blocks are enough to cross the graylist threshold
+			InvalidMessageDeliveriesWeight: -20,
+			InvalidMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+		}
+	}
+	return &pubsub.PeerScoreParams{
+		Topics: map[string]*pubsub.TopicScoreParams{
+			BlocksTopic: topic(1),
+			TxTopic:     topic(0.5),
+		},
+		AppSpecificScore:  appScore,
+		AppSpecificWeight: 1,
+
+		BehaviourPenaltyWeight:    -1,
+		BehaviourPenaltyThreshold: 6,
+		BehaviourPenaltyDecay:     pubsub.ScoreParameterDecay(time.Hour),
+
+		DecayInterval: time.Second,
+		DecayToZero:   0.01,
+		RetainScore:   time.Hour,
+	}
+}
+
+var peerScoreThresholds = &pubsub.PeerScoreThresholds{
+	GossipThreshold:             -10,
+	PublishThreshold:            -50,
+	GraylistThreshold:           -80,
+	AcceptPXThreshold:           20,
+	OpportunisticGraftThreshold: 5,
+}
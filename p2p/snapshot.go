@@ -0,0 +1,84 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// SnapshotProtocol serves state snapshot manifests and chunks.
+const SnapshotProtocol = protocol.ID("/graphene/snapshot/1")
+
+const (
+	maxSnapshotRequest  = 1 << 10
+	maxSnapshotResponse = 32 << 20
+)
+
+// SnapshotProvider is implemented by the local snapshot store. Manifests and
+// chunks are opaque to p2p.
+type SnapshotProvider interface {
+	Manifests() ([][]byte, error)
+	Chunk(height uint64, index uint32) ([]byte, error)
+}
+
+type snapshotRequest struct {
+	Op     string `json:"op"` // "manifests" or "chunk"
+	Height uint64 `json:"height,omitempty"`
+	Index  uint32 `json:"index,omitempty"`
+}
+
+type snapshotResponse struct {
+	Manifests [][]byte `json:"manifests,omitempty"`
+	Chunk     []byte   `json:"chunk,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// ServeSnapshots answers snapshot requests from peers using sp.
+func (p *P2P) ServeSnapshots(sp SnapshotProvider) {
+	p.serve(SnapshotProtocol, maxSnapshotRequest,
+		func() interface{} { return new(snapshotRequest) },
+		func(_ peerstore.ID, v interface{}) interface{} {
+			req := v.(*snapshotRequest)
+			var resp snapshotResponse
+			var err error
+			switch req.Op {
+			case "manifests":
+				resp.Manifests, err = sp.Manifests()
+			case "chunk":
+				resp.Chunk, err = sp.Chunk(req.Height, req.Index)
+			default:
+				err = fmt.Errorf("unknown op %q", req.Op)
+			}
+			if err != nil {
+				resp.Error = err.Error()
+			}
+			return &resp
+		})
+}
+
+// FetchSnapshotManifests asks pid for the manifests of the snapshots it serves.
+func (p *P2P) FetchSnapshotManifests(ctx context.Context, pid peerstore.ID) ([][]byte, error) {
+	var resp snapshotResponse
+	if err := p.request(ctx, pid, SnapshotProtocol, &snapshotRequest{Op: "manifests"}, &resp, maxSnapshotResponse); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("peer %s: %s", pid, resp.Error)
+	}
+	return resp.Manifests, nil
+}
+
+// FetchSnapshotChunk downloads chunk index of the snapshot at height from pid.
+func (p *P2P) FetchSnapshotChunk(ctx context.Context, pid peerstore.ID, height uint64, index uint32) ([]byte, error) {
+	var resp snapshotResponse
+	req := &snapshotRequest{Op: "chunk", Height: height, Index: index}
+	if err := p.request(ctx, pid, SnapshotProtocol, req, &resp, maxSnapshotResponse); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("peer %s: %s", pid, resp.Error)
+	}
+	return resp.Chunk, nil
+}
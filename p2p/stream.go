@@ -0,0 +1,100 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// streamTimeout bounds a single request/response exchange.
+const streamTimeout = 30 * time.Second
+
+// writeMsg writes v as a uvarint length-prefixed JSON message.
+func writeMsg(w io.Writer, v interface{}) error {
+	bz, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(bz)))
+	if _, err := w.Write(lenBuf[:n]); err != nil {
+		return err
+	}
+	_, err = w.Write(bz)
+	return err
+}
+
+// readMsg reads a message written by writeMsg, refusing anything larger than max bytes.
+func readMsg(r *bufio.Reader, v interface{}, max int) error {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if size > uint64(max) {
+		return fmt.Errorf("message of %d bytes exceeds limit of %d", size, max)
+	}
+	bz := make([]byte, size)
+	if _, err := io.ReadFull(r, bz); err != nil {
+		return err
+	}
+	return json.Unmarshal(bz, v)
+}
+
+// request opens a stream to pid, sends req and decodes a single response.
+func (p *P2P) request(ctx context.Context, pid peerstore.ID, proto protocol.ID, req, resp interface{}, max int) error {
+	if p == nil || p.host == nil {
+		return fmt.Errorf("p2p host not initialized")
+	}
+	ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+	defer cancel()
+	s, err := p.host.NewStream(ctx, pid, proto)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.SetDeadline(deadline)
+	}
+	if err := writeMsg(s, req); err != nil {
+		_ = s.Reset()
+		return err
+	}
+	if err := s.CloseWrite(); err != nil {
+		_ = s.Reset()
+		return err
+	}
+	return readMsg(bufio.NewReader(s), resp, max)
+}
+
+// serve registers a handler for proto that decodes one request into the value
+// returned by newReq and writes back whatever handle returns.
+func (p *P2P) serve(proto protocol.ID, maxReq int, newReq func() interface{}, handle func(peerstore.ID, interface{}) interface{}) {
+	p.host.SetStreamHandler(proto, func(s network.Stream) {
+		defer s.Close()
+		_ = s.SetDeadline(time.Now().Add(streamTimeout))
+		req := newReq()
+		if err := readMsg(bufio.NewReader(s), req, maxReq); err != nil {
+			_ = s.Reset()
+			return
+		}
+		if err := writeMsg(s, handle(s.Conn().RemotePeer(), req)); err != nil {
+			_ = s.Reset()
+		}
+	})
+}
+
+// Peers returns the currently connected peers.
+func (p *P2P) Peers() []peerstore.ID {
+	if p == nil || p.host == nil {
+		return nil
+	}
+	return p.host.Network().Peers()
+}
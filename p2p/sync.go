@@ -0,0 +1,152 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// SyncProtocol carries status handshakes and header/block range requests.
+const SyncProtocol = protocol.ID("/graphene/sync/1")
+
+// MaxSyncBatch is the most headers or blocks served per request.
+const MaxSyncBatch = 128
+
+const (
+	maxSyncRequest  = 4 << 10
+	maxSyncResponse = 32 << 20
+)
+
+// SyncStatus is exchanged in the handshake so peers can tell whether they
+// share a chain and who is ahead.
+type SyncStatus struct {
+	GenesisHash []byte `json:"genesis_hash"`
+	HeadHeight  uint64 `json:"head_height"`
+	HeadHash    []byte `json:"head_hash"`
+}
+
+// ChainProvider serves the local chain to syncing peers. Headers and blocks
+// are JSON encoded by the provider and opaque to p2p.
+type ChainProvider interface {
+	SyncStatus() SyncStatus
+	HeadersRange(from uint64, count int) ([]json.RawMessage, error)
+	BlocksRange(from uint64, count int) ([]json.RawMessage, error)
+}
+
+type syncRequest struct {
+	Op     string      `json:"op"` // "status", "headers" or "blocks"
+	Status *SyncStatus `json:"status,omitempty"`
+	From   uint64      `json:"from,omitempty"`
+	Count  int         `json:"count,omitempty"`
+}
+
+type syncResponse struct {
+	Status *SyncStatus       `json:"status,omitempty"`
+	Items  []json.RawMessage `json:"items,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// ServeSync answers sync requests from peers using cp, which also supplies
+// the local status sent in our own handshakes.
+func (p *P2P) ServeSync(cp ChainProvider) {
+	p.chain = cp
+	p.serve(SyncProtocol, maxSyncRequest,
+		func() interface{} { return new(syncRequest) },
+		func(pid peerstore.ID, v interface{}) interface{} {
+			req := v.(*syncRequest)
+			var resp syncResponse
+			var err error
+			switch req.Op {
+			case "status":
+				local := cp.SyncStatus()
+				resp.Status = &local
+				if req.Status == nil {
+					err = fmt.Errorf("missing status")
+				} else if !bytes.Equal(req.Status.GenesisHash, local.GenesisHash) {
+					err = fmt.Errorf("genesis mismatch")
+				} else {
+					p.setPeerStatus(pid, *req.Status)
+				}
+			case "headers":
+				resp.Items, err = cp.HeadersRange(req.From, clampBatch(req.Count))
+			case "blocks":
+				resp.Items, err = cp.BlocksRange(req.From, clampBatch(req.Count))
+			default:
+				err = fmt.Errorf("unknown op %q", req.Op)
+			}
+			if err != nil {
+				resp.Error = err.Error()
+			}
+			return &resp
+		})
+}
+
+func clampBatch(n int) int {
+	if n <= 0 || n > MaxSyncBatch {
+		return MaxSyncBatch
+	}
+	return n
+}
+
+// Handshake exchanges sync status with pid and returns the peer's status.
+// It fails if the peer is on a different genesis.
+func (p *P2P) Handshake(ctx context.Context, pid peerstore.ID) (*SyncStatus, error) {
+	if p.chain == nil {
+		return nil, fmt.Errorf("sync not served")
+	}
+	local := p.chain.SyncStatus()
+	var resp syncResponse
+	if err := p.request(ctx, pid, SyncProtocol, &syncRequest{Op: "status", Status: &local}, &resp, maxSyncResponse); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("peer %s: %s", pid, resp.Error)
+	}
+	if resp.Status == nil {
+		return nil, fmt.Errorf("peer %s: empty status", pid)
+	}
+	if !bytes.Equal(resp.Status.GenesisHash, local.GenesisHash) {
+		return nil, fmt.Errorf("peer %s: genesis mismatch", pid)
+	}
+	p.setPeerStatus(pid, *resp.Status)
+	return resp.Status, nil
+}
+
+// FetchHeaders requests up to count headers starting at height from.
+func (p *P2P) FetchHeaders(ctx context.Context, pid peerstore.ID, from uint64, count int) ([]json.RawMessage, error) {
+	return p.fetchRange(ctx, pid, "headers", from, count)
+}
+
+// FetchBlocks requests up to count full blocks starting at height from.
+func (p *P2P) FetchBlocks(ctx context.Context, pid peerstore.ID, from uint64, count int) ([]json.RawMessage, error) {
+	return p.fetchRange(ctx, pid, "blocks", from, count)
+}
+
+func (p *P2P) fetchRange(ctx context.Context, pid peerstore.ID, op string, from uint64, count int) ([]json.RawMessage, error) {
+	var resp syncResponse
+	if err := p.request(ctx, pid, SyncProtocol, &syncRequest{Op: op, From: from, Count: count}, &resp, maxSyncResponse); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("peer %s: %s", pid, resp.Error)
+	}
+	return resp.Items, nil
+}
+
+// PeerStatus returns the last status seen from pid.
+func (p *P2P) PeerStatus(pid peerstore.ID) (SyncStatus, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st, ok := p.statuses[pid]
+	return st, ok
+}
+
+func (p *P2P) setPeerStatus(pid peerstore.ID, st SyncStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.statuses[pid] = st
+}
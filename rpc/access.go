@@ -0,0 +1,235 @@
+package rpc
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Namespaces group RPC methods for access control. Graphene.* methods fall
+// into graphene or admin; the eth endpoint and the WebSocket
+// endpoint are namespaces of their own.
+const (
+	NamespaceGraphene = "graphene"
+	NamespaceAdmin    = "admin"
+	NamespaceEth      = "eth"
+	NamespaceWS       = "ws"
+)
+
+// Access levels for a namespace.
+const (
+	AccessPublic = "public"
+	AccessLocal  = "local" // loopback clients only
+	AccessOff    = "off"
+)
+
+// methodNamespaces lists the Graphene methods outside the graphene
+// namespace: peer management.
+var methodNamespaces = map[string]string{
+	"Graphene.Peers":      NamespaceAdmin,
+	"Graphene.AddPeer":    NamespaceAdmin,
+	"Graphene.RemovePeer": NamespaceAdmin,
+}
+
+// DefaultNamespaces returns the default access level of each namespace.
+func DefaultNamespaces() map[string]string {
+	return map[string]string{
+		NamespaceGraphene: AccessPublic,
+		NamespaceAdmin:    AccessLocal,
+		NamespaceEth:      AccessPublic,
+		NamespaceWS:       AccessPublic,
+	}
+}
+
+// methodNamespace returns the namespace of a Graphene method.
+func methodNamespace(method string) string {
+	if ns, ok := methodNamespaces[method]; ok {
+		return ns
+	}
+	return NamespaceGraphene
+}
+
+type accessPolicy struct {
+	namespaces map[string]string
+	apiKeys    [][]byte
+	jwtSecret  []byte
+	origins    []string
+}
+
+func newAccessPolicy(cfg Config) (*accessPolicy, error) {
+	p := &accessPolicy{namespaces: DefaultNamespaces(), origins: cfg.CORSOrigins}
+	for ns, level := range cfg.Namespaces {
+		if _, ok := p.namespaces[ns]; !ok {
+			return nil, fmt.Errorf("unknown rpc namespace %q", ns)
+		}
+		switch level {
+		case AccessPublic, AccessLocal, AccessOff:
+		default:
+			return nil, fmt.Errorf("rpc namespace %s: unknown access level %q", ns, level)
+		}
+		p.namespaces[ns] = level
+	}
+	for _, k := range cfg.APIKeys {
+		if k == "" {
+			return nil, fmt.Errorf("empty rpc api key")
+		}
+		p.apiKeys = append(p.apiKeys, []byte(k))
+	}
+	if cfg.JWTSecretFile != "" {
+		secret, err := readJWTSecret(cfg.JWTSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		p.jwtSecret = secret
+	}
+	return p, nil
+}
+
+// readJWTSecret reads a hex encoded secret of at least 32 bytes.
+func readJWTSecret(path string) ([]byte, error) {
+	bz, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(bz)), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("jwt secret %s: %v", path, err)
+	}
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("jwt secret %s: need at least 32 bytes, got %d", path, len(secret))
+	}
+	return secret, nil
+}
+
+// check reports whether r may use namespace ns, or the HTTP status and
+// message to reject it with.
+func (p *accessPolicy) check(ns string, r *http.Request) (int, string) {
+	if !p.authenticated(ns, r) {
+		return http.StatusUnauthorized, "rpc: missing or invalid credentials"
+	}
+	switch p.namespaces[ns] {
+	case AccessPublic:
+		return 0, ""
+	case AccessLocal:
+		if isLoopback(r) {
+			return 0, ""
+		}
+		return http.StatusForbidden, fmt.Sprintf("rpc: %s namespace is only available on localhost", ns)
+	default:
+		return http.StatusForbidden, fmt.Sprintf("rpc: %s namespace is disabled", ns)
+	}
+}
+
+func (p *accessPolicy) reject(w http.ResponseWriter, status int, msg string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	http.Error(w, msg, status)
+}
+
+// guard applies the policy of namespace ns to every request.
+func (p *accessPolicy) guard(ns string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status, msg := p.check(ns, r); status != 0 {
+			p.reject(w, status, msg)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticated reports whether r carries a configured API key or a JWT
+// signed with the configured secret. Without either, no credentials are
+// needed. Credentials go in an "Authorization: Bearer" or X-API-Key
+// header. Browser WebSocket clients cannot set headers, so /ws also
+// takes a token query parameter; elsewhere it would end up in access logs
+// and browser history.
+func (p *accessPolicy) authenticated(ns string, r *http.Request) bool {
+	if len(p.apiKeys) == 0 && p.jwtSecret == nil {
+		return true
+	}
+	tok := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); tok == "" && len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		tok = strings.TrimSpace(auth[7:])
+	}
+	if tok == "" && ns == NamespaceWS {
+		tok = r.URL.Query().Get("token")
+	}
+	if tok == "" {
+		return false
+	}
+	for _, k := range p.apiKeys {
+		if subtle.ConstantTimeCompare(k, []byte(tok)) == 1 {
+			return true
+		}
+	}
+	return p.jwtSecret != nil && p.validJWT(tok)
+}
+
+// validJWT accepts unexpired HS256 tokens signed with the secret. exp is
+// required so a leaked token does not stay valid forever; nbf and iat are
+// checked when present.
+func (p *accessPolicy) validJWT(tok string) bool {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(tok, &claims, func(*jwt.Token) (interface{}, error) {
+		return p.jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	return err == nil && claims.ExpiresAt != nil
+}
+
+// cors answers preflight requests and adds CORS headers for allowed
+// origins.
+func (p *accessPolicy) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" && p.originAllowed(origin) {
+			h := w.Header()
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Add("Vary", "Origin")
+			if r.Method == http.MethodOptions {
+				h.Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
+				h.Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
+				h.Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *accessPolicy) originAllowed(origin string) bool {
+	for _, o := range p.origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin admits WebSocket handshakes from non-browser clients, from
+// pages served by this host and from the CORS origins.
+func (p *accessPolicy) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || p.originAllowed(origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func isLoopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
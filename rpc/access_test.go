@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestAuthentication(t *testing.T) {
+	secret := []byte(strings.Repeat("s", 32))
+	file := filepath.Join(t.TempDir(), "jwt.hex")
+	if err := os.WriteFile(file, []byte(hex.EncodeToString(secret)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler(t, Config{APIKeys: []string{"key1"}, JWTSecretFile: file})
+
+	token := func(key []byte, method jwt.SigningMethod, claims jwt.RegisteredClaims) string {
+		tok, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	later := jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+	expired := jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))}
+	noExp := jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(time.Now())}
+	for _, tc := range []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"no credentials", nil, http.StatusUnauthorized},
+		{"api key", map[string]string{"X-API-Key": "key1"}, http.StatusOK},
+		{"api key as bearer", map[string]string{"Authorization": "Bearer key1"}, http.StatusOK},
+		{"wrong api key", map[string]string{"X-API-Key": "key2"}, http.StatusUnauthorized},
+		{"jwt", map[string]string{"Authorization": "Bearer " + token(secret, jwt.SigningMethodHS256, later)}, http.StatusOK},
+		{"jwt with another secret", map[string]string{"Authorization": "Bearer " + token([]byte(strings.Repeat("x", 32)), jwt.SigningMethodHS256, later)}, http.StatusUnauthorized},
+		{"jwt with another method", map[string]string{"Authorization": "Bearer " + token(secret, jwt.SigningMethodHS512, later)}, http.StatusUnauthorized},
+		{"expired jwt", map[string]string{"Authorization": "Bearer " + token(secret, jwt.SigningMethodHS256, expired)}, http.StatusUnauthorized},
+		{"jwt without exp", map[string]string{"Authorization": "Bearer " + token(secret, jwt.SigningMethodHS256, noExp)}, http.StatusUnauthorized},
+	} {
+		w := post(h, "203.0.113.7:4000", echoCall(1), tc.header)
+		if w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.want)
+		}
+		if tc.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s: no WWW-Authenticate header", tc.name)
+		}
+	}
+}
+
+func TestTokenQueryParameter(t *testing.T) {
+	policy, err := newAccessPolicy(Config{APIKeys: []string{"key1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only WebSocket handshakes, which cannot carry headers from a
+	// browser, take the token from the URL
+	r := httptest.NewRequest(http.MethodGet, "/ws?token=key1", nil)
+	if !policy.authenticated(NamespaceWS, r) {
+		t.Error("token refused on /ws")
+	}
+	r = httptest.NewRequest(http.MethodPost, "/rpc?token=key1", strings.NewReader(echoCall(1)))
+	if policy.authenticated(NamespaceGraphene, r) {
+		t.Error("token accepted outside /ws")
+	}
+	h := newTestHandler(t, Config{APIKeys: []string{"key1"}})
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("call with a token parameter: status %d", w.Code)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	h := newTestHandler(t, Config{CORSOrigins: []string{"https://app.example"}, APIKeys: []string{"key1"}})
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodOptions, "/rpc", nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// preflights carry no credentials, so they are answered before the
+	// access checks
+	w := preflight("https://APP.example")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://APP.example" {
+		t.Fatalf("allowed origin: status %d, headers %v", w.Code, w.Header())
+	}
+	if !strings.Contains(w.Header().Get("Access-Control-Allow-Headers"), "Authorization") {
+		t.Fatalf("Authorization not allowed: %v", w.Header())
+	}
+
+	w = preflight("https://evil.example")
+	if w.Code == http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("other origin: status %d, headers %v", w.Code, w.Header())
+	}
+
+	w = post(h, "203.0.113.7:4000", echoCall(1), map[string]string{"Origin": "https://app.example", "X-API-Key": "key1"})
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example" {
+		t.Fatalf("call: status %d, headers %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,270 @@
+package rpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/version"
+)
+
+// EthChainID derives the numeric chain id reported by eth_chainId from the
+// chain id string when none is configured. It fits in 32 bits, which keeps
+// wallets happy.
+func EthChainID(chainID string) uint64 {
+	sum := sha256.Sum256([]byte(chainID))
+	return uint64(binary.BigEndian.Uint32(sum[:4]))
+}
+
+// newEthServer builds the JSON-RPC 2.0 server for the eth_, net_ and web3_
+// namespaces.
+func newEthServer(cons *consensus.Consensus, chainID uint64) (*gethrpc.Server, error) {
+	srv := gethrpc.NewServer()
+	apis := map[string]interface{}{
+		"eth":  &EthAPI{cons: cons, chainID: chainID},
+		"net":  &NetAPI{chainID: chainID},
+		"web3": &Web3API{},
+	}
+	for name, api := range apis {
+		if err := srv.RegisterName(name, api); err != nil {
+			return nil, err
+		}
+	}
+	return srv, nil
+}
+
+// EthAPI implements the read-only subset of the eth_ namespace. Blocks and
+// transactions are mapped onto Ethereum's JSON shapes; fields without a
+// Graphene equivalent (uncles, bloom) are zero.
+type EthAPI struct {
+	cons    *consensus.Consensus
+	chainID uint64
+}
+
+func (e *EthAPI) ChainId() hexutil.Uint64 {
+	return hexutil.Uint64(e.chainID)
+}
+
+func (e *EthAPI) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(e.cons.Head().Number)
+}
+
+func (e *EthAPI) GetBlockByNumber(_ context.Context, number gethrpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
+	b := e.blockAt(number)
+	if b == nil {
+		return nil, nil
+	}
+	return ethBlock(b, e.cons.Params().BlockGasLimit, fullTx), nil
+}
+
+func (e *EthAPI) GetBlockByHash(_ context.Context, hash common.Hash, fullTx bool) (map[string]interface{}, error) {
+	b := e.cons.BlockByHash(hash.Bytes())
+	if b == nil {
+		return nil, nil
+	}
+	return ethBlock(b, e.cons.Params().BlockGasLimit, fullTx), nil
+}
+
+// GetBalance returns the balance of address. Only the current state is
+// kept, so any block other than the head is rejected.
+func (e *EthAPI) GetBalance(_ context.Context, address string, at gethrpc.BlockNumberOrHash) (*hexutil.Big, error) {
+	head := e.cons.Head()
+	if n, ok := at.Number(); ok && n >= 0 && uint64(n) != head.Number {
+		return nil, fmt.Errorf("state at block %d is not available", n)
+	}
+	if h, ok := at.Hash(); ok && h != common.BytesToHash(head.Hash) {
+		return nil, fmt.Errorf("state at block %s is not available", h)
+	}
+	if err := normalizeAddrs(&address); err != nil {
+		return nil, err
+	}
+	bal, err := e.cons.GetBalance(address)
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(new(big.Int).SetUint64(bal)), nil
+}
+
+func (e *EthAPI) GetTransactionByHash(_ context.Context, hash common.Hash) (map[string]interface{}, error) {
+	lk, ok := e.cons.FindTx(hash.Bytes())
+	if !ok {
+		return nil, nil
+	}
+	return ethTx(lk), nil
+}
+
+// GetTransactionReceipt reports the status and gas of a committed
+// transaction. Graphene logs have no Ethereum form and are left out; use
+// Graphene.GetLogs.
+func (e *EthAPI) GetTransactionReceipt(_ context.Context, hash common.Hash) (map[string]interface{}, error) {
+	lk, ok := e.cons.FindTx(hash.Bytes())
+	if !ok || lk.Block == nil {
+		return nil, nil
+	}
+	receipts := e.cons.BlockReceipts(lk.Block.Number)
+	if lk.Index >= len(receipts) {
+		return nil, nil
+	}
+	var cumulative uint64
+	for _, r := range receipts[:lk.Index+1] {
+		cumulative += r.GasUsed
+	}
+	rcpt := receipts[lk.Index]
+	status := ethtypes.ReceiptStatusFailed
+	if rcpt.Success {
+		status = ethtypes.ReceiptStatusSuccessful
+	}
+	return map[string]interface{}{
+		"transactionHash":   common.BytesToHash(lk.Tx.Hash()),
+		"transactionIndex":  hexutil.Uint64(lk.Index),
+		"blockHash":         common.BytesToHash(lk.Block.Hash),
+		"blockNumber":       hexutil.Uint64(lk.Block.Number),
+		"from":              lk.Tx.From,
+		"to":                ethTo(lk.Tx.To),
+		"cumulativeGasUsed": hexutil.Uint64(cumulative),
+		"gasUsed":           hexutil.Uint64(rcpt.GasUsed),
+		"effectiveGasPrice": hexutil.Uint64(lk.Tx.GasPrice(lk.Block.BaseFee)),
+		"contractAddress":   nil,
+		"logs":              []interface{}{},
+		"logsBloom":         ethtypes.Bloom{},
+		"status":            hexutil.Uint64(status),
+		"type":              hexutil.Uint64(ethtypes.DynamicFeeTxType),
+	}, nil
+}
+
+// blockAt resolves a block number tag. Blocks are final as soon as they
+// are committed, so latest, safe and finalized are all the head.
+func (e *EthAPI) blockAt(n gethrpc.BlockNumber) *consensus.Block {
+	switch n {
+	case gethrpc.LatestBlockNumber, gethrpc.PendingBlockNumber, gethrpc.SafeBlockNumber, gethrpc.FinalizedBlockNumber:
+		return e.cons.Head()
+	}
+	if n < 0 {
+		return nil
+	}
+	return e.cons.BlockByNumber(uint64(n))
+}
+
+func ethBlock(b *consensus.Block, gasLimit uint64, fullTx bool) map[string]interface{} {
+	txs := make([]interface{}, 0, len(b.Txns))
+	size := 0
+	for i, raw := range b.Txns {
+		size += len(raw)
+		lk, err := txLookup(b, i)
+		if err != nil {
+			continue
+		}
+		if fullTx {
+			txs = append(txs, ethTx(lk))
+		} else {
+			txs = append(txs, common.BytesToHash(lk.Tx.Hash()))
+		}
+	}
+	return map[string]interface{}{
+		"number":           hexutil.Uint64(b.Number),
+		"hash":             common.BytesToHash(b.Hash),
+		"parentHash":       common.BytesToHash(b.Prev),
+		"timestamp":        hexutil.Uint64(b.Time),
+		"miner":            ethAddress(b.Proposer),
+		"stateRoot":        common.BytesToHash(b.StateRoot),
+		"transactionsRoot": common.BytesToHash(consensus.TxRoot(b.Txns)),
+		"receiptsRoot":     common.BytesToHash(b.ReceiptsRoot),
+		"sha3Uncles":       ethtypes.EmptyUncleHash,
+		"uncles":           []common.Hash{},
+		"logsBloom":        ethtypes.Bloom{},
+		"difficulty":       (*hexutil.Big)(new(big.Int)),
+		"totalDifficulty":  (*hexutil.Big)(new(big.Int)),
+		"extraData":        hexutil.Bytes{},
+		"nonce":            ethtypes.BlockNonce{},
+		"mixHash":          common.Hash{},
+		"gasLimit":         hexutil.Uint64(gasLimit),
+		"gasUsed":          hexutil.Uint64(b.GasUsed),
+		"baseFeePerGas":    (*hexutil.Big)(new(big.Int).SetUint64(b.BaseFee)),
+		"size":             hexutil.Uint64(size),
+		"transactions":     txs,
+	}
+}
+
+func txLookup(b *consensus.Block, i int) (*consensus.TxLookup, error) {
+	tx, err := core.DecodeTx(b.Txns[i])
+	if err != nil {
+		return nil, err
+	}
+	return &consensus.TxLookup{Tx: tx, Raw: b.Txns[i], Block: b, Index: i}, nil
+}
+
+func ethTx(lk *consensus.TxLookup) map[string]interface{} {
+	tx := lk.Tx
+	out := map[string]interface{}{
+		"hash":                 common.BytesToHash(tx.Hash()),
+		"nonce":                hexutil.Uint64(tx.Nonce),
+		"blockHash":            nil,
+		"blockNumber":          nil,
+		"transactionIndex":     nil,
+		"from":                 tx.From,
+		"to":                   ethTo(tx.To),
+		"value":                (*hexutil.Big)(new(big.Int).SetUint64(tx.Amount)),
+		"gas":                  hexutil.Uint64(tx.Gas()),
+		"gasPrice":             (*hexutil.Big)(new(big.Int).SetUint64(tx.MaxFee)),
+		"maxFeePerGas":         (*hexutil.Big)(new(big.Int).SetUint64(tx.MaxFee)),
+		"maxPriorityFeePerGas": (*hexutil.Big)(new(big.Int).SetUint64(tx.Tip)),
+		"input":                hexutil.Bytes{},
+		"type":                 hexutil.Uint64(ethtypes.DynamicFeeTxType),
+		// Graphene transaction type, e.g. "transfer" or "delegate"
+		"grapheneType": tx.Type,
+	}
+	if len(tx.Signature) == 65 {
+		out["r"] = (*hexutil.Big)(new(big.Int).SetBytes(tx.Signature[:32]))
+		out["s"] = (*hexutil.Big)(new(big.Int).SetBytes(tx.Signature[32:64]))
+		out["v"] = hexutil.Uint64(tx.Signature[64])
+	}
+	if lk.Block != nil {
+		// included transactions report the price they actually paid
+		out["gasPrice"] = (*hexutil.Big)(new(big.Int).SetUint64(tx.GasPrice(lk.Block.BaseFee)))
+		out["blockHash"] = common.BytesToHash(lk.Block.Hash)
+		out["blockNumber"] = hexutil.Uint64(lk.Block.Number)
+		out["transactionIndex"] = hexutil.Uint64(lk.Index)
+	}
+	return out
+}
+
+// ethTo maps an empty recipient to null, as for contract creations.
+func ethTo(to string) interface{} {
+	if to == "" {
+		return nil
+	}
+	return to
+}
+
+// ethAddress returns addr as an address if it is one, else the zero address.
+func ethAddress(addr string) common.Address {
+	if common.IsHexAddress(addr) {
+		return common.HexToAddress(addr)
+	}
+	return common.Address{}
+}
+
+type NetAPI struct {
+	chainID uint64
+}
+
+// Version returns the network id, which equals the chain id.
+func (n *NetAPI) Version() string {
+	return strconv.FormatUint(n.chainID, 10)
+}
+
+type Web3API struct{}
+
+func (w *Web3API) ClientVersion() string {
+	return version.ClientVersion()
+}
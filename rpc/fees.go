@@ -0,0 +1,91 @@
+package rpc
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/rockandcode4/graphene-proto/core"
+)
+
+const (
+	// feeHistoryBlocks is how many recent blocks the suggested tip is
+	// taken from.
+	feeHistoryBlocks = 20
+	// defaultTip is suggested when recent blocks have no transactions.
+	defaultTip = 1
+)
+
+type FeeEstimateArgs struct {
+	Type string `json:"type"` // optional; prices a transaction of this type
+}
+
+type FeeEstimateReply struct {
+	Height        uint64 `json:"height"`
+	BaseFee       uint64 `json:"base_fee"` // of the next block
+	MinBaseFee    uint64 `json:"min_base_fee"`
+	BlockGasLimit uint64 `json:"block_gas_limit"`
+	GasTarget     uint64 `json:"gas_target"`
+	HeadGasUsed   uint64 `json:"head_gas_used"`
+	// Tip is the median tip per gas paid in recent blocks. MaxFee leaves
+	// room for the base fee to double.
+	Tip    uint64            `json:"tip"`
+	MaxFee uint64            `json:"max_fee"`
+	Gas    map[string]uint64 `json:"gas"`           // per transaction type
+	Fee    uint64            `json:"fee,omitempty"` // for Type, at base_fee + tip
+}
+
+// FeeEstimate reports the base fee of the next block and suggests a tip and
+// max fee per gas.
+func (a *API) FeeEstimate(r *http.Request, args *FeeEstimateArgs, reply *FeeEstimateReply) error {
+	gas := map[string]uint64{}
+	for _, t := range []string{core.TxTransfer, core.TxStake, core.TxDelegate, core.TxUndelegate} {
+		gas[t] = core.GasCost(t)
+	}
+	if args.Type != "" && gas[args.Type] == 0 {
+		return fmt.Errorf("unknown tx type %q", args.Type)
+	}
+	params := a.cons.Params()
+	head := a.cons.Head()
+	base := params.NextBaseFee(head)
+	*reply = FeeEstimateReply{
+		Height:        head.Number,
+		BaseFee:       base,
+		MinBaseFee:    params.MinBaseFee,
+		BlockGasLimit: params.BlockGasLimit,
+		GasTarget:     params.GasTarget(),
+		HeadGasUsed:   head.GasUsed,
+		Tip:           a.suggestTip(head.Number),
+		Gas:           gas,
+	}
+	reply.MaxFee = 2*base + reply.Tip
+	if args.Type != "" {
+		reply.Fee = gas[args.Type] * (base + reply.Tip)
+	}
+	return nil
+}
+
+// suggestTip returns the median tip per gas of the transactions in the
+// blocks up to head.
+func (a *API) suggestTip(head uint64) uint64 {
+	var tips []uint64
+	for n := head; n > 0 && head-n < feeHistoryBlocks; n-- {
+		b := a.cons.BlockByNumber(n)
+		if b == nil {
+			break
+		}
+		for _, raw := range b.Txns {
+			if tx, err := core.DecodeTx(raw); err == nil {
+				tips = append(tips, tx.EffectiveTip(b.BaseFee))
+			}
+		}
+	}
+	if len(tips) == 0 {
+		return defaultTip
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i] < tips[j] })
+	if tip := tips[len(tips)/2]; tip > 0 {
+		return tip
+	}
+	return defaultTip
+}
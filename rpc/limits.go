@@ -0,0 +1,361 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	gorpc "github.com/gorilla/rpc"
+)
+
+// Defaults for the request limits in Config.
+const (
+	DefaultMaxBodyBytes   = 1 << 20
+	DefaultRequestTimeout = 30 * time.Second
+	DefaultMaxConcurrent  = 64
+	DefaultMaxBatchSize   = 100
+)
+
+// JSON-RPC 2.0 error codes used by the eth endpoint.
+const (
+	errCodeInvalidRequest = -32600
+	errCodeLimitExceeded  = -32005
+)
+
+// limiter enforces the per-client rate limit, body size, batch size and
+// per-method concurrency limits.
+type limiter struct {
+	maxBody  int64
+	maxBatch int
+	rate     *rateLimiter // nil when rate limiting is off
+
+	defaultConcurrent int
+	concurrent        map[string]int
+
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+func newLimiter(cfg Config) *limiter {
+	l := &limiter{
+		maxBody:           cfg.MaxBodyBytes,
+		maxBatch:          cfg.MaxBatchSize,
+		defaultConcurrent: cfg.MaxConcurrent,
+		concurrent:        cfg.MethodConcurrency,
+		inFlight:          make(map[string]int),
+	}
+	if l.maxBody <= 0 {
+		l.maxBody = DefaultMaxBodyBytes
+	}
+	if l.maxBatch <= 0 {
+		l.maxBatch = DefaultMaxBatchSize
+	}
+	if l.defaultConcurrent <= 0 {
+		l.defaultConcurrent = DefaultMaxConcurrent
+	}
+	if cfg.RateLimit > 0 {
+		l.rate = newRateLimiter(cfg.RateLimit, cfg.RateBurst)
+	}
+	return l
+}
+
+// allow takes n tokens from the client's bucket.
+func (l *limiter) allow(r *http.Request, n int) bool {
+	return l.rate == nil || l.rate.allow(clientIP(r), n)
+}
+
+// readBody reads the request body up to the size limit, answering with 413
+// if it is larger.
+func (l *limiter) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	bz, err := io.ReadAll(http.MaxBytesReader(w, r.Body, l.maxBody))
+	if err != nil {
+		http.Error(w, "rpc: request body too large or unreadable", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	return bz, true
+}
+
+// acquire reserves a slot for a call to method, failing if the method's
+// concurrency limit is reached.
+func (l *limiter) acquire(method string) bool {
+	max, ok := l.concurrent[method]
+	if !ok {
+		max = l.defaultConcurrent
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[method] >= max {
+		return false
+	}
+	l.inFlight[method]++
+	return true
+}
+
+func (l *limiter) release(method string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[method]--; l.inFlight[method] <= 0 {
+		delete(l.inFlight, method)
+	}
+}
+
+// rateLimited answers requests from clients over their rate limit with 429
+// and passes the rest on.
+func (l *limiter) rateLimited(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.allow(r, 1) {
+			http.Error(w, "rpc: rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// splitBatch returns the calls in body and whether it is a batch.
+func splitBatch(body []byte) ([]json.RawMessage, bool, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		return []json.RawMessage{body}, false, nil
+	}
+	var calls []json.RawMessage
+	if err := json.Unmarshal(trimmed, &calls); err != nil {
+		return nil, true, err
+	}
+	return calls, true, nil
+}
+
+func callMethod(call []byte) string {
+	var req struct {
+		Method string `json:"method"`
+	}
+	_ = json.Unmarshal(call, &req) // malformed calls are rejected by the codec
+	return req.Method
+}
+
+// grapheneHandler serves /rpc. The gorilla server handles one call per
+// request, so batches are split here and each call is checked against the
+// namespace policy and concurrency limits before it is dispatched.
+type grapheneHandler struct {
+	srv    *gorpc.Server
+	policy *accessPolicy
+	limits *limiter
+}
+
+func (h *grapheneHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		// let the gorilla server produce its usual error
+		h.srv.ServeHTTP(w, r)
+		return
+	}
+	body, ok := h.limits.readBody(w, r)
+	if !ok {
+		return
+	}
+	calls, batch, err := splitBatch(body)
+	if err != nil {
+		http.Error(w, "rpc: invalid batch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if batch && len(calls) == 0 {
+		http.Error(w, "rpc: empty batch", http.StatusBadRequest)
+		return
+	}
+	if len(calls) > h.limits.maxBatch {
+		http.Error(w, fmt.Sprintf("rpc: batch of %d exceeds the limit of %d", len(calls), h.limits.maxBatch), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !h.limits.allow(r, len(calls)) {
+		http.Error(w, "rpc: rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+	if !batch {
+		h.serveCall(w, r, body)
+		return
+	}
+
+	out := make([]json.RawMessage, len(calls))
+	for i, call := range calls {
+		rec := &recorder{header: make(http.Header), status: http.StatusOK}
+		h.serveCall(rec, r, call)
+		out[i] = rec.result(call)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func (h *grapheneHandler) serveCall(w http.ResponseWriter, r *http.Request, call []byte) {
+	method := callMethod(call)
+	if status, msg := h.policy.check(methodNamespace(method), r); status != 0 {
+		h.policy.reject(w, status, msg)
+		return
+	}
+	if !h.limits.acquire(method) {
+		http.Error(w, "rpc: too many concurrent calls to "+method, http.StatusServiceUnavailable)
+		return
+	}
+	defer h.limits.release(method)
+
+	req := r.Clone(r.Context())
+	req.Body = io.NopCloser(bytes.NewReader(call))
+	req.ContentLength = int64(len(call))
+	h.srv.ServeHTTP(w, req)
+}
+
+// recorder captures the response to one call of a batch.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header         { return rec.header }
+func (rec *recorder) Write(b []byte) (int, error) { return rec.body.Write(b) }
+func (rec *recorder) WriteHeader(status int)      { rec.status = status }
+
+// result returns the recorded response, turning the plain-text errors the
+// gorilla server and the limits produce into a response object for call.
+func (rec *recorder) result(call []byte) json.RawMessage {
+	out := bytes.TrimSpace(rec.body.Bytes())
+	if rec.status == http.StatusOK && json.Valid(out) {
+		return json.RawMessage(out)
+	}
+	var req struct {
+		ID json.RawMessage `json:"id"`
+	}
+	_ = json.Unmarshal(call, &req)
+	if req.ID == nil {
+		req.ID = json.RawMessage("null")
+	}
+	bz, _ := json.Marshal(struct {
+		Result interface{}     `json:"result"`
+		Error  string          `json:"error"`
+		ID     json.RawMessage `json:"id"`
+	}{nil, string(out), req.ID})
+	return bz
+}
+
+// ethLimits applies the limits to the eth endpoint, which handles batches
+// itself, answering violations with JSON-RPC 2.0 errors.
+func (l *limiter) ethLimits(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, ok := l.readBody(w, r)
+		if !ok {
+			return
+		}
+		calls, _, err := splitBatch(body)
+		switch {
+		case err != nil:
+			ethError(w, http.StatusBadRequest, errCodeParse, err.Error())
+			return
+		case len(calls) > l.maxBatch:
+			ethError(w, http.StatusRequestEntityTooLarge, errCodeInvalidRequest, fmt.Sprintf("batch of %d exceeds the limit of %d", len(calls), l.maxBatch))
+			return
+		case !l.allow(r, len(calls)):
+			ethError(w, http.StatusTooManyRequests, errCodeLimitExceeded, "rate limit exceeded")
+			return
+		}
+		var held []string
+		defer func() {
+			for _, m := range held {
+				l.release(m)
+			}
+		}()
+		for _, call := range calls {
+			method := callMethod(call)
+			if !l.acquire(method) {
+				ethError(w, http.StatusServiceUnavailable, errCodeLimitExceeded, "too many concurrent calls to "+method)
+				return
+			}
+			held = append(held, method)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ethError(w http.ResponseWriter, status, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Error   jsonRPCError    `json:"error"`
+	}{"2.0", json.RawMessage("null"), jsonRPCError{Code: code, Message: msg}})
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimiter is a token bucket per client IP. Buckets that have refilled
+// completely are dropped.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = int(rate) + 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// allow takes n tokens from ip's bucket. A batch larger than the burst
+// takes the whole bucket.
+func (l *rateLimiter) allow(ip string, n int) bool {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > time.Minute {
+		full := time.Duration(l.burst / l.rate * float64(time.Second))
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > full {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	cost := float64(n)
+	if cost > l.burst {
+		cost = l.burst
+	}
+	if b.tokens < cost {
+		return false
+	}
+	b.tokens -= cost
+	return true
+}
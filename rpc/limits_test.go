@@ -0,0 +1,156 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gorpc "github.com/gorilla/rpc"
+	jsonrpc "github.com/gorilla/rpc/json"
+)
+
+type EchoArgs struct {
+	Msg string `json:"msg"`
+}
+
+type EchoReply struct {
+	Msg string `json:"msg"`
+}
+
+// echoService stands in for the API: Echo is in the graphene namespace and
+// Peers, by its name, in the admin one.
+type echoService struct{}
+
+func (echoService) Echo(r *http.Request, args *EchoArgs, reply *EchoReply) error {
+	reply.Msg = args.Msg
+	return nil
+}
+
+func (echoService) Peers(r *http.Request, args *EchoArgs, reply *EchoReply) error {
+	reply.Msg = "peers"
+	return nil
+}
+
+func newTestHandler(t *testing.T, cfg Config) http.Handler {
+	t.Helper()
+	srv := gorpc.NewServer()
+	srv.RegisterCodec(jsonrpc.NewCodec(), "application/json")
+	if err := srv.RegisterService(echoService{}, "Graphene"); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := newAccessPolicy(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy.cors(&grapheneHandler{srv: srv, policy: policy, limits: newLimiter(cfg)})
+}
+
+// post sends body to h from remote and returns the response.
+func post(h http.Handler, remote, body string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+	r.RemoteAddr = remote
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func echoCall(id int) string {
+	bz, _ := json.Marshal(map[string]interface{}{"method": "Graphene.Echo", "params": []EchoArgs{{Msg: "hi"}}, "id": id})
+	return string(bz)
+}
+
+func TestRateLimiterBurstAndRefill(t *testing.T) {
+	l := newRateLimiter(10, 3)
+	for i := 0; i < 3; i++ {
+		if !l.allow("a", 1) {
+			t.Fatalf("call %d of the burst refused", i)
+		}
+	}
+	if l.allow("a", 1) {
+		t.Fatal("call over the burst allowed")
+	}
+	if !l.allow("b", 1) {
+		t.Fatal("buckets are not per client")
+	}
+
+	// 200ms at 10 per second refills two tokens
+	l.buckets["a"].last = l.buckets["a"].last.Add(-200 * time.Millisecond)
+	if !l.allow("a", 2) || l.allow("a", 1) {
+		t.Fatal("bucket did not refill by two tokens")
+	}
+	// an idle bucket refills only up to the burst
+	l.buckets["a"].last = l.buckets["a"].last.Add(-time.Hour)
+	if !l.allow("a", 3) || l.allow("a", 1) {
+		t.Fatal("bucket refilled over the burst")
+	}
+
+	// a batch larger than the burst takes the whole bucket
+	if !l.allow("c", 5) || l.allow("c", 1) {
+		t.Fatal("large batch not charged the whole bucket")
+	}
+}
+
+func TestBatchLimits(t *testing.T) {
+	h := newTestHandler(t, Config{MaxBatchSize: 2, RateLimit: 1, RateBurst: 3})
+	const remote = "203.0.113.7:4000"
+
+	over := "[" + echoCall(1) + "," + echoCall(2) + "," + echoCall(3) + "]"
+	if w := post(h, remote, over, nil); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("batch over the limit: status %d", w.Code)
+	}
+	if w := post(h, remote, "[]", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("empty batch: status %d", w.Code)
+	}
+
+	// each call of a batch takes a token: 2 of the 3 are left after this
+	batch := "[" + echoCall(1) + "," + echoCall(2) + "]"
+	if w := post(h, remote, batch, nil); w.Code != http.StatusOK {
+		t.Fatalf("batch: status %d: %s", w.Code, w.Body)
+	}
+	if w := post(h, remote, batch, nil); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("batch over the rate limit: status %d", w.Code)
+	}
+}
+
+func TestMixedNamespaceBatch(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	batch := `[` + echoCall(1) + `,{"method":"Graphene.Peers","params":[{}],"id":2}]`
+
+	var out []struct {
+		Result *EchoReply `json:"result"`
+		Error  *string    `json:"error"`
+		ID     int        `json:"id"`
+	}
+	decode := func(w *httptest.ResponseRecorder) {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		out = nil
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil || len(out) != 2 {
+			t.Fatalf("response %s: %v", w.Body, err)
+		}
+	}
+
+	// admin is local only: a remote client gets the graphene call and an
+	// error for the admin one
+	decode(post(h, "203.0.113.7:4000", batch, nil))
+	if out[0].ID != 1 || out[0].Result == nil || out[0].Result.Msg != "hi" {
+		t.Fatalf("graphene call: %+v", out[0])
+	}
+	if out[1].ID != 2 || out[1].Result != nil || out[1].Error == nil || !strings.Contains(*out[1].Error, "admin namespace") {
+		t.Fatalf("admin call: %+v", out[1])
+	}
+
+	decode(post(h, "127.0.0.1:4000", batch, nil))
+	if out[1].Result == nil || out[1].Result.Msg != "peers" {
+		t.Fatalf("admin call from localhost: %+v", out[1])
+	}
+}
@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/core"
+)
+
+const (
+	// maxLogRange bounds the heights a GetLogs query may span.
+	maxLogRange = 10000
+	// maxLogResults bounds the logs a GetLogs query may return.
+	maxLogResults = 10000
+)
+
+type LogResult struct {
+	Height    uint64            `json:"height,omitempty"`
+	BlockHash string            `json:"block_hash,omitempty"`
+	TxHash    string            `json:"tx_hash"`
+	TxIndex   int               `json:"tx_index"`
+	LogIndex  int               `json:"log_index"` // within the transaction
+	Event     string            `json:"event"`
+	Topics    map[string]string `json:"topics"`
+	Amount    uint64            `json:"amount"`
+}
+
+// newLogResults converts the logs of rcpt, the receipt of transaction
+// index of b. b is nil for simulated transactions.
+func newLogResults(b *consensus.Block, index int, rcpt *core.Receipt) []LogResult {
+	out := []LogResult{}
+	for i, l := range rcpt.Logs {
+		out = append(out, newLogResult(b, index, rcpt, i, l))
+	}
+	return out
+}
+
+func newLogResult(b *consensus.Block, index int, rcpt *core.Receipt, i int, l core.Log) LogResult {
+	res := LogResult{
+		TxHash:   hex.EncodeToString(rcpt.TxHash),
+		TxIndex:  index,
+		LogIndex: i,
+		Event:    l.Event,
+		Topics:   make(map[string]string, len(l.Topics)),
+		Amount:   l.Amount,
+	}
+	for _, t := range l.Topics {
+		res.Topics[t.Name] = t.Value
+	}
+	if b != nil {
+		res.Height = b.Number
+		res.BlockHash = hex.EncodeToString(b.Hash)
+	}
+	return res
+}
+
+type LogsArgs struct {
+	FromHeight uint64 `json:"from_height"` // default: to_height
+	ToHeight   uint64 `json:"to_height"`   // default: the head
+	Address    string `json:"address"`     // matches any topic
+	Event      string `json:"event"`
+}
+
+type LogsReply struct {
+	Logs []LogResult `json:"logs"`
+}
+
+// GetLogs returns the logs emitted in a range of blocks, optionally only
+// those of one event type or mentioning an address.
+func (a *API) GetLogs(r *http.Request, args *LogsArgs, reply *LogsReply) error {
+	switch args.Event {
+	case "", core.EventTransfer, core.EventStaked, core.EventDelegated, core.EventUndelegated, core.EventSlashed:
+	default:
+		return fmt.Errorf("unknown event %q", args.Event)
+	}
+	if err := normalizeAddrs(&args.Address); err != nil {
+		return err
+	}
+	head := a.cons.Head().Number
+	to := args.ToHeight
+	if to == 0 || to > head {
+		to = head
+	}
+	from := args.FromHeight
+	if from == 0 {
+		from = to
+	}
+	if from > to {
+		return fmt.Errorf("from_height %d is above to_height %d", from, to)
+	}
+	if to-from >= maxLogRange {
+		return fmt.Errorf("range of %d blocks exceeds the limit of %d", to-from+1, maxLogRange)
+	}
+
+	reply.Logs = []LogResult{}
+	for n := from; n <= to; n++ {
+		b := a.cons.BlockByNumber(n)
+		if b == nil {
+			continue
+		}
+		for i, rcpt := range a.cons.BlockReceipts(n) {
+			for j, l := range rcpt.Logs {
+				if args.Event != "" && l.Event != args.Event {
+					continue
+				}
+				if args.Address != "" && !l.HasAddress(args.Address) {
+					continue
+				}
+				if len(reply.Logs) == maxLogResults {
+					return fmt.Errorf("more than %d logs, narrow the query", maxLogResults)
+				}
+				reply.Logs = append(reply.Logs, newLogResult(b, i, rcpt, j, l))
+			}
+		}
+	}
+	return nil
+}
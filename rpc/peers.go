@@ -0,0 +1,74 @@
+package rpc
+
+import (
+	"fmt"
+	"net/http"
+
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/rockandcode4/graphene-proto/p2p"
+)
+
+type PeersArgs struct{}
+type PeersReply struct {
+	Peers []p2p.PeerInfo `json:"peers"`
+}
+
+// Peers lists connected peers with their address, latency, head height and
+// gossip score.
+func (a *API) Peers(r *http.Request, args *PeersArgs, reply *PeersReply) error {
+	if a.p2p == nil {
+		return fmt.Errorf("p2p not running")
+	}
+	reply.Peers = a.p2p.PeerInfos()
+	return nil
+}
+
+type AddPeerArgs struct {
+	Address string `json:"address"` // multiaddr ending in /p2p/<peer id>
+}
+type AddPeerReply struct {
+	PeerID    string `json:"peer_id,omitempty"`
+	Connected bool   `json:"connected"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AddPeer adds a persistent peer. It stays persistent, and is redialed in
+// the background, even if the first connection attempt fails.
+func (a *API) AddPeer(r *http.Request, args *AddPeerArgs, reply *AddPeerReply) error {
+	if a.p2p == nil {
+		return fmt.Errorf("p2p not running")
+	}
+	pid, err := a.p2p.AddPeer(args.Address)
+	if pid != "" {
+		reply.PeerID = pid.String()
+	}
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	reply.Connected = true
+	return nil
+}
+
+type RemovePeerArgs struct {
+	PeerID string `json:"peer_id"`
+}
+
+// RemovePeer disconnects a peer and removes it from the persistent peers.
+func (a *API) RemovePeer(r *http.Request, args *RemovePeerArgs, reply *GenericReply) error {
+	if a.p2p == nil {
+		return fmt.Errorf("p2p not running")
+	}
+	pid, err := peerstore.Decode(args.PeerID)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	if err := a.p2p.RemovePeer(pid); err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	reply.Ok = true
+	return nil
+}
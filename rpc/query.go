@@ -0,0 +1,280 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/core"
+)
+
+// Hashes are hex encoded without a 0x prefix; a prefix is accepted on input.
+
+type BlockResult struct {
+	Height       uint64     `json:"height"`
+	Hash         string     `json:"hash"`
+	PrevHash     string     `json:"prev_hash"`
+	Time         int64      `json:"time"`
+	Proposer     string     `json:"proposer"`
+	StateRoot    string     `json:"state_root"`
+	TxRoot       string     `json:"tx_root"`
+	ReceiptsRoot string     `json:"receipts_root"`
+	GasUsed      uint64     `json:"gas_used"`
+	BaseFee      uint64     `json:"base_fee"`
+	TxHashes     []string   `json:"tx_hashes"`
+	Txs          []TxResult `json:"txs,omitempty"` // only with full_txs
+}
+
+type TxResult struct {
+	Hash      string `json:"hash"`
+	Type      string `json:"type"`
+	From      string `json:"from"`
+	To        string `json:"to,omitempty"`
+	Validator string `json:"validator,omitempty"`
+	Amount    uint64 `json:"amount"`
+	Nonce     uint64 `json:"nonce"`
+	MaxFee    uint64 `json:"max_fee"`
+	Tip       uint64 `json:"tip"`
+	// Multisig is set for transactions from a multisig account, which
+	// carry Signatures signatures of its keys.
+	Multisig   *core.Multisig `json:"multisig,omitempty"`
+	Signatures int            `json:"signatures,omitempty"`
+	// Pending transactions are in the mempool and have no block yet.
+	Pending     bool   `json:"pending"`
+	BlockHeight uint64 `json:"block_height,omitempty"`
+	BlockHash   string `json:"block_hash,omitempty"`
+	Index       int    `json:"index"`
+}
+
+type ReceiptResult struct {
+	TxHash      string      `json:"tx_hash"`
+	BlockHeight uint64      `json:"block_height"`
+	BlockHash   string      `json:"block_hash"`
+	Index       int         `json:"index"`
+	Success     bool        `json:"success"`
+	Error       string      `json:"error,omitempty"`
+	GasUsed     uint64      `json:"gas_used"`
+	GasPrice    uint64      `json:"gas_price"` // base fee plus tip
+	Fee         uint64      `json:"fee"`
+	Logs        []LogResult `json:"logs"`
+}
+
+func newBlockResult(b *consensus.Block, full bool) *BlockResult {
+	res := &BlockResult{
+		Height:       b.Number,
+		Hash:         hex.EncodeToString(b.Hash),
+		PrevHash:     hex.EncodeToString(b.Prev),
+		Time:         b.Time,
+		Proposer:     b.Proposer,
+		StateRoot:    hex.EncodeToString(b.StateRoot),
+		TxRoot:       hex.EncodeToString(consensus.TxRoot(b.Txns)),
+		ReceiptsRoot: hex.EncodeToString(b.ReceiptsRoot),
+		GasUsed:      b.GasUsed,
+		BaseFee:      b.BaseFee,
+		TxHashes:     []string{},
+	}
+	for i, raw := range b.Txns {
+		tx, err := core.DecodeTx(raw)
+		if err != nil {
+			continue
+		}
+		res.TxHashes = append(res.TxHashes, tx.HashHex())
+		if full {
+			res.Txs = append(res.Txs, newTxResult(&consensus.TxLookup{Tx: tx, Raw: raw, Block: b, Index: i}))
+		}
+	}
+	return res
+}
+
+func newTxResult(lk *consensus.TxLookup) TxResult {
+	tx := lk.Tx
+	res := TxResult{
+		Hash:      tx.HashHex(),
+		Type:      tx.Type,
+		From:      tx.From,
+		To:        tx.To,
+		Validator: tx.Validator,
+		Amount:    tx.Amount,
+		Nonce:     tx.Nonce,
+		MaxFee:    tx.MaxFee,
+		Tip:       tx.Tip,
+		Pending:   lk.Block == nil,
+		Index:     lk.Index,
+
+		Multisig:   tx.Multisig,
+		Signatures: len(tx.Signatures),
+	}
+	if lk.Block != nil {
+		res.BlockHeight = lk.Block.Number
+		res.BlockHash = hex.EncodeToString(lk.Block.Hash)
+	}
+	return res
+}
+
+func decodeHash(s string) ([]byte, error) {
+	bz, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hash: %v", err)
+	}
+	return bz, nil
+}
+
+type BlockByHeightArgs struct {
+	Height  uint64 `json:"height"`
+	FullTxs bool   `json:"full_txs"`
+}
+
+func (a *API) GetBlockByHeight(r *http.Request, args *BlockByHeightArgs, reply *BlockResult) error {
+	b := a.cons.BlockByNumber(args.Height)
+	if b == nil {
+		return fmt.Errorf("block %d not found", args.Height)
+	}
+	*reply = *newBlockResult(b, args.FullTxs)
+	return nil
+}
+
+type BlockByHashArgs struct {
+	Hash    string `json:"hash"`
+	FullTxs bool   `json:"full_txs"`
+}
+
+func (a *API) GetBlockByHash(r *http.Request, args *BlockByHashArgs, reply *BlockResult) error {
+	hash, err := decodeHash(args.Hash)
+	if err != nil {
+		return err
+	}
+	b := a.cons.BlockByHash(hash)
+	if b == nil {
+		return fmt.Errorf("block %s not found", args.Hash)
+	}
+	*reply = *newBlockResult(b, args.FullTxs)
+	return nil
+}
+
+type LatestBlockArgs struct {
+	FullTxs bool `json:"full_txs"`
+}
+
+func (a *API) GetLatestBlock(r *http.Request, args *LatestBlockArgs, reply *BlockResult) error {
+	*reply = *newBlockResult(a.cons.Head(), args.FullTxs)
+	return nil
+}
+
+type TxHashArgs struct {
+	Hash string `json:"hash"`
+}
+
+// GetTransaction finds a transaction in a committed block or the mempool.
+func (a *API) GetTransaction(r *http.Request, args *TxHashArgs, reply *TxResult) error {
+	hash, err := decodeHash(args.Hash)
+	if err != nil {
+		return err
+	}
+	lk, ok := a.cons.FindTx(hash)
+	if !ok {
+		return fmt.Errorf("transaction %s not found", args.Hash)
+	}
+	*reply = newTxResult(lk)
+	return nil
+}
+
+// GetTransactionReceipt reports the outcome of a committed transaction.
+func (a *API) GetTransactionReceipt(r *http.Request, args *TxHashArgs, reply *ReceiptResult) error {
+	hash, err := decodeHash(args.Hash)
+	if err != nil {
+		return err
+	}
+	lk, ok := a.cons.FindTx(hash)
+	if !ok || lk.Block == nil {
+		return fmt.Errorf("no receipt for %s", args.Hash)
+	}
+	rcpt, ok := a.cons.Receipt(hash)
+	if !ok {
+		return fmt.Errorf("no receipt for %s", args.Hash)
+	}
+	*reply = ReceiptResult{
+		TxHash:      lk.Tx.HashHex(),
+		BlockHeight: lk.Block.Number,
+		BlockHash:   hex.EncodeToString(lk.Block.Hash),
+		Index:       lk.Index,
+		Success:     rcpt.Success,
+		Error:       rcpt.Error,
+		GasUsed:     rcpt.GasUsed,
+		GasPrice:    lk.Tx.GasPrice(lk.Block.BaseFee),
+		Fee:         rcpt.Fee,
+		Logs:        newLogResults(lk.Block, lk.Index, rcpt),
+	}
+	return nil
+}
+
+type AccountArgs struct {
+	Address string `json:"address"`
+}
+
+type DelegationResult struct {
+	Delegator string `json:"delegator,omitempty"`
+	Validator string `json:"validator"`
+	Amount    uint64 `json:"amount"`
+}
+
+type AccountReply struct {
+	Address     string             `json:"address"`
+	Balance     uint64             `json:"balance"`
+	Nonce       uint64             `json:"nonce"`
+	Staked      uint64             `json:"staked"`
+	Delegations []DelegationResult `json:"delegations"`
+}
+
+func (a *API) GetAccount(r *http.Request, args *AccountArgs, reply *AccountReply) error {
+	if err := normalizeAddrs(&args.Address); err != nil {
+		return err
+	}
+	acct, err := a.cons.GetAccount(args.Address)
+	if err != nil {
+		return err
+	}
+	reply.Address = args.Address
+	reply.Balance = acct.Balance
+	reply.Nonce = acct.Nonce
+	reply.Delegations = []DelegationResult{}
+	if a.stake != nil {
+		staked, dels, err := a.stake.StakeOf(args.Address)
+		if err != nil {
+			return err
+		}
+		reply.Staked = staked
+		for _, d := range dels {
+			reply.Delegations = append(reply.Delegations, DelegationResult{Validator: d.Validator, Amount: d.Amount})
+		}
+	}
+	return nil
+}
+
+type ChainInfoArgs struct{}
+
+type ChainInfoReply struct {
+	ChainID     string `json:"chain_id"`
+	GenesisHash string `json:"genesis_hash"`
+	HeadHeight  uint64 `json:"head_height"`
+	HeadHash    string `json:"head_hash"`
+	HeadTime    int64  `json:"head_time"`
+	// Blocks are final once committed, so this equals HeadHeight.
+	FinalizedHeight uint64 `json:"finalized_height"`
+	Syncing         bool   `json:"syncing"`
+}
+
+func (a *API) ChainInfo(r *http.Request, args *ChainInfoArgs, reply *ChainInfoReply) error {
+	head := a.cons.Head()
+	*reply = ChainInfoReply{
+		ChainID:         a.chainID,
+		GenesisHash:     hex.EncodeToString(a.cons.GenesisHash()),
+		HeadHeight:      head.Number,
+		HeadHash:        hex.EncodeToString(head.Hash),
+		HeadTime:        head.Time,
+		FinalizedHeight: head.Number,
+		Syncing:         a.cons.Syncing(),
+	}
+	return nil
+}
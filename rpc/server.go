@@ -1,41 +1,147 @@
 package rpc
 
 import (
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
 	gorpc "github.com/gorilla/rpc"
 	jsonrpc "github.com/gorilla/rpc/json"
 	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/mempool"
+	"github.com/rockandcode4/graphene-proto/p2p"
 	"github.com/rockandcode4/graphene-proto/staking"
 )
 
 type Server struct {
 	cons    *consensus.Consensus
 	stake   *staking.Manager
+	p2p     *p2p.P2P
 	httpSrv *http.Server
-	port    int
+	ethSrv  *gethrpc.Server
+	ws      *wsHub
+	tls     bool
 }
 
-func NewServer(cons *consensus.Consensus, stake *staking.Manager, port int) (*Server, error) {
-	s := &Server{cons: cons, stake: stake, port: port}
+// Config holds the settings for NewServer.
+type Config struct {
+	// Host is the interface to listen on; empty means all interfaces.
+	Host    string
+	Port    int
+	ChainID string
+	// EthChainID is reported by eth_chainId and net_version. Zero derives
+	// it from ChainID; see EthChainID.
+	EthChainID uint64
+	// WebSocket limits; zero uses DefaultWSMaxConnections and
+	// DefaultWSMaxSubscriptions (per connection).
+	WSMaxConnections   int
+	WSMaxSubscriptions int
+
+	// APIKeys and JWTSecretFile (a hex encoded HS256 secret) enable
+	// authentication; with neither set, no credentials are needed.
+	APIKeys       []string
+	JWTSecretFile string
+	// CORSOrigins are the browser origins allowed to call the API; "*"
+	// allows any.
+	CORSOrigins []string
+	// Namespaces overrides the access level (AccessPublic, AccessLocal,
+	// AccessOff) of namespaces; see DefaultNamespaces.
+	Namespaces map[string]string
+	// TLSCertFile and TLSKeyFile serve HTTPS and WSS when both are set.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// Request limits; zero values use the defaults. RateLimit is the number
+	// of calls per second allowed per client IP (0 disables rate limiting)
+	// with bursts of RateBurst; a batch counts each call. MaxConcurrent caps
+	// the calls in flight per method unless MethodConcurrency overrides it.
+	RateLimit         float64
+	RateBurst         int
+	MaxBodyBytes      int64
+	RequestTimeout    time.Duration
+	MaxConcurrent     int
+	MethodConcurrency map[string]int
+	MaxBatchSize      int
+}
+
+// NewServer serves the Graphene API at /rpc and the Ethereum-compatible
+// JSON-RPC 2.0 API at /eth and /, and event subscriptions over WebSocket at
+// /ws.
+func NewServer(cons *consensus.Consensus, stake *staking.Manager, p *p2p.P2P, cfg Config) (*Server, error) {
+	policy, err := newAccessPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{cons: cons, stake: stake, p2p: p}
 	rpcS := gorpc.NewServer()
 	rpcS.RegisterCodec(jsonrpc.NewCodec(), "application/json")
-	api := &API{cons: cons, stake: stake}
+	api := &API{cons: cons, stake: stake, p2p: p, chainID: cfg.ChainID}
 	if err := rpcS.RegisterService(api, "Graphene"); err != nil {
 		return nil, err
 	}
+	if cfg.EthChainID == 0 {
+		cfg.EthChainID = EthChainID(cfg.ChainID)
+	}
+	ethSrv, err := newEthServer(cons, cfg.EthChainID)
+	if err != nil {
+		return nil, err
+	}
+	s.ethSrv = ethSrv
+	s.ws = newWSHub(cfg.WSMaxConnections, cfg.WSMaxSubscriptions, policy.checkOrigin)
+	s.ws.watch(cons, stake)
+	limits := newLimiter(cfg)
+	timeout := cfg.RequestTimeout
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+	// WebSocket connections are long-lived, so only their handshake is
+	// rate limited and no timeout applies.
+	withTimeout := func(h http.Handler) http.Handler {
+		return http.TimeoutHandler(h, timeout, "rpc: request timed out")
+	}
+	eth := withTimeout(limits.ethLimits(policy.guard(NamespaceEth, ethSrv)))
 	mux := http.NewServeMux()
-	mux.Handle("/rpc", rpcS)
-	s.httpSrv = &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}
+	mux.Handle("/rpc", withTimeout(&grapheneHandler{srv: rpcS, policy: policy, limits: limits}))
+	mux.Handle("/ws", limits.rateLimited(policy.guard(NamespaceWS, s.ws)))
+	mux.Handle("/eth", eth)
+	mux.Handle("/", eth)
+	s.httpSrv = &http.Server{
+		Addr:              net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Handler:           policy.cors(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       timeout,
+		IdleTimeout:       2 * time.Minute,
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("rpc tls: %w", err)
+		}
+		s.httpSrv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		s.tls = true
+	}
 	return s, nil
 }
 
 func (s *Server) Start() {
 	go func() {
-		log.Printf("RPC server listening on %s", s.httpSrv.Addr)
-		if err := s.httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if s.tls {
+			log.Printf("RPC server listening on %s (TLS)", s.httpSrv.Addr)
+			err = s.httpSrv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("RPC server listening on %s", s.httpSrv.Addr)
+			err = s.httpSrv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Println("rpc listen:", err)
 		}
 	}()
@@ -43,29 +149,55 @@ func (s *Server) Start() {
 
 func (s *Server) Stop() {
 	_ = s.httpSrv.Close()
+	s.ethSrv.Stop()
+	s.ws.closeAll()
 }
 
 type API struct {
-	cons  *consensus.Consensus
-	stake *staking.Manager
+	cons    *consensus.Consensus
+	stake   *staking.Manager
+	p2p     *p2p.P2P
+	chainID string
+}
+
+// normalizeAddrs rewrites address arguments in checksummed form, the form
+// accounts are stored under, and rejects malformed ones. Empty arguments
+// are left for the method to reject or treat as unset.
+func normalizeAddrs(addrs ...*string) error {
+	for _, p := range addrs {
+		if *p == "" {
+			continue
+		}
+		a, err := core.NormalizeAddress(*p)
+		if err != nil {
+			return err
+		}
+		*p = a
+	}
+	return nil
 }
 
-type SendArgs struct {
-	From   string `json:"from"`
-	To     string `json:"to"`
-	Amount uint64 `json:"amount"`
+type SendRawTxArgs struct {
+	Tx string `json:"tx"` // hex-encoded signed transaction
 }
-type SendReply struct {
+type SendRawTxReply struct {
+	Hash  string `json:"hash,omitempty"`
 	Ok    bool   `json:"ok"`
 	Error string `json:"error,omitempty"`
 }
 
-func (a *API) SendTx(r *http.Request, args *SendArgs, reply *SendReply) error {
-	if err := a.cons.SubmitTx(args.From, args.To, args.Amount); err != nil {
-		reply.Ok = false
+// SendRawTx adds a signed transaction to the mempool and gossips it.
+func (a *API) SendRawTx(r *http.Request, args *SendRawTxArgs, reply *SendRawTxReply) error {
+	bz, err := hex.DecodeString(strings.TrimPrefix(args.Tx, "0x"))
+	if err != nil {
+		reply.Error = "invalid hex: " + err.Error()
+		return nil
+	}
+	if err := a.cons.BroadcastTx(bz); err != nil {
 		reply.Error = err.Error()
 		return nil
 	}
+	reply.Hash = hex.EncodeToString(mempool.Key(bz))
 	reply.Ok = true
 	return nil
 }
@@ -78,6 +210,9 @@ type BalanceReply struct {
 }
 
 func (a *API) GetBalance(r *http.Request, args *BalanceArgs, reply *BalanceReply) error {
+	if err := normalizeAddrs(&args.Address); err != nil {
+		return err
+	}
 	b, err := a.cons.GetBalance(args.Address)
 	if err != nil {
 		return err
@@ -86,37 +221,7 @@ func (a *API) GetBalance(r *http.Request, args *BalanceArgs, reply *BalanceReply
 	return nil
 }
 
-type RegisterValidatorArgs struct {
-	Address string `json:"address"`
-	Stake   uint64 `json:"stake"`
-}
 type GenericReply struct {
 	Ok    bool   `json:"ok"`
 	Error string `json:"error,omitempty"`
 }
-
-func (a *API) RegisterValidator(r *http.Request, args *RegisterValidatorArgs, reply *GenericReply) error {
-	if err := a.stake.RegisterValidator(args.Address, args.Stake); err != nil {
-		reply.Ok = false
-		reply.Error = err.Error()
-		return nil
-	}
-	reply.Ok = true
-	return nil
-}
-
-type DelegateArgs struct {
-	Delegator string `json:"delegator"`
-	Validator string `json:"validator"`
-	Amount    uint64 `json:"amount"`
-}
-
-func (a *API) Delegate(r *http.Request, args *DelegateArgs, reply *GenericReply) error {
-	if err := a.stake.Delegate(args.Delegator, args.Validator, args.Amount); err != nil {
-		reply.Ok = false
-		reply.Error = err.Error()
-		return nil
-	}
-	reply.Ok = true
-	return nil
-}
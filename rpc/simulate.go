@@ -0,0 +1,139 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rockandcode4/graphene-proto/core"
+)
+
+// SimulateTxArgs takes either an encoded transaction in Tx or its fields.
+// The signature is checked if present; Nonce defaults to the sender's
+// nonce and MaxFee to the base fee plus Tip, both at Height.
+type SimulateTxArgs struct {
+	Height uint64 `json:"height"`
+
+	Tx string `json:"tx"` // hex, signed or unsigned
+
+	Type      string  `json:"type"`
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Validator string  `json:"validator"`
+	Amount    uint64  `json:"amount"`
+	Nonce     *uint64 `json:"nonce"`
+	MaxFee    uint64  `json:"max_fee"`
+	Tip       uint64  `json:"tip"`
+}
+
+type AccountChange struct {
+	Address       string `json:"address"`
+	BalanceBefore uint64 `json:"balance_before"`
+	BalanceAfter  uint64 `json:"balance_after"`
+	NonceBefore   uint64 `json:"nonce_before"`
+	NonceAfter    uint64 `json:"nonce_after"`
+}
+
+type SimulateTxReply struct {
+	Height    uint64          `json:"height"`
+	Hash      string          `json:"hash"`
+	Success   bool            `json:"success"`
+	Error     string          `json:"error,omitempty"`
+	BaseFee   uint64          `json:"base_fee"`
+	GasUsed   uint64          `json:"gas_used"`
+	Fee       uint64          `json:"fee"`
+	Burned    uint64          `json:"burned"`
+	Tip       uint64          `json:"tip"` // paid to the proposer
+	Logs      []LogResult     `json:"logs"`
+	StateDiff []AccountChange `json:"state_diff"`
+}
+
+// SimulateTx executes a transaction against the state after block Height,
+// the head by default, as if it were in the block after it, without
+// changing anything. It reports whether it would succeed, its fee and the
+// accounts it would change. Only the last consensus.StateHistory blocks can
+// be simulated against.
+func (a *API) SimulateTx(r *http.Request, args *SimulateTxArgs, reply *SimulateTxReply) error {
+	height := args.Height
+	if height == 0 {
+		height = a.cons.Head().Number
+	}
+	b := a.cons.BlockByNumber(height)
+	if b == nil {
+		return fmt.Errorf("block %d not found", height)
+	}
+	baseFee := a.cons.Params().NextBaseFee(b)
+	tx, err := a.simulatedTx(args, height, baseFee)
+	if err != nil {
+		return err
+	}
+	reply.Height = height
+	reply.BaseFee = baseFee
+	reply.Logs = []LogResult{}
+	reply.Hash = tx.HashHex()
+	reply.StateDiff = []AccountChange{}
+	if len(tx.Signature) > 0 || len(tx.Signatures) > 0 {
+		if err := tx.VerifySignature(); err != nil {
+			reply.Error = err.Error()
+			return nil
+		}
+	}
+	rcpt, changes, err := a.cons.SimulateTx(tx, height)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	reply.Success = rcpt.Success
+	reply.Error = rcpt.Error
+	reply.GasUsed = rcpt.GasUsed
+	reply.Fee = rcpt.Fee
+	reply.Burned = rcpt.Burned
+	reply.Tip = rcpt.Tip
+	reply.Logs = newLogResults(nil, 0, rcpt)
+	for _, c := range changes {
+		reply.StateDiff = append(reply.StateDiff, AccountChange{
+			Address:       c.After.Address,
+			BalanceBefore: c.Before.Balance,
+			BalanceAfter:  c.After.Balance,
+			NonceBefore:   c.Before.Nonce,
+			NonceAfter:    c.After.Nonce,
+		})
+	}
+	return nil
+}
+
+func (a *API) simulatedTx(args *SimulateTxArgs, height, baseFee uint64) (*core.Transaction, error) {
+	if args.Tx != "" {
+		bz, err := hex.DecodeString(strings.TrimPrefix(args.Tx, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex: %v", err)
+		}
+		return core.DecodeTx(bz)
+	}
+	if err := normalizeAddrs(&args.From, &args.To, &args.Validator); err != nil {
+		return nil, err
+	}
+	tx := &core.Transaction{
+		Type:      args.Type,
+		From:      args.From,
+		To:        args.To,
+		Validator: args.Validator,
+		Amount:    args.Amount,
+		MaxFee:    args.MaxFee,
+		Tip:       args.Tip,
+	}
+	if tx.MaxFee == 0 {
+		tx.MaxFee = baseFee + args.Tip
+	}
+	if args.Nonce != nil {
+		tx.Nonce = *args.Nonce
+	} else {
+		acct, err := a.cons.AccountAt(args.From, height)
+		if err != nil {
+			return nil, err
+		}
+		tx.Nonce = acct.Nonce
+	}
+	return tx, nil
+}
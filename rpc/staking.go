@@ -0,0 +1,250 @@
+package rpc
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/rockandcode4/graphene-proto/staking"
+)
+
+// Staking queries take an optional height; 0 means the latest block.
+// Changes submitted while a block is the head show up from the next block.
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// Validator statuses accepted by GetValidators.
+const (
+	StatusActive   = "active"
+	StatusInactive = "inactive"
+)
+
+type ValidatorResult struct {
+	Address   string `json:"address"`
+	Status    string `json:"status"`
+	Stake     uint64 `json:"stake"` // own stake plus delegations
+	SelfStake uint64 `json:"self_stake"`
+	Delegated uint64 `json:"delegated"`
+}
+
+type UnbondingResult struct {
+	Delegator        string `json:"delegator"`
+	Validator        string `json:"validator"`
+	Amount           uint64 `json:"amount"`
+	CompletionHeight uint64 `json:"completion_height"`
+}
+
+type RewardResult struct {
+	Validator string `json:"validator"`
+	Amount    uint64 `json:"amount"`
+}
+
+func (a *API) stakingView(height uint64) (*staking.View, error) {
+	if a.stake == nil {
+		return nil, fmt.Errorf("staking is not available")
+	}
+	return a.stake.ViewAt(height)
+}
+
+func newValidatorResult(view *staking.View, v staking.Validator) ValidatorResult {
+	res := ValidatorResult{Address: v.Address, Status: StatusInactive, Stake: v.Stake, SelfStake: v.SelfStake}
+	if v.Active {
+		res.Status = StatusActive
+	}
+	for _, d := range view.DelegationsTo(v.Address) {
+		res.Delegated += d.Amount
+	}
+	return res
+}
+
+func delegationResults(dels []staking.Delegation) []DelegationResult {
+	out := make([]DelegationResult, 0, len(dels))
+	for _, d := range dels {
+		out = append(out, DelegationResult{Delegator: d.Delegator, Validator: d.Validator, Amount: d.Amount})
+	}
+	return out
+}
+
+type ValidatorsArgs struct {
+	Height uint64 `json:"height"`
+	Status string `json:"status"` // "active", "inactive" or empty for all
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"` // default 100, at most 1000
+}
+
+type ValidatorsReply struct {
+	Height     uint64            `json:"height"`
+	Total      int               `json:"total"`
+	Validators []ValidatorResult `json:"validators"`
+}
+
+// GetValidators lists validators by descending stake.
+func (a *API) GetValidators(r *http.Request, args *ValidatorsArgs, reply *ValidatorsReply) error {
+	switch args.Status {
+	case "", StatusActive, StatusInactive:
+	default:
+		return fmt.Errorf("unknown status %q", args.Status)
+	}
+	if args.Offset < 0 || args.Limit < 0 {
+		return fmt.Errorf("offset and limit must not be negative")
+	}
+	limit := args.Limit
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	view, err := a.stakingView(args.Height)
+	if err != nil {
+		return err
+	}
+	all := []ValidatorResult{}
+	for _, v := range view.Validators() {
+		res := newValidatorResult(view, v)
+		if args.Status == "" || res.Status == args.Status {
+			all = append(all, res)
+		}
+	}
+	reply.Height = view.Height
+	reply.Total = len(all)
+	reply.Validators = []ValidatorResult{}
+	if args.Offset < len(all) {
+		end := args.Offset + limit
+		if end > len(all) {
+			end = len(all)
+		}
+		reply.Validators = all[args.Offset:end]
+	}
+	return nil
+}
+
+type ValidatorArgs struct {
+	Height  uint64 `json:"height"`
+	Address string `json:"address"`
+}
+
+type ValidatorReply struct {
+	Height    uint64          `json:"height"`
+	Validator ValidatorResult `json:"validator"`
+}
+
+func (a *API) GetValidator(r *http.Request, args *ValidatorArgs, reply *ValidatorReply) error {
+	view, err := a.stakingView(args.Height)
+	if err != nil {
+		return err
+	}
+	if err := normalizeAddrs(&args.Address); err != nil {
+		return err
+	}
+	v, ok := view.Validator(args.Address)
+	if !ok {
+		return fmt.Errorf("validator %s not found", args.Address)
+	}
+	reply.Height = view.Height
+	reply.Validator = newValidatorResult(view, v)
+	return nil
+}
+
+type DelegationsArgs struct {
+	Height    uint64 `json:"height"`
+	Delegator string `json:"delegator"`
+}
+
+type ValidatorDelegationsArgs struct {
+	Height    uint64 `json:"height"`
+	Validator string `json:"validator"`
+}
+
+type DelegationsReply struct {
+	Height      uint64             `json:"height"`
+	Delegations []DelegationResult `json:"delegations"`
+}
+
+// GetDelegations lists the positions of a delegator.
+func (a *API) GetDelegations(r *http.Request, args *DelegationsArgs, reply *DelegationsReply) error {
+	view, err := a.stakingView(args.Height)
+	if err != nil {
+		return err
+	}
+	reply.Height = view.Height
+	if err := normalizeAddrs(&args.Delegator); err != nil {
+		return err
+	}
+	reply.Delegations = delegationResults(view.DelegationsBy(args.Delegator))
+	return nil
+}
+
+// GetValidatorDelegations lists the delegations made to a validator.
+func (a *API) GetValidatorDelegations(r *http.Request, args *ValidatorDelegationsArgs, reply *DelegationsReply) error {
+	view, err := a.stakingView(args.Height)
+	if err != nil {
+		return err
+	}
+	reply.Height = view.Height
+	if err := normalizeAddrs(&args.Validator); err != nil {
+		return err
+	}
+	reply.Delegations = delegationResults(view.DelegationsTo(args.Validator))
+	return nil
+}
+
+type UnbondingReply struct {
+	Height  uint64            `json:"height"`
+	Entries []UnbondingResult `json:"entries"`
+}
+
+// GetUnbonding lists a delegator's undelegated stake that is waiting to be
+// released, soonest first.
+func (a *API) GetUnbonding(r *http.Request, args *DelegationsArgs, reply *UnbondingReply) error {
+	view, err := a.stakingView(args.Height)
+	if err != nil {
+		return err
+	}
+	reply.Height = view.Height
+	if err := normalizeAddrs(&args.Delegator); err != nil {
+		return err
+	}
+	reply.Entries = []UnbondingResult{}
+	for _, u := range view.Unbonding(args.Delegator) {
+		reply.Entries = append(reply.Entries, UnbondingResult{
+			Delegator:        u.Delegator,
+			Validator:        u.Validator,
+			Amount:           u.Amount,
+			CompletionHeight: u.CompletionHeight,
+		})
+	}
+	return nil
+}
+
+type PendingRewardsArgs struct {
+	Height  uint64 `json:"height"`
+	Address string `json:"address"`
+}
+
+type PendingRewardsReply struct {
+	Height  uint64         `json:"height"`
+	Total   uint64         `json:"total"`
+	Rewards []RewardResult `json:"rewards"`
+}
+
+// GetPendingRewards reports the rewards an address has earned as validator
+// or delegator and that are not paid out yet, by validator.
+func (a *API) GetPendingRewards(r *http.Request, args *PendingRewardsArgs, reply *PendingRewardsReply) error {
+	view, err := a.stakingView(args.Height)
+	if err != nil {
+		return err
+	}
+	reply.Height = view.Height
+	if err := normalizeAddrs(&args.Address); err != nil {
+		return err
+	}
+	reply.Rewards = []RewardResult{}
+	for _, rw := range view.PendingRewards(args.Address) {
+		reply.Total += rw.Amount
+		reply.Rewards = append(reply.Rewards, RewardResult{Validator: rw.Validator, Amount: rw.Amount})
+	}
+	return nil
+}
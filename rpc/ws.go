@@ -0,0 +1,444 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/staking"
+)
+
+// The WebSocket endpoint at /ws speaks JSON-RPC 2.0:
+//
+//	{"jsonrpc":"2.0","id":1,"method":"subscribe","params":{"topic":"new_blocks"}}
+//	{"jsonrpc":"2.0","id":2,"method":"unsubscribe","params":{"subscription":"0x1"}}
+//
+// subscribe returns a subscription id; events then arrive as
+//
+//	{"jsonrpc":"2.0","method":"subscription","params":{"subscription":"0x1","result":{...}}}
+
+// Subscription topics. TopicAddress requires an address; TopicStaking
+// accepts one to filter on validator or delegator.
+const (
+	TopicNewBlocks       = "new_blocks"
+	TopicFinalizedBlocks = "finalized_blocks"
+	TopicPendingTxs      = "pending_txs"
+	TopicAddress         = "address"
+	TopicStaking         = "staking"
+)
+
+const (
+	DefaultWSMaxConnections   = 100
+	DefaultWSMaxSubscriptions = 32
+
+	// wsSendQueue is the number of messages buffered per connection. A
+	// client that falls further behind is disconnected.
+	wsSendQueue    = 256
+	wsMaxMessage   = 64 << 10
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 30 * time.Second
+)
+
+// JSON-RPC error codes.
+const (
+	errCodeParse          = -32700
+	errCodeMethodNotFound = -32601
+	errCodeInvalidParams  = -32602
+	errCodeLimit          = -32000
+)
+
+type wsHub struct {
+	maxConns int
+	maxSubs  int
+	upgrader websocket.Upgrader
+
+	mu     sync.Mutex
+	active int // connections, including those being upgraded
+	conns  map[*wsConn]struct{}
+	nextID uint64
+	topics map[string]int // subscriptions per topic
+}
+
+type wsConn struct {
+	hub       *wsHub
+	conn      *websocket.Conn
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+
+	subs map[string]*wsSub // guarded by hub.mu
+}
+
+type wsSub struct {
+	id      string
+	topic   string
+	address string
+}
+
+func newWSHub(maxConns, maxSubs int, checkOrigin func(*http.Request) bool) *wsHub {
+	if maxConns <= 0 {
+		maxConns = DefaultWSMaxConnections
+	}
+	if maxSubs <= 0 {
+		maxSubs = DefaultWSMaxSubscriptions
+	}
+	return &wsHub{
+		maxConns: maxConns,
+		maxSubs:  maxSubs,
+		upgrader: websocket.Upgrader{CheckOrigin: checkOrigin},
+		conns:    make(map[*wsConn]struct{}),
+		topics:   make(map[string]int),
+	}
+}
+
+func (h *wsHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	if h.active >= h.maxConns {
+		h.mu.Unlock()
+		http.Error(w, "too many websocket connections", http.StatusServiceUnavailable)
+		return
+	}
+	h.active++
+	h.mu.Unlock()
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client
+		h.mu.Lock()
+		h.active--
+		h.mu.Unlock()
+		return
+	}
+	c := &wsConn{
+		hub:  h,
+		conn: conn,
+		send: make(chan []byte, wsSendQueue),
+		done: make(chan struct{}),
+		subs: make(map[string]*wsSub),
+	}
+	h.mu.Lock()
+	h.conns[c] = struct{}{}
+	h.mu.Unlock()
+
+	go c.writeLoop()
+	c.readLoop()
+}
+
+// has reports whether anyone is subscribed to topic.
+func (h *wsHub) has(topic string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.topics[topic] > 0
+}
+
+// publish sends the value returned by result to every subscription on topic
+// that match accepts. result is only called if there is such a subscription.
+func (h *wsHub) publish(topic string, match func(*wsSub) bool, result func() interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.topics[topic] == 0 {
+		return
+	}
+	var raw json.RawMessage
+	for c := range h.conns {
+		for _, s := range c.subs {
+			if s.topic != topic || (match != nil && !match(s)) {
+				continue
+			}
+			if raw == nil {
+				bz, err := json.Marshal(result())
+				if err != nil {
+					log.Printf("ws %s: %v", topic, err)
+					return
+				}
+				raw = bz
+			}
+			msg, _ := json.Marshal(wsNotification{
+				JSONRPC: "2.0",
+				Method:  "subscription",
+				Params:  wsNotificationParams{Subscription: s.id, Result: raw},
+			})
+			c.queue(msg)
+		}
+	}
+}
+
+// watch feeds the hub from chain, mempool and staking events. The callbacks
+// run under the owners' locks, so they only encode and queue.
+func (h *wsHub) watch(cons *consensus.Consensus, stake *staking.Manager) {
+	cons.OnBlock(func(b *consensus.Block) {
+		h.publish(TopicNewBlocks, nil, func() interface{} { return newBlockResult(b, false) })
+		if !h.has(TopicAddress) {
+			return
+		}
+		for i, raw := range b.Txns {
+			tx, err := core.DecodeTx(raw)
+			if err != nil {
+				continue
+			}
+			res := newTxResult(&consensus.TxLookup{Tx: tx, Raw: raw, Block: b, Index: i})
+			h.publish(TopicAddress, func(s *wsSub) bool { return touches(tx, s.address) }, func() interface{} { return res })
+		}
+	})
+	cons.OnFinalize(func(b *consensus.Block) {
+		h.publish(TopicFinalizedBlocks, nil, func() interface{} { return newBlockResult(b, false) })
+	})
+	cons.OnPendingTx(func(bz []byte) {
+		if !h.has(TopicPendingTxs) {
+			return
+		}
+		tx, err := core.DecodeTx(bz)
+		if err != nil {
+			return
+		}
+		res := newTxResult(&consensus.TxLookup{Tx: tx, Raw: bz})
+		h.publish(TopicPendingTxs, nil, func() interface{} { return res })
+	})
+	if stake == nil {
+		return
+	}
+	stake.OnEvent(func(ev staking.Event) {
+		match := func(s *wsSub) bool {
+			return s.address == "" || s.address == ev.Validator || s.address == ev.Delegator
+		}
+		h.publish(TopicStaking, match, func() interface{} {
+			return StakingEventResult{Type: ev.Type, Validator: ev.Validator, Delegator: ev.Delegator, Amount: ev.Amount}
+		})
+	})
+}
+
+// touches reports whether tx involves addr as sender, recipient or
+// validator.
+func touches(tx *core.Transaction, addr string) bool {
+	return tx.From == addr || tx.To == addr || tx.Validator == addr
+}
+
+// closeAll disconnects every client.
+func (h *wsHub) closeAll() {
+	h.mu.Lock()
+	conns := make([]*wsConn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.Unlock()
+	for _, c := range conns {
+		c.closeWith(websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+type StakingEventResult struct {
+	Type      string `json:"type"`
+	Validator string `json:"validator"`
+	Delegator string `json:"delegator,omitempty"`
+	Amount    uint64 `json:"amount"`
+}
+
+type wsRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type wsParams struct {
+	Topic        string `json:"topic"`
+	Address      string `json:"address"`
+	Subscription string `json:"subscription"`
+}
+
+type jsonRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type wsResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *jsonRPCError   `json:"error,omitempty"`
+}
+
+type wsNotification struct {
+	JSONRPC string               `json:"jsonrpc"`
+	Method  string               `json:"method"`
+	Params  wsNotificationParams `json:"params"`
+}
+
+type wsNotificationParams struct {
+	Subscription string          `json:"subscription"`
+	Result       json.RawMessage `json:"result"`
+}
+
+// decodeParams accepts params as an object or, like the /rpc endpoint, as
+// a one-element array.
+func decodeParams(raw json.RawMessage) (wsParams, error) {
+	var p wsParams
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return p, nil
+	}
+	if raw[0] == '[' {
+		var list []wsParams
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return p, err
+		}
+		if len(list) > 0 {
+			p = list[0]
+		}
+		return p, nil
+	}
+	err := json.Unmarshal(raw, &p)
+	return p, err
+}
+
+func (c *wsConn) readLoop() {
+	defer c.close()
+	c.conn.SetReadLimit(wsMaxMessage)
+	_ = c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		var req wsRequest
+		if err := json.Unmarshal(msg, &req); err != nil {
+			c.reply(nil, nil, &jsonRPCError{Code: errCodeParse, Message: err.Error()})
+			continue
+		}
+		result, rerr := c.handle(&req)
+		c.reply(req.ID, result, rerr)
+	}
+}
+
+func (c *wsConn) handle(req *wsRequest) (interface{}, *jsonRPCError) {
+	params, err := decodeParams(req.Params)
+	if err != nil {
+		return nil, &jsonRPCError{Code: errCodeInvalidParams, Message: err.Error()}
+	}
+	switch req.Method {
+	case "subscribe":
+		return c.subscribe(params)
+	case "unsubscribe":
+		h := c.hub
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		s, ok := c.subs[params.Subscription]
+		if !ok {
+			return nil, &jsonRPCError{Code: errCodeInvalidParams, Message: "unknown subscription"}
+		}
+		delete(c.subs, s.id)
+		h.topics[s.topic]--
+		return true, nil
+	default:
+		return nil, &jsonRPCError{Code: errCodeMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)}
+	}
+}
+
+func (c *wsConn) subscribe(p wsParams) (interface{}, *jsonRPCError) {
+	switch p.Topic {
+	case TopicNewBlocks, TopicFinalizedBlocks, TopicPendingTxs, TopicStaking:
+	case TopicAddress:
+		if p.Address == "" {
+			return nil, &jsonRPCError{Code: errCodeInvalidParams, Message: "address required"}
+		}
+	default:
+		return nil, &jsonRPCError{Code: errCodeInvalidParams, Message: fmt.Sprintf("unknown topic %q", p.Topic)}
+	}
+	if err := normalizeAddrs(&p.Address); err != nil {
+		return nil, &jsonRPCError{Code: errCodeInvalidParams, Message: err.Error()}
+	}
+	h := c.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c.subs == nil {
+		return nil, &jsonRPCError{Code: errCodeLimit, Message: "connection closed"}
+	}
+	if len(c.subs) >= h.maxSubs {
+		return nil, &jsonRPCError{Code: errCodeLimit, Message: fmt.Sprintf("subscription limit of %d reached", h.maxSubs)}
+	}
+	h.nextID++
+	s := &wsSub{id: fmt.Sprintf("0x%x", h.nextID), topic: p.Topic, address: p.Address}
+	c.subs[s.id] = s
+	h.topics[s.topic]++
+	return s.id, nil
+}
+
+func (c *wsConn) reply(id json.RawMessage, result interface{}, rerr *jsonRPCError) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	msg, err := json.Marshal(wsResponse{JSONRPC: "2.0", ID: id, Result: result, Error: rerr})
+	if err != nil {
+		log.Printf("ws reply: %v", err)
+		return
+	}
+	c.queue(msg)
+}
+
+// queue hands msg to the writer without blocking. A client whose queue is
+// full is too slow to keep up and is disconnected, so it can reconnect and
+// catch up through the query RPCs.
+func (c *wsConn) queue(msg []byte) {
+	select {
+	case <-c.done:
+	case c.send <- msg:
+	default:
+		go c.closeWith(websocket.CloseTryAgainLater, "slow consumer")
+	}
+}
+
+func (c *wsConn) writeLoop() {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case msg := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				c.close()
+				return
+			}
+		case <-ping.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *wsConn) closeWith(code int, reason string) {
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteTimeout))
+	c.close()
+}
+
+func (c *wsConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		h := c.hub
+		h.mu.Lock()
+		for _, s := range c.subs {
+			h.topics[s.topic]--
+		}
+		c.subs = nil
+		delete(h.conns, c)
+		h.active--
+		h.mu.Unlock()
+		_ = c.conn.Close()
+	})
+}
@@ -0,0 +1,163 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+// Format is the chunk encoding version. Bump it on incompatible changes.
+const Format = 1
+
+// ChunkSize is the target size of a chunk in bytes. A chunk may exceed it by
+// at most one entry.
+const ChunkSize = 4 << 20
+
+// Manifest describes a snapshot of the state taken right after Block.
+type Manifest struct {
+	Format    uint32           `json:"format"`
+	Height    uint64           `json:"height"`
+	BlockHash []byte           `json:"block_hash"`
+	StateRoot []byte           `json:"state_root"`
+	Block     *consensus.Block `json:"block"`
+	Chunks    [][]byte         `json:"chunks"` // sha256 of each chunk, in order
+}
+
+// Validate checks that the manifest is internally consistent: the block hashes
+// to BlockHash and commits to StateRoot.
+func (m *Manifest) Validate() error {
+	if m.Format != Format {
+		return fmt.Errorf("unsupported snapshot format %d", m.Format)
+	}
+	if m.Block == nil {
+		return fmt.Errorf("manifest has no block")
+	}
+	if m.Block.Number != m.Height {
+		return fmt.Errorf("manifest height %d does not match block %d", m.Height, m.Block.Number)
+	}
+	if !bytes.Equal(m.Block.ComputeHash(), m.BlockHash) || !bytes.Equal(m.Block.Hash, m.BlockHash) {
+		return fmt.Errorf("manifest block hash mismatch")
+	}
+	if !bytes.Equal(m.Block.StateRoot, m.StateRoot) {
+		return fmt.Errorf("manifest state root does not match block %d", m.Height)
+	}
+	return nil
+}
+
+// VerifyChunk checks chunk against the hash recorded for index.
+func (m *Manifest) VerifyChunk(index uint32, chunk []byte) error {
+	if int(index) >= len(m.Chunks) {
+		return fmt.Errorf("chunk %d out of range", index)
+	}
+	if sum := sha256.Sum256(chunk); !bytes.Equal(sum[:], m.Chunks[index]) {
+		return fmt.Errorf("chunk %d: hash mismatch", index)
+	}
+	return nil
+}
+
+func DecodeManifest(bz []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(bz, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// chunkWriter splits state entries into chunks of roughly ChunkSize bytes.
+type chunkWriter struct {
+	buf   bytes.Buffer
+	flush func(chunk []byte) error
+}
+
+func (w *chunkWriter) add(key, value []byte) error {
+	var lenBuf [binary.MaxVarintLen64]byte
+	for _, b := range [][]byte{key, value} {
+		n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+		w.buf.Write(lenBuf[:n])
+		w.buf.Write(b)
+	}
+	if w.buf.Len() >= ChunkSize {
+		return w.close()
+	}
+	return nil
+}
+
+func (w *chunkWriter) close() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	err := w.flush(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// decodeChunk parses a chunk back into state entries.
+func decodeChunk(chunk []byte) ([]state.Entry, error) {
+	var entries []state.Entry
+	r := bytes.NewReader(chunk)
+	for r.Len() > 0 {
+		var kv [2][]byte
+		for i := range kv {
+			n, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			if n > uint64(r.Len()) {
+				return nil, fmt.Errorf("truncated chunk")
+			}
+			kv[i] = make([]byte, n)
+			_, _ = r.Read(kv[i])
+		}
+		entries = append(entries, state.Entry{Key: kv[0], Value: kv[1]})
+	}
+	return entries, nil
+}
+
+// Restore replaces the contents of st with the snapshot described by m.
+// fetch is called for each chunk index in order; every chunk is checked
+// against the manifest before it is staged, and the staged state root must
+// match the manifest. The state is only swapped once everything checks
+// out, so on error it is left as it was.
+func Restore(st *state.StateDB, m *Manifest, fetch func(index uint32) ([]byte, error)) (err error) {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	// also drops what an interrupted restore left behind
+	if err := st.DiscardStaged(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = st.DiscardStaged()
+		}
+	}()
+	for i := range m.Chunks {
+		chunk, err := fetch(uint32(i))
+		if err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+		if err := m.VerifyChunk(uint32(i), chunk); err != nil {
+			return err
+		}
+		entries, err := decodeChunk(chunk)
+		if err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+		if err := st.StageEntries(entries); err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+	}
+	root, err := st.StagedRoot()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(root, m.StateRoot) {
+		return fmt.Errorf("restored state root %x does not match snapshot %x", root, m.StateRoot)
+	}
+	return st.CommitStaged()
+}
@@ -0,0 +1,188 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+const manifestFile = "manifest.json"
+
+// Store keeps snapshots on disk, one directory per height:
+//
+//	<dir>/<height>/manifest.json
+//	<dir>/<height>/<index>.chunk
+//
+// Only the most recent keep snapshots are retained.
+type Store struct {
+	dir  string
+	keep int
+
+	mu sync.RWMutex
+}
+
+func NewStore(dir string, keep int) (*Store, error) {
+	if keep <= 0 {
+		keep = 2
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, keep: keep}, nil
+}
+
+// Create writes a snapshot of view, which must reflect the state right after
+// block b, and prunes old snapshots.
+func (s *Store) Create(view *state.View, b *consensus.Block) (*Manifest, error) {
+	root, err := view.Root()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(root, b.StateRoot) {
+		return nil, fmt.Errorf("state has moved past block %d", b.Number)
+	}
+
+	tmp, err := os.MkdirTemp(s.dir, "tmp-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	m := &Manifest{
+		Format:    Format,
+		Height:    b.Number,
+		BlockHash: b.Hash,
+		StateRoot: root,
+		Block:     b,
+	}
+	w := &chunkWriter{flush: func(chunk []byte) error {
+		sum := sha256.Sum256(chunk)
+		m.Chunks = append(m.Chunks, sum[:])
+		return os.WriteFile(filepath.Join(tmp, chunkFile(uint32(len(m.Chunks)-1))), chunk, 0o644)
+	}}
+	if err := view.ForEach(w.add); err != nil {
+		return nil, err
+	}
+	if err := w.close(); err != nil {
+		return nil, err
+	}
+	bz, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, manifestFile), bz, 0o644); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	final := s.path(b.Number)
+	if err := os.RemoveAll(final); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		return nil, err
+	}
+	s.prune()
+	return m, nil
+}
+
+// List returns the manifests of all stored snapshots, newest first.
+func (s *Store) List() ([]*Manifest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	heights, err := s.heights()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Manifest, 0, len(heights))
+	for _, h := range heights {
+		bz, err := os.ReadFile(filepath.Join(s.path(h), manifestFile))
+		if err != nil {
+			return nil, err
+		}
+		m, err := DecodeManifest(bz)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// Manifests implements p2p.SnapshotProvider.
+func (s *Store) Manifests() ([][]byte, error) {
+	ms, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]byte, 0, len(ms))
+	for _, m := range ms {
+		bz, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, bz)
+	}
+	return out, nil
+}
+
+// Chunk implements p2p.SnapshotProvider.
+func (s *Store) Chunk(height uint64, index uint32) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bz, err := os.ReadFile(filepath.Join(s.path(height), chunkFile(index)))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no chunk %d for snapshot %d", index, height)
+	}
+	return bz, err
+}
+
+func (s *Store) path(height uint64) string {
+	return filepath.Join(s.dir, strconv.FormatUint(height, 10))
+}
+
+func chunkFile(index uint32) string {
+	return fmt.Sprintf("%06d.chunk", index)
+}
+
+// heights returns the heights of stored snapshots, newest first.
+func (s *Store) heights() ([]uint64, error) {
+	des, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var hs []uint64
+	for _, de := range des {
+		if !de.IsDir() {
+			continue
+		}
+		h, err := strconv.ParseUint(de.Name(), 10, 64)
+		if err != nil {
+			continue // tmp- directories and strays
+		}
+		hs = append(hs, h)
+	}
+	sort.Slice(hs, func(i, j int) bool { return hs[i] > hs[j] })
+	return hs, nil
+}
+
+// prune removes all but the newest s.keep snapshots. Must be called with s.mu held.
+func (s *Store) prune() {
+	hs, err := s.heights()
+	if err != nil {
+		return
+	}
+	for i := s.keep; i < len(hs); i++ {
+		_ = os.RemoveAll(s.path(hs[i]))
+	}
+}
@@ -0,0 +1,157 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+// Fetcher is the part of p2p.P2P that fast sync needs.
+type Fetcher interface {
+	Peers() []peerstore.ID
+	FetchSnapshotManifests(ctx context.Context, pid peerstore.ID) ([][]byte, error)
+	FetchSnapshotChunk(ctx context.Context, pid peerstore.ID, height uint64, index uint32) ([]byte, error)
+}
+
+type SyncConfig struct {
+	// TrustedHash, if set, is the only block hash a snapshot is accepted for.
+	TrustedHash []byte
+	// MinPeers is how many peers must offer the same snapshot before it is
+	// used when no TrustedHash is configured.
+	MinPeers int
+	// PeerTimeout bounds how long to wait for MinPeers peers to connect.
+	PeerTimeout time.Duration
+}
+
+type offer struct {
+	m     *Manifest
+	peers []peerstore.ID
+	// from is the set of peers, so a peer offering the same snapshot twice
+	// counts once towards MinPeers
+	from map[peerstore.ID]bool
+}
+
+// FastSync restores st from the newest acceptable snapshot offered by peers
+// and resets cons to the snapshot block. Blocks after the snapshot are left
+// to the regular block sync.
+func FastSync(ctx context.Context, f Fetcher, st *state.StateDB, cons *consensus.Consensus, cfg SyncConfig) (*Manifest, error) {
+	if cfg.MinPeers <= 0 {
+		cfg.MinPeers = 1
+	}
+	peers := waitForPeers(ctx, f, cfg.MinPeers, cfg.PeerTimeout)
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no peers to fast sync from")
+	}
+	offers := collectOffers(ctx, f, peers)
+	o, err := pickOffer(offers, cfg)
+	if err != nil {
+		return nil, err
+	}
+	m := o.m
+	log.Printf("Fast sync: restoring snapshot at height %d (%d chunks, %d peers)", m.Height, len(m.Chunks), len(o.peers))
+
+	err = Restore(st, m, func(index uint32) ([]byte, error) {
+		return fetchChunk(ctx, f, m, o.peers, index)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := cons.ResetHead(m.Block); err != nil {
+		return nil, err
+	}
+	log.Printf("Fast sync: state restored at height %d", m.Height)
+	return m, nil
+}
+
+func waitForPeers(ctx context.Context, f Fetcher, min int, timeout time.Duration) []peerstore.ID {
+	deadline := time.Now().Add(timeout)
+	for {
+		peers := f.Peers()
+		if len(peers) >= min || time.Now().After(deadline) {
+			return peers
+		}
+		select {
+		case <-ctx.Done():
+			return peers
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// collectOffers asks every peer for its manifests and groups valid ones by
+// block hash, counting each peer once per snapshot.
+func collectOffers(ctx context.Context, f Fetcher, peers []peerstore.ID) []*offer {
+	byHash := map[string]*offer{}
+	for _, pid := range peers {
+		raw, err := f.FetchSnapshotManifests(ctx, pid)
+		if err != nil {
+			log.Printf("snapshot manifests from %s: %v", pid, err)
+			continue
+		}
+		for _, bz := range raw {
+			m, err := DecodeManifest(bz)
+			if err != nil || m.Validate() != nil {
+				continue
+			}
+			key := hex.EncodeToString(m.BlockHash)
+			o, ok := byHash[key]
+			if !ok {
+				o = &offer{m: m, from: map[peerstore.ID]bool{}}
+				byHash[key] = o
+			}
+			if !o.from[pid] {
+				o.from[pid] = true
+				o.peers = append(o.peers, pid)
+			}
+		}
+	}
+	out := make([]*offer, 0, len(byHash))
+	for _, o := range byHash {
+		out = append(out, o)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].m.Height > out[j].m.Height })
+	return out
+}
+
+func pickOffer(offers []*offer, cfg SyncConfig) (*offer, error) {
+	for _, o := range offers {
+		if len(cfg.TrustedHash) > 0 {
+			if bytes.Equal(o.m.BlockHash, cfg.TrustedHash) {
+				return o, nil
+			}
+			continue
+		}
+		if len(o.peers) >= cfg.MinPeers {
+			return o, nil
+		}
+	}
+	return nil, fmt.Errorf("no acceptable snapshot among %d offers", len(offers))
+}
+
+// fetchChunk downloads a chunk, spreading load across providers and falling
+// over to the next one when a peer fails or serves a bad chunk.
+func fetchChunk(ctx context.Context, f Fetcher, m *Manifest, providers []peerstore.ID, index uint32) ([]byte, error) {
+	var lastErr error
+	for i := range providers {
+		pid := providers[(int(index)+i)%len(providers)]
+		chunk, err := f.FetchSnapshotChunk(ctx, pid, m.Height, index)
+		if err == nil {
+			err = m.VerifyChunk(index, chunk)
+		}
+		if err == nil {
+			return chunk, nil
+		}
+		log.Printf("snapshot chunk %d from %s: %v", index, pid, err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,137 @@
+package staking
+
+import (
+	"sort"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+// View is a read-only copy of the staking state after a block.
+type View struct {
+	Height uint64
+
+	validators  map[string]Validator
+	delegations []Delegation // sorted by validator, then delegator
+	unbonding   []Unbonding  // sorted by completion height
+	rewards     []Reward     // sorted by address, then validator
+}
+
+// ViewAt returns the staking state after block height, or after the head
+// if height is 0. Changes made by a block take effect in the next one.
+// Heights more than consensus.StateHistory blocks below the head are not
+// available.
+func (m *Manager) ViewAt(height uint64) (*View, error) {
+	var v *View
+	err := m.cons.StateAt(height, func(st *state.Overlay, b *consensus.Block) error {
+		var err error
+		v, err = newView(st, b.Number)
+		return err
+	})
+	return v, err
+}
+
+func newView(st *state.Overlay, height uint64) (*View, error) {
+	vals, err := st.Validators()
+	if err != nil {
+		return nil, err
+	}
+	dels, err := st.Delegations("")
+	if err != nil {
+		return nil, err
+	}
+	unbs, err := st.Unbondings(0)
+	if err != nil {
+		return nil, err
+	}
+	rwds, err := st.Rewards("")
+	if err != nil {
+		return nil, err
+	}
+	v := &View{
+		Height:      height,
+		validators:  make(map[string]Validator, len(vals)),
+		delegations: make([]Delegation, 0, len(dels)),
+		unbonding:   make([]Unbonding, 0, len(unbs)),
+		rewards:     make([]Reward, 0, len(rwds)),
+	}
+	for _, val := range vals {
+		v.validators[val.Address] = *val
+	}
+	for _, d := range dels {
+		v.delegations = append(v.delegations, *d)
+	}
+	for _, u := range unbs {
+		v.unbonding = append(v.unbonding, *u)
+	}
+	for _, r := range rwds {
+		v.rewards = append(v.rewards, *r)
+	}
+	return v, nil
+}
+
+// Validators returns all validators, highest stake first.
+func (v *View) Validators() []Validator {
+	out := make([]Validator, 0, len(v.validators))
+	for _, val := range v.validators {
+		out = append(out, val)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Stake != out[j].Stake {
+			return out[i].Stake > out[j].Stake
+		}
+		return out[i].Address < out[j].Address
+	})
+	return out
+}
+
+func (v *View) Validator(addr string) (Validator, bool) {
+	val, ok := v.validators[addr]
+	return val, ok
+}
+
+// DelegationsBy returns the delegations made by delegator.
+func (v *View) DelegationsBy(delegator string) []Delegation {
+	out := []Delegation{}
+	for _, d := range v.delegations {
+		if d.Delegator == delegator {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// DelegationsTo returns the delegations made to validator.
+func (v *View) DelegationsTo(validator string) []Delegation {
+	out := []Delegation{}
+	for _, d := range v.delegations {
+		if d.Validator == validator {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Unbonding returns delegator's stake that is still unbonding, soonest
+// released first.
+func (v *View) Unbonding(delegator string) []Unbonding {
+	out := []Unbonding{}
+	for _, u := range v.unbonding {
+		if u.Delegator == delegator {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// PendingRewards returns the rewards addr has earned as validator or
+// delegator and that have not been paid out yet, by validator.
+func (v *View) PendingRewards(addr string) []Reward {
+	out := []Reward{}
+	for _, r := range v.rewards {
+		if r.Address == addr {
+			out = append(out, r)
+		}
+	}
+	return out
+}
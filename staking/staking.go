@@ -1,100 +1,105 @@
 package staking
 
 import (
-	"fmt"
 	"sync"
 
 	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/core"
 	"github.com/rockandcode4/graphene-proto/state"
 )
 
-type Validator struct {
-	Address string
-	Stake   uint64
-	Active  bool
-}
+// Validators, delegations, unbonding stake and pending rewards are part of
+// the state; see core.ApplyTx for how staking transactions change them and
+// core.EndBlock for how rewards and unbonded stake are paid out.
+type (
+	Validator  = state.Validator
+	Delegation = state.Delegation
+	Unbonding  = state.Unbonding
+	Reward     = state.Reward
+)
+
+// Staking event types.
+const (
+	EventValidatorRegistered = "validator_registered"
+	EventDelegated           = "delegated"
+	EventUndelegated         = "undelegated"
+	// EventSlashed is reserved for slashing, which is not implemented yet.
+	EventSlashed = "slashed"
+)
 
-type Delegation struct {
-	Delegator string
+// Event reports a change to the validator set or to delegations.
+type Event struct {
+	Type      string
 	Validator string
+	Delegator string // empty for validator events
 	Amount    uint64
 }
 
+// Manager answers staking queries from the state and reports staking
+// events. Stake is only bonded and unbonded through the stake, delegate
+// and undelegate transactions of committed blocks.
 type Manager struct {
-	st   *state.StateDB
 	cons *consensus.Consensus
 
-	mu          sync.Mutex
-	validators  map[string]*Validator
-	delegations map[string][]*Delegation // validator -> list
+	mu      sync.Mutex
+	onEvent []func(Event)
 }
 
-func NewManager(st *state.StateDB, cons *consensus.Consensus) *Manager {
-	return &Manager{st: st, cons: cons, validators: make(map[string]*Validator), delegations: make(map[string][]*Delegation)}
+func NewManager(cons *consensus.Consensus) *Manager {
+	m := &Manager{cons: cons}
+	cons.OnReceipts(m.blockEvents)
+	return m
 }
 
-func (m *Manager) RegisterValidator(addr string, stake uint64) error {
+// blockEvents emits the events of the staking logs of a committed block.
+func (m *Manager) blockEvents(_ *consensus.Block, receipts []*core.Receipt) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	// deduct stake from account
-	acct, _ := m.st.GetAccount(addr)
-	if acct.Balance < stake {
-		return fmt.Errorf("insufficient balance")
-	}
-	acct.Balance -= stake
-	if err := m.st.PutAccount(acct); err != nil {
-		return err
-	}
-
-	m.validators[addr] = &Validator{Address: addr, Stake: stake, Active: true}
-	// notify consensus about validator set (simple replacement)
-	var vals []string
-	for k, v := range m.validators {
-		if v.Active {
-			vals = append(vals, k)
+	for _, r := range receipts {
+		for _, l := range r.Logs {
+			switch l.Event {
+			case core.EventStaked:
+				m.emit(Event{Type: EventValidatorRegistered, Validator: l.Topic("validator"), Amount: l.Amount})
+			case core.EventDelegated:
+				m.emit(Event{Type: EventDelegated, Validator: l.Topic("validator"), Delegator: l.Topic("delegator"), Amount: l.Amount})
+			case core.EventUndelegated:
+				m.emit(Event{Type: EventUndelegated, Validator: l.Topic("validator"), Delegator: l.Topic("delegator"), Amount: l.Amount})
+			}
 		}
 	}
-	m.cons.SetValidators(vals)
-	return nil
 }
 
-func (m *Manager) Delegate(delegator, validator string, amount uint64) error {
+// OnEvent registers fn to be called for every staking event. fn runs with
+// the consensus lock held, must not block and must not call back into the
+// Manager or Consensus.
+func (m *Manager) OnEvent(fn func(Event)) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	acct, _ := m.st.GetAccount(delegator)
-	if acct.Balance < amount {
-		return fmt.Errorf("insufficient balance")
-	}
-	acct.Balance -= amount
-	if err := m.st.PutAccount(acct); err != nil {
-		return err
-	}
+	m.onEvent = append(m.onEvent, fn)
+}
 
-	m.delegations[validator] = append(m.delegations[validator], &Delegation{Delegator: delegator, Validator: validator, Amount: amount})
-	// increase validator stake in manager (does not change validator's locked stake here for simplicity)
-	if v, ok := m.validators[validator]; ok {
-		v.Stake += amount
-	} else {
-		// create placeholder validator entry if not present (will not be active until registered)
-		m.validators[validator] = &Validator{Address: validator, Stake: amount, Active: false}
+func (m *Manager) emit(ev Event) {
+	for _, fn := range m.onEvent {
+		fn(ev)
 	}
-	// update consensus validators list for active ones
-	var vals []string
-	for k, v := range m.validators {
-		if v.Active {
-			vals = append(vals, k)
-		}
+}
+
+// StakeOf returns the stake addr has bonded as a validator, excluding
+// delegations to it, and the delegations addr has made, at the head.
+func (m *Manager) StakeOf(addr string) (uint64, []Delegation, error) {
+	v, err := m.ViewAt(0)
+	if err != nil {
+		return 0, nil, err
 	}
-	m.cons.SetValidators(vals)
-	return nil
+	val, _ := v.Validator(addr)
+	return val.SelfStake, v.DelegationsBy(addr), nil
 }
 
-func (m *Manager) GetValidators() []*Validator {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	out := []*Validator{}
-	for _, v := range m.validators {
-		out = append(out, v)
+// GetValidators returns all validators at the head, highest stake first.
+func (m *Manager) GetValidators() ([]Validator, error) {
+	v, err := m.ViewAt(0)
+	if err != nil {
+		return nil, err
 	}
-	return out
+	return v.Validators(), nil
 }
@@ -0,0 +1,327 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Overlay buffers state writes on top of a StateDB. Reads see the buffered
+// writes; the StateDB is only modified by Commit.
+type Overlay struct {
+	base   *StateDB
+	writes map[string][]byte // nil deletes
+	before map[string][]byte // value in the base, nil if absent
+}
+
+// Change is an account written through an Overlay, before and after.
+type Change struct {
+	Before Account
+	After  Account
+}
+
+func NewOverlay(base *StateDB) *Overlay {
+	return &Overlay{base: base, writes: make(map[string][]byte), before: make(map[string][]byte)}
+}
+
+func (o *Overlay) get(key []byte) ([]byte, error) {
+	if bz, ok := o.writes[string(key)]; ok {
+		return bz, nil
+	}
+	return o.base.Get(key)
+}
+
+func (o *Overlay) put(key, value []byte) error {
+	if _, ok := o.before[string(key)]; !ok {
+		prev, err := o.get(key)
+		if err != nil {
+			return err
+		}
+		o.before[string(key)] = prev
+	}
+	o.writes[string(key)] = value
+	return nil
+}
+
+// getJSON decodes the value under key into v and reports whether there was
+// one.
+func (o *Overlay) getJSON(key []byte, v interface{}) (bool, error) {
+	bz, err := o.get(key)
+	if err != nil || bz == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(bz, v)
+}
+
+func (o *Overlay) putJSON(key []byte, v interface{}) error {
+	bz, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return o.put(key, bz)
+}
+
+// each calls fn for every entry under prefix, buffered writes included, in
+// key order.
+func (o *Overlay) each(prefix string, fn func(key, value []byte) error) error {
+	merged := map[string][]byte{}
+	err := o.base.ForEach(prefix, func(key, value []byte) error {
+		merged[string(key)] = append([]byte(nil), value...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for k, v := range o.writes {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if v == nil {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+	keys := make([]string, 0, len(merged))
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn([]byte(k), merged[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAccount returns a copy of the account, so callers must PutAccount
+// their changes.
+func (o *Overlay) GetAccount(addr string) (*Account, error) {
+	a := &Account{Address: addr}
+	if _, err := o.getJSON(accountKey(addr), a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (o *Overlay) PutAccount(a *Account) error {
+	return o.putJSON(accountKey(a.Address), a)
+}
+
+// GetValidator returns the validator at addr, with no stake if there is
+// none.
+func (o *Overlay) GetValidator(addr string) (*Validator, error) {
+	v := &Validator{Address: addr}
+	if _, err := o.getJSON(validatorKey(addr), v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// PutValidator writes v, or deletes it once it has no stake left.
+func (o *Overlay) PutValidator(v *Validator) error {
+	if v.Stake == 0 && !v.Active {
+		return o.put(validatorKey(v.Address), nil)
+	}
+	return o.putJSON(validatorKey(v.Address), v)
+}
+
+// Validators returns every validator, active or not, sorted by address.
+func (o *Overlay) Validators() ([]*Validator, error) {
+	out := []*Validator{}
+	err := o.each(validatorPrefix, func(_, value []byte) error {
+		v := new(Validator)
+		if err := json.Unmarshal(value, v); err != nil {
+			return err
+		}
+		out = append(out, v)
+		return nil
+	})
+	return out, err
+}
+
+// GetDelegation returns the stake delegator has delegated to validator,
+// with a zero Amount if there is none.
+func (o *Overlay) GetDelegation(validator, delegator string) (*Delegation, error) {
+	d := &Delegation{Delegator: delegator, Validator: validator}
+	if _, err := o.getJSON(delegationKey(validator, delegator), d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// PutDelegation writes d, or deletes it if its Amount is zero.
+func (o *Overlay) PutDelegation(d *Delegation) error {
+	if d.Amount == 0 {
+		return o.put(delegationKey(d.Validator, d.Delegator), nil)
+	}
+	return o.putJSON(delegationKey(d.Validator, d.Delegator), d)
+}
+
+// Delegations returns the delegations to validator, or all delegations if
+// validator is empty, sorted by validator and delegator.
+func (o *Overlay) Delegations(validator string) ([]*Delegation, error) {
+	prefix := delegationPrefix
+	if validator != "" {
+		prefix = string(delegationKey(validator, ""))
+	}
+	out := []*Delegation{}
+	err := o.each(prefix, func(_, value []byte) error {
+		d := new(Delegation)
+		if err := json.Unmarshal(value, d); err != nil {
+			return err
+		}
+		out = append(out, d)
+		return nil
+	})
+	return out, err
+}
+
+// GetUnbonding returns the stake delegator is unbonding from validator
+// until height, with a zero Amount if there is none.
+func (o *Overlay) GetUnbonding(height uint64, delegator, validator string) (*Unbonding, error) {
+	u := &Unbonding{Delegator: delegator, Validator: validator, CompletionHeight: height}
+	if _, err := o.getJSON(unbondingKey(height, delegator, validator), u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// PutUnbonding writes u, or deletes it if its Amount is zero.
+func (o *Overlay) PutUnbonding(u *Unbonding) error {
+	key := unbondingKey(u.CompletionHeight, u.Delegator, u.Validator)
+	if u.Amount == 0 {
+		return o.put(key, nil)
+	}
+	return o.putJSON(key, u)
+}
+
+// Unbondings returns the stake released after block height, or all
+// unbonding stake if height is 0, sorted by height, delegator and
+// validator.
+func (o *Overlay) Unbondings(height uint64) ([]*Unbonding, error) {
+	prefix := unbondingPrefix
+	if height != 0 {
+		prefix = unbondingHeightPrefix(height)
+	}
+	out := []*Unbonding{}
+	err := o.each(prefix, func(_, value []byte) error {
+		u := new(Unbonding)
+		if err := json.Unmarshal(value, u); err != nil {
+			return err
+		}
+		out = append(out, u)
+		return nil
+	})
+	return out, err
+}
+
+// GetReward returns the reward owed to addr through validator, with a zero
+// Amount if there is none.
+func (o *Overlay) GetReward(addr, validator string) (*Reward, error) {
+	r := &Reward{Address: addr, Validator: validator}
+	if _, err := o.getJSON(rewardKey(addr, validator), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// PutReward writes r, or deletes it if its Amount is zero.
+func (o *Overlay) PutReward(r *Reward) error {
+	if r.Amount == 0 {
+		return o.put(rewardKey(r.Address, r.Validator), nil)
+	}
+	return o.putJSON(rewardKey(r.Address, r.Validator), r)
+}
+
+// Rewards returns the rewards owed to addr, or all rewards if addr is
+// empty, sorted by address and validator.
+func (o *Overlay) Rewards(addr string) ([]*Reward, error) {
+	prefix := rewardPrefix
+	if addr != "" {
+		prefix = string(rewardKey(addr, ""))
+	}
+	out := []*Reward{}
+	err := o.each(prefix, func(_, value []byte) error {
+		r := new(Reward)
+		if err := json.Unmarshal(value, r); err != nil {
+			return err
+		}
+		out = append(out, r)
+		return nil
+	})
+	return out, err
+}
+
+// Changes returns the accounts that differ from the base, sorted by
+// address.
+func (o *Overlay) Changes() ([]Change, error) {
+	out := []Change{}
+	for k, after := range o.writes {
+		before := o.before[k]
+		if !strings.HasPrefix(k, accountPrefix) || bytes.Equal(before, after) {
+			continue
+		}
+		addr := k[len(accountPrefix):]
+		ch := Change{Before: Account{Address: addr}, After: Account{Address: addr}}
+		for _, v := range []struct {
+			bz []byte
+			a  *Account
+		}{{before, &ch.Before}, {after, &ch.After}} {
+			if v.bz == nil {
+				continue
+			}
+			if err := json.Unmarshal(v.bz, v.a); err != nil {
+				return nil, err
+			}
+		}
+		if ch.Before != ch.After {
+			out = append(out, ch)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].After.Address < out[j].After.Address })
+	return out, nil
+}
+
+// Undo returns the entries that restore the base to what it was before
+// Commit, a nil Value for keys that did not exist.
+func (o *Overlay) Undo() []Entry {
+	out := make([]Entry, 0, len(o.before))
+	for k, v := range o.before {
+		out = append(out, Entry{Key: []byte(k), Value: v})
+	}
+	sort.Slice(out, func(i, j int) bool { return bytes.Compare(out[i].Key, out[j].Key) < 0 })
+	return out
+}
+
+// SetBase makes the overlay start from the entries, in the form Undo
+// returns them, instead of what the StateDB holds, for instance to rewind
+// the state to an earlier block. Changes reports differences from them. An
+// overlay with a replaced base must not be committed.
+func (o *Overlay) SetBase(entries []Entry) {
+	for _, e := range entries {
+		o.writes[string(e.Key)] = e.Value
+		o.before[string(e.Key)] = e.Value
+	}
+}
+
+// Root returns the root the StateDB would have after Commit.
+func (o *Overlay) Root() ([]byte, error) {
+	return o.base.RootWith(o.list())
+}
+
+// Commit writes the buffered state to the StateDB atomically. extra
+// entries, such as the block that led to the state, go in the same write.
+func (o *Overlay) Commit(extra ...Entry) error {
+	return o.base.Write(append(o.list(), extra...))
+}
+
+func (o *Overlay) list() []Entry {
+	out := make([]Entry, 0, len(o.writes))
+	for k, v := range o.writes {
+		out = append(out, Entry{Key: []byte(k), Value: v})
+	}
+	return out
+}
@@ -1,87 +1,46 @@
 package state
 
-import (
-    "encoding/json"
-    "fmt"
-
-    "github.com/syndtr/goleveldb/leveldb"
-    "gfn/store"
-)
-
+// Account is the state of an address, stored as JSON under accountPrefix.
 type Account struct {
-    Address string  `json:"address"`
-    Balance float64 `json:"balance"`
-}
-
-var accounts = make(map[string]*Account)
-var db *leveldb.DB
-
-// Initialize the state (open DB reference)
-func InitState() {
-    db = store.GetDB()
-    if db == nil {
-        fmt.Println("state: no database found")
-        return
-    }
-    loadAccounts()
-}
-
-func loadAccounts() {
-    iter := db.NewIterator(nil, nil)
-    for iter.Next() {
-        key := string(iter.Key())
-        if len(key) > 4 && key[:4] == "acc:" {
-            var acc Account
-            json.Unmarshal(iter.Value(), &acc)
-            accounts[acc.Address] = &acc
-        }
-    }
-    iter.Release()
-    fmt.Printf("Loaded %d accounts\n", len(accounts))
-}
-
-func SaveAccount(acc *Account) error {
-    data, _ := json.Marshal(acc)
-    return db.Put([]byte("acc:"+acc.Address), data, nil)
-}
-
-func GetBalance(addr string) float64 {
-    if acc, ok := accounts[addr]; ok {
-        return acc.Balance
-    }
-    return 0
-}
-
-func Transfer(from, to string, amount float64) error {
-    if GetBalance(from) < amount {
-        return fmt.Errorf("insufficient balance")
-    }
-
-    // Deduct
-    accounts[from].Balance -= amount
-
-    // Add to receiver
-    if _, ok := accounts[to]; !ok {
-        accounts[to] = &Account{Address: to, Balance: 0}
-    }
-    accounts[to].Balance += amount
-
-    // Save both
-    SaveAccount(accounts[from])
-    SaveAccount(accounts[to])
-
-    fmt.Printf("Transferred %.2f GFN from %s to %s\n", amount, from, to)
-    return nil
-}
-
-func Credit(addr string, amount float64) {
-    if _, ok := accounts[addr]; !ok {
-        accounts[addr] = &Account{Address: addr, Balance: 0}
-    }
-    accounts[addr].Balance += amount
-    SaveAccount(accounts[addr])
-}
-
-func Accounts() map[string]*Account {
-    return accounts
+	Address string `json:"address"`
+	Balance uint64 `json:"balance"`
+	Nonce   uint64 `json:"nonce"`
+}
+
+// Validator is the stake bonded to an address, stored as JSON under
+// validatorPrefix. Delegations to an address that never staked itself
+// create an inactive validator.
+type Validator struct {
+	Address string `json:"address"`
+	Stake   uint64 `json:"stake"` // own stake plus delegations
+	// SelfStake is the part of Stake bonded by the validator itself.
+	SelfStake uint64 `json:"self_stake"`
+	Active    bool   `json:"active"`
+}
+
+// Delegation is the stake a delegator has bonded to a validator, stored as
+// JSON under delegationPrefix.
+type Delegation struct {
+	Delegator string `json:"delegator"`
+	Validator string `json:"validator"`
+	Amount    uint64 `json:"amount"`
+}
+
+// Unbonding is undelegated stake waiting to be returned to the delegator
+// after block CompletionHeight, stored as JSON under unbondingPrefix. Stake
+// undelegated from the same validator in the same block is merged.
+type Unbonding struct {
+	Delegator        string `json:"delegator"`
+	Validator        string `json:"validator"`
+	Amount           uint64 `json:"amount"`
+	CompletionHeight uint64 `json:"completion_height"`
+}
+
+// Reward is the part of the tips earned through Validator that is owed to
+// Address, as the validator itself or one of its delegators, and not paid
+// out yet. It is stored as JSON under rewardPrefix.
+type Reward struct {
+	Address   string `json:"address"`
+	Validator string `json:"validator"`
+	Amount    uint64 `json:"amount"`
 }
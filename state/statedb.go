@@ -0,0 +1,348 @@
+package state
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	accountPrefix    = "acc:"
+	delegationPrefix = "del:"
+	rewardPrefix     = "rwd:"
+	unbondingPrefix  = "unb:"
+	validatorPrefix  = "val:"
+)
+
+// statePrefixes lists every key prefix owned by the state. Anything outside
+// these prefixes (blocks, head pointer, ...) is chain data and is not part of
+// the state root or of snapshots. Keep the list sorted.
+var statePrefixes = []string{accountPrefix, delegationPrefix, rewardPrefix, unbondingPrefix, validatorPrefix}
+
+// stagingPrefix holds a state being restored from a snapshot until it is
+// verified and swapped in, see StageEntries.
+const stagingPrefix = "staging:"
+
+// Entry is a raw key/value pair of the state key space. Written through
+// StateDB.Write or an Overlay, a nil Value deletes the key.
+type Entry struct {
+	Key   []byte
+	Value []byte
+}
+
+// StateDB is the account state backed by the node's LevelDB instance.
+type StateDB struct {
+	mu sync.RWMutex
+	db *leveldb.DB
+}
+
+func NewStateDB(db *leveldb.DB) *StateDB {
+	return &StateDB{db: db}
+}
+
+func accountKey(addr string) []byte {
+	return []byte(accountPrefix + addr)
+}
+
+func validatorKey(addr string) []byte {
+	return []byte(validatorPrefix + addr)
+}
+
+// delegationKey groups the delegations to a validator.
+func delegationKey(validator, delegator string) []byte {
+	return []byte(delegationPrefix + validator + ":" + delegator)
+}
+
+// unbondingKey orders unbonding stake by the height it is released at.
+func unbondingKey(height uint64, delegator, validator string) []byte {
+	return []byte(unbondingHeightPrefix(height) + delegator + ":" + validator)
+}
+
+func unbondingHeightPrefix(height uint64) string {
+	return fmt.Sprintf("%s%016x:", unbondingPrefix, height)
+}
+
+// rewardKey groups the rewards owed to an address.
+func rewardKey(addr, validator string) []byte {
+	return []byte(rewardPrefix + addr + ":" + validator)
+}
+
+// Get returns the raw value stored under key, or nil if there is none.
+func (s *StateDB) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bz, err := s.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	return bz, err
+}
+
+// ForEach calls fn for every raw entry whose key starts with prefix, in key
+// order. The slices passed to fn are only valid for the duration of the
+// call.
+func (s *StateDB) ForEach(prefix string, fn func(key, value []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	it := s.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer it.Release()
+	for it.Next() {
+		if err := fn(it.Key(), it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// Write applies raw entries in one atomic batch. It is not limited to the
+// state key space, so chain data can be written together with the state
+// it leads to.
+func (s *StateDB) Write(entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch := new(leveldb.Batch)
+	for _, e := range entries {
+		if e.Value == nil {
+			batch.Delete(e.Key)
+		} else {
+			batch.Put(e.Key, e.Value)
+		}
+	}
+	return s.db.Write(batch, nil)
+}
+
+// GetAccount returns the account stored for addr. Unknown addresses yield an
+// empty account rather than an error.
+func (s *StateDB) GetAccount(addr string) (*Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.getAccount(addr)
+}
+
+func (s *StateDB) getAccount(addr string) (*Account, error) {
+	bz, err := s.db.Get(accountKey(addr), nil)
+	if err == leveldb.ErrNotFound {
+		return &Account{Address: addr}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var a Account
+	if err := json.Unmarshal(bz, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *StateDB) PutAccount(a *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bz, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(accountKey(a.Address), bz, nil)
+}
+
+// Root returns a hash committing to the whole state key space.
+func (s *StateDB) Root() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return computeRoot(s.db.NewIterator, "", nil)
+}
+
+// RootWith returns the root the state would have after writing entries,
+// without writing them.
+func (s *StateDB) RootWith(entries []Entry) ([]byte, error) {
+	pending := append([]Entry(nil), entries...)
+	sort.Slice(pending, func(i, j int) bool { return bytes.Compare(pending[i].Key, pending[j].Key) < 0 })
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return computeRoot(s.db.NewIterator, "", pending)
+}
+
+// View takes a consistent point-in-time view of the state. The caller must
+// Release it when done.
+func (s *StateDB) View() (*View, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &View{snap: snap}, nil
+}
+
+// StageEntries writes raw state entries to the staging area, rejecting keys
+// outside the state key space. The live state is not modified until
+// CommitStaged.
+func (s *StateDB) StageEntries(entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch := new(leveldb.Batch)
+	for _, e := range entries {
+		if !IsStateKey(e.Key) {
+			return fmt.Errorf("key %q is outside the state key space", e.Key)
+		}
+		batch.Put(append([]byte(stagingPrefix), e.Key...), e.Value)
+	}
+	return s.db.Write(batch, nil)
+}
+
+// StagedRoot returns the root the state would have after CommitStaged.
+func (s *StateDB) StagedRoot() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return computeRoot(s.db.NewIterator, stagingPrefix, nil)
+}
+
+// CommitStaged replaces the whole state with the staged entries in one
+// atomic write and empties the staging area.
+func (s *StateDB) CommitStaged() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch := new(leveldb.Batch)
+	err := s.each("", func(key, _ []byte) {
+		batch.Delete(append([]byte(nil), key...))
+	})
+	if err != nil {
+		return err
+	}
+	err = s.each(stagingPrefix, func(key, value []byte) {
+		batch.Delete(append([]byte(nil), key...))
+		batch.Put(append([]byte(nil), key[len(stagingPrefix):]...), append([]byte(nil), value...))
+	})
+	if err != nil {
+		return err
+	}
+	return s.db.Write(batch, nil)
+}
+
+// DiscardStaged empties the staging area.
+func (s *StateDB) DiscardStaged() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch := new(leveldb.Batch)
+	err := s.each(stagingPrefix, func(key, _ []byte) {
+		batch.Delete(append([]byte(nil), key...))
+	})
+	if err != nil {
+		return err
+	}
+	return s.db.Write(batch, nil)
+}
+
+// each calls fn for every state entry stored under prefix.
+func (s *StateDB) each(prefix string, fn func(key, value []byte)) error {
+	for _, p := range statePrefixes {
+		it := s.db.NewIterator(util.BytesPrefix([]byte(prefix+p)), nil)
+		for it.Next() {
+			fn(it.Key(), it.Value())
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsStateKey reports whether key belongs to the state key space.
+func IsStateKey(key []byte) bool {
+	for _, p := range statePrefixes {
+		if strings.HasPrefix(string(key), p) {
+			return true
+		}
+	}
+	return false
+}
+
+// View is a read-only snapshot of the state.
+type View struct {
+	snap *leveldb.Snapshot
+}
+
+// ForEach calls fn for every state entry in key order. The slices passed to
+// fn are only valid for the duration of the call.
+func (v *View) ForEach(fn func(key, value []byte) error) error {
+	for _, p := range statePrefixes {
+		it := v.snap.NewIterator(util.BytesPrefix([]byte(p)), nil)
+		for it.Next() {
+			if err := fn(it.Key(), it.Value()); err != nil {
+				it.Release()
+				return err
+			}
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *View) Root() ([]byte, error) {
+	return computeRoot(v.snap.NewIterator, "", nil)
+}
+
+func (v *View) Release() {
+	v.snap.Release()
+}
+
+// computeRoot hashes every state entry stored under prefix, length-prefixed
+// and without the prefix, in key order. pending, sorted by key, replaces or
+// adds to the stored entries, or deletes them where its Value is nil.
+func computeRoot(newIter func(*util.Range, *opt.ReadOptions) iterator.Iterator, prefix string, pending []Entry) ([]byte, error) {
+	h := sha256.New()
+	var lenBuf [binary.MaxVarintLen64]byte
+	write := func(key, value []byte) {
+		if value == nil {
+			return
+		}
+		for _, b := range [][]byte{key, value} {
+			n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+			h.Write(lenBuf[:n])
+			h.Write(b)
+		}
+	}
+	for _, p := range statePrefixes {
+		var todo []Entry
+		for _, e := range pending {
+			if strings.HasPrefix(string(e.Key), p) {
+				todo = append(todo, e)
+			}
+		}
+		it := newIter(util.BytesPrefix([]byte(prefix+p)), nil)
+		for it.Next() {
+			key := it.Key()[len(prefix):]
+			for len(todo) > 0 && bytes.Compare(todo[0].Key, key) < 0 {
+				write(todo[0].Key, todo[0].Value)
+				todo = todo[1:]
+			}
+			if len(todo) > 0 && bytes.Equal(todo[0].Key, key) {
+				write(todo[0].Key, todo[0].Value)
+				todo = todo[1:]
+				continue
+			}
+			write(key, it.Value())
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return nil, err
+		}
+		for _, e := range todo {
+			write(e.Key, e.Value)
+		}
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rockandcode4/graphene-proto/client"
+)
+
+func TestClientRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Header.Get("Authorization") != "Bearer secret":
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case atomic.AddInt32(&calls, 1) < 3:
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		case strings.Contains(string(body), "Graphene.GetBalance"):
+			io.WriteString(w, `{"result":{"balance":42},"error":null,"id":1}`)
+		default:
+			io.WriteString(w, `{"result":null,"error":"transaction 00 not found","id":1}`)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c, err := client.New(client.Config{URL: srv.URL, Token: "secret", MinBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bal, err := c.GetBalance(ctx, "alice")
+	if err != nil {
+		t.Fatalf("not retried: %v", err)
+	}
+	if bal != 42 || calls != 3 {
+		t.Fatalf("balance %d after %d calls", bal, calls)
+	}
+
+	// method errors are returned as they are
+	_, err = c.GetTransaction(ctx, "00")
+	var rerr *client.RPCError
+	if !errors.As(err, &rerr) || calls != 4 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+
+	// so are errors that retrying cannot fix
+	c, _ = client.New(client.Config{URL: srv.URL, MinBackoff: time.Millisecond})
+	_, err = c.GetBalance(ctx, "alice")
+	var herr *client.HTTPError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got %v", err)
+	}
+}
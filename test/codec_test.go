@@ -0,0 +1,52 @@
+package test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+)
+
+func TestBlockCodecRoundTrip(t *testing.T) {
+	b := &consensus.Block{
+		Number:    7,
+		Prev:      bytes.Repeat([]byte{1}, 32),
+		Time:      1700000000,
+		Txns:      [][]byte{[]byte("a"), []byte("bc")},
+		Proposer:  "val1",
+		StateRoot: bytes.Repeat([]byte{2}, 32),
+	}
+	b.Hash = b.ComputeHash()
+
+	bz := consensus.EncodeBlock(b)
+	got, err := consensus.DecodeBlock(bz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.ComputeHash(), b.Hash) || !bytes.Equal(got.Hash, b.Hash) {
+		t.Fatal("decoded block hash differs")
+	}
+
+	if _, err := consensus.DecodeBlock(bz[:len(bz)-1]); err == nil {
+		t.Fatal("truncated block decoded")
+	}
+	if _, err := consensus.DecodeBlock(append(bz, 0)); err == nil {
+		t.Fatal("block with trailing bytes decoded")
+	}
+}
+
+func TestCompactBlockRoundTrip(t *testing.T) {
+	b := &consensus.Block{Number: 3, Prev: []byte("prev"), Txns: [][]byte{[]byte("tx1"), []byte("tx2")}, Proposer: "val1"}
+	b.Hash = b.ComputeHash()
+
+	cb, err := consensus.DecodeCompactBlock(consensus.EncodeCompactBlock(consensus.NewCompactBlock(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cb.ValidateBasic(); err != nil {
+		t.Fatal(err)
+	}
+	if len(cb.ShortIDs) != 2 || bytes.Equal(cb.ShortIDs[0], cb.ShortIDs[1]) {
+		t.Fatalf("unexpected short ids %x", cb.ShortIDs)
+	}
+}
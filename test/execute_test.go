@@ -0,0 +1,238 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/keystore"
+	"github.com/rockandcode4/graphene-proto/mempool"
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+// alice and bob are the first two accounts of testMnemonic.
+const (
+	testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	alice        = "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"
+	bob          = "0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0"
+)
+
+// testKey returns the key of account i of testMnemonic.
+func testKey(t *testing.T, i uint32) *ecdsa.PrivateKey {
+	t.Helper()
+	priv, err := keystore.DeriveKey(testMnemonic, "", keystore.HDPath(i))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func newConsensus(t *testing.T, st *state.StateDB) *consensus.Consensus {
+	t.Helper()
+	cons, err := consensus.NewConsensus(st, mempool.New(10), nil, consensus.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cons
+}
+
+// nextBlock builds an unsigned block with txs on top of the head of cons
+// and sets its state root by executing them and core.EndBlock on an
+// overlay of st.
+func nextBlock(t *testing.T, st *state.StateDB, cons *consensus.Consensus, txs ...*core.Transaction) *consensus.Block {
+	t.Helper()
+	head := cons.Head()
+	b := &consensus.Block{
+		Number:   head.Number + 1,
+		Prev:     head.Hash,
+		Time:     time.Now().Unix(),
+		Txns:     [][]byte{},
+		Proposer: "test",
+		BaseFee:  cons.NextBaseFee(),
+	}
+	ov := state.NewOverlay(st)
+	var receipts []*core.Receipt
+	var tips uint64
+	for _, tx := range txs {
+		rcpt, err := core.ApplyTx(ov, tx, b.BaseFee, b.Number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Txns = append(b.Txns, core.EncodeTx(tx))
+		b.GasUsed += rcpt.GasUsed
+		tips += rcpt.Tip
+		receipts = append(receipts, rcpt)
+	}
+	if err := core.EndBlock(ov, b.Number, b.Proposer, tips); err != nil {
+		t.Fatal(err)
+	}
+	root, err := ov.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.StateRoot = root
+	b.ReceiptsRoot = consensus.ReceiptsRoot(receipts)
+	b.Hash = b.ComputeHash()
+	return b
+}
+
+func TestImportChecksStateRoot(t *testing.T) {
+	st := newStateDB(t)
+	if err := st.PutAccount(&state.Account{Address: alice, Balance: 1000000}); err != nil {
+		t.Fatal(err)
+	}
+	cons := newConsensus(t, st)
+	tx := &core.Transaction{Type: core.TxTransfer, From: alice, To: bob, Amount: 30, MaxFee: cons.NextBaseFee()}
+	if err := tx.Sign(testKey(t, 0)); err != nil {
+		t.Fatal(err)
+	}
+	before, err := st.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad := nextBlock(t, st, cons, tx)
+	bad.StateRoot = before
+	bad.Hash = bad.ComputeHash()
+	if err := cons.ImportBlock(bad); err == nil {
+		t.Fatal("block with a wrong state root imported")
+	}
+	if root, _ := st.Root(); string(root) != string(before) {
+		t.Fatal("rejected block changed the state")
+	}
+
+	good := nextBlock(t, st, cons, tx)
+	if err := cons.ImportBlock(good); err != nil {
+		t.Fatal(err)
+	}
+	if root, _ := st.Root(); string(root) != string(good.StateRoot) {
+		t.Fatalf("state root %x, block %x", root, good.StateRoot)
+	}
+	if a, _ := st.GetAccount(bob); a.Balance != 30 {
+		t.Fatalf("bob has %d", a.Balance)
+	}
+}
+
+func TestSimulateTxAtRecentHeight(t *testing.T) {
+	st := newStateDB(t)
+	if err := st.PutAccount(&state.Account{Address: alice, Balance: 1000000}); err != nil {
+		t.Fatal(err)
+	}
+	cons := newConsensus(t, st)
+	transfer := func(nonce uint64) *core.Transaction {
+		tx := &core.Transaction{Type: core.TxTransfer, From: alice, To: bob, Amount: 30, Nonce: nonce, MaxFee: 10}
+		if err := tx.Sign(testKey(t, 0)); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	for n := uint64(0); n < 2; n++ {
+		if err := cons.ImportBlock(nextBlock(t, st, cons, transfer(n))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if a, err := cons.AccountAt(bob, 1); err != nil || a.Balance != 30 {
+		t.Fatalf("bob after block 1: %+v, %v", a, err)
+	}
+	// the second transfer replayed on top of block 1
+	rcpt, changes, err := cons.SimulateTx(transfer(1), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rcpt.Success || len(changes) != 2 || changes[0].Before.Balance != 30 || changes[0].After.Balance != 60 {
+		t.Fatalf("unexpected simulation: %+v, %+v", rcpt, changes)
+	}
+	// it is spent at the head
+	if _, _, err := cons.SimulateTx(transfer(1), 0); !errors.Is(err, core.ErrNonceTooLow) {
+		t.Fatalf("at the head: got %v", err)
+	}
+	if _, _, err := cons.SimulateTx(transfer(1), 3); err == nil {
+		t.Fatal("simulated above the head")
+	}
+}
+
+func TestApplyTxOnOverlay(t *testing.T) {
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := state.NewStateDB(db)
+	if err := st.PutAccount(&state.Account{Address: alice, Balance: 1000000}); err != nil {
+		t.Fatal(err)
+	}
+
+	ov := state.NewOverlay(st)
+	// the tip is capped at max fee minus base fee: 3 per gas in total
+	tx := &core.Transaction{Type: core.TxTransfer, From: alice, To: bob, Amount: 30, MaxFee: 3, Tip: 2}
+	rcpt, err := core.ApplyTx(ov, tx, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rcpt.Fee != 3*core.GasTransfer || rcpt.Burned != 2*core.GasTransfer || rcpt.Tip != core.GasTransfer {
+		t.Fatalf("unexpected receipt: %+v", rcpt)
+	}
+	if len(rcpt.Logs) != 1 || rcpt.Logs[0].Event != core.EventTransfer || rcpt.Logs[0].Topic("to") != bob || rcpt.Logs[0].Amount != 30 {
+		t.Fatalf("unexpected logs: %+v", rcpt.Logs)
+	}
+	changes, err := ov.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// changes come sorted by address, bob's first
+	if len(changes) != 2 || changes[1].After.Balance != 1000000-30-rcpt.Fee || changes[1].After.Nonce != 1 || changes[0].After.Balance != 30 {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	if a, _ := st.GetAccount(alice); a.Balance != 1000000 || a.Nonce != 0 {
+		t.Fatalf("overlay wrote through to the state: %+v", a)
+	}
+
+	// replaying the same nonce fails
+	if _, err := core.ApplyTx(ov, tx, 2, 1); !errors.Is(err, core.ErrNonceTooLow) {
+		t.Fatalf("stale nonce: got %v", err)
+	}
+	// so does a max fee below the base fee
+	tx = &core.Transaction{Type: core.TxTransfer, From: alice, To: bob, Amount: 30, Nonce: 1, MaxFee: 3}
+	if _, err := core.ApplyTx(ov, tx, 4, 1); err == nil {
+		t.Fatal("underpriced tx accepted")
+	}
+
+	// an amount the sender cannot cover fails but still pays the fee
+	tx = &core.Transaction{Type: core.TxTransfer, From: alice, To: bob, Amount: 1000000, Nonce: 1, MaxFee: 2}
+	rcpt, err = core.ApplyTx(ov, tx, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rcpt.Success || rcpt.Error == "" || len(rcpt.Logs) != 0 {
+		t.Fatalf("unexpected receipt: %+v", rcpt)
+	}
+	if a, _ := ov.GetAccount(alice); a.Nonce != 2 || a.Balance != 1000000-30-3*core.GasTransfer-2*core.GasTransfer {
+		t.Fatalf("unexpected sender: %+v", a)
+	}
+}
+
+func TestNextBaseFee(t *testing.T) {
+	p := consensus.Params{BlockGasLimit: 1000, MinBaseFee: 10}
+	cases := []struct {
+		baseFee, gasUsed, want uint64
+	}{
+		{0, 0, 10},       // genesis starts at the minimum
+		{800, 500, 800},  // at the target
+		{800, 1000, 900}, // full block: +1/8
+		{800, 0, 700},    // empty block: -1/8
+		{800, 750, 850},
+		{10, 0, 10}, // never below the minimum
+		{10, 501, 11},
+	}
+	for _, c := range cases {
+		if got := p.NextBaseFee(&consensus.Block{BaseFee: c.baseFee, GasUsed: c.gasUsed}); got != c.want {
+			t.Errorf("base fee %d, gas used %d: got %d, want %d", c.baseFee, c.gasUsed, got, c.want)
+		}
+	}
+}
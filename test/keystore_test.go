@@ -0,0 +1,89 @@
+package test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	gethks "github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/keystore"
+)
+
+func TestKeystore(t *testing.T) {
+	priv, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := keystore.NewStore(filepath.Join(t.TempDir(), "keys"))
+	ks.ScryptN, ks.ScryptP = keystore.LightScryptN, keystore.LightScryptP
+	if err := ks.Save(&keystore.Key{Name: "alice", PrivateKey: priv}, "pw"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Save(&keystore.Key{Name: "alice", PrivateKey: priv}, "pw"); !errors.Is(err, keystore.ErrExists) {
+		t.Fatalf("overwrote a key: %v", err)
+	}
+
+	if _, err := ks.Load("alice", "wrong"); !errors.Is(err, keystore.ErrDecrypt) {
+		t.Fatalf("wrong passphrase: %v", err)
+	}
+	k, err := ks.Load("alice", "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Address != core.PubKeyToAddress(&priv.PublicKey).Hex() || !k.PrivateKey.Equal(priv) {
+		t.Fatalf("loaded %s %x", k.Address, crypto.FromECDSA(k.PrivateKey))
+	}
+	infos, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].PubKey != k.Info().PubKey {
+		t.Fatalf("list %+v", infos)
+	}
+	if _, err := ks.Load("bob", "pw"); !errors.Is(err, keystore.ErrNotFound) {
+		t.Fatalf("missing key: %v", err)
+	}
+
+	// key files stay readable by other keystore v3 tools
+	bz, err := keystore.Encrypt(k, "pw", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gk, err := gethks.DecryptKey(bz, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gk.PrivateKey.Equal(priv) {
+		t.Fatal("geth decrypted a different key")
+	}
+}
+
+func TestHDDerivation(t *testing.T) {
+	const mnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	for i, want := range []string{
+		"0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+		"0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0",
+	} {
+		priv, err := keystore.DeriveKey(mnemonic, "", keystore.HDPath(uint32(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := core.PubKeyToAddress(&priv.PublicKey).Hex(); got != want {
+			t.Fatalf("index %d: got %s, want %s", i, got, want)
+		}
+	}
+
+	m, err := keystore.NewMnemonic(24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keystore.ValidateMnemonic("  " + m + "\n"); err != nil {
+		t.Fatalf("new mnemonic: %v", err)
+	}
+	if _, err := keystore.DeriveKey(mnemonic[:len(mnemonic)-5]+"abandon", "", keystore.DefaultHDPath); !errors.Is(err, keystore.ErrInvalidMnemonic) {
+		t.Fatalf("bad checksum: %v", err)
+	}
+}
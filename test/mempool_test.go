@@ -0,0 +1,146 @@
+package test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/mempool"
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+func TestMempoolAdmission(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := core.PubKeyToAddress(&key.PublicKey).Hex()
+	st := newStateDB(t)
+	if err := st.PutAccount(&state.Account{Address: from, Balance: 1000000, Nonce: 5}); err != nil {
+		t.Fatal(err)
+	}
+	tx := func(nonce, amount, tip uint64) []byte {
+		tx := &core.Transaction{Type: core.TxTransfer, From: from, To: bob, Amount: amount, Nonce: nonce, Tip: tip, MaxFee: 10}
+		if err := tx.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+		return core.EncodeTx(tx)
+	}
+
+	pool := mempool.New(3)
+	pool.SetAccounts(st)
+	for _, tc := range []struct {
+		name string
+		tx   []byte
+		want error
+	}{
+		{"next nonce", tx(5, 1, 1), nil},
+		{"same tx", tx(5, 1, 1), mempool.ErrKnown},
+		{"used nonce", tx(4, 1, 1), core.ErrNonceTooLow},
+		{"future nonce", tx(6, 1, 1), nil},
+		{"nonce too far ahead", tx(5+mempool.MaxNonceGap, 1, 1), mempool.ErrNonceGap},
+		{"cannot pay", tx(7, 1000000, 1), mempool.ErrInsufficientFunds},
+		{"replacement with the same tip", tx(5, 2, 1), mempool.ErrUnderpriced},
+		{"replacement with a higher tip", tx(5, 2, 2), nil},
+		{"fills the pool", tx(7, 1, 3), nil},
+		{"full, tip too low to evict", tx(8, 1, 1), mempool.ErrFull},
+		{"full, evicts the lowest tip", tx(8, 1, 4), nil},
+	} {
+		if err := pool.Add(tc.tx); !errors.Is(err, tc.want) {
+			t.Fatalf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	if pool.Size() != 3 || pool.Has(mempool.Key(tx(6, 1, 1))) || !pool.Has(mempool.Key(tx(5, 2, 2))) {
+		t.Fatalf("unexpected pool of %d transactions", pool.Size())
+	}
+}
+
+// The amount of an undelegation comes out of bonded stake, so only its fee
+// must be covered by the balance.
+func TestMempoolUndelegateCost(t *testing.T) {
+	st := newStateDB(t)
+	if err := st.PutAccount(&state.Account{Address: alice, Balance: 10 * core.GasUndelegate}); err != nil {
+		t.Fatal(err)
+	}
+	pool := mempool.New(3)
+	pool.SetAccounts(st)
+	for i, typ := range []string{core.TxUndelegate, core.TxDelegate} {
+		tx := &core.Transaction{Type: typ, From: alice, Validator: bob, Amount: 1000000, Nonce: uint64(i), MaxFee: 10}
+		if err := tx.Sign(testKey(t, 0)); err != nil {
+			t.Fatal(err)
+		}
+		err := pool.Add(core.EncodeTx(tx))
+		if want := typ == core.TxDelegate; errors.Is(err, mempool.ErrInsufficientFunds) != want {
+			t.Fatalf("%s of more than the balance: %v", typ, err)
+		}
+	}
+}
+
+func TestReapByTip(t *testing.T) {
+	st := newStateDB(t)
+	keys := make([]*ecdsa.PrivateKey, 4)
+	for i := range keys {
+		keys[i] = testKey(t, uint32(i))
+		addr := core.PubKeyToAddress(&keys[i].PublicKey).Hex()
+		if err := st.PutAccount(&state.Account{Address: addr, Balance: 1000000}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tx := func(sender int, nonce, tip, maxFee uint64) []byte {
+		key := keys[sender]
+		tx := &core.Transaction{Type: core.TxTransfer, From: core.PubKeyToAddress(&key.PublicKey).Hex(), To: bob, Amount: 1, Nonce: nonce, Tip: tip, MaxFee: maxFee}
+		if err := tx.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+		return core.EncodeTx(tx)
+	}
+	// pooled in this order
+	a0, a1 := tx(0, 0, 1, 20), tx(0, 1, 1, 20)
+	under := tx(1, 0, 9, 9) // max fee below the base fee of 10
+	b1, b0 := tx(2, 1, 9, 20), tx(2, 0, 5, 20)
+	c0, c1 := tx(3, 0, 3, 20), tx(3, 1, 12, 20)
+
+	pool := mempool.New(10)
+	pool.SetAccounts(st)
+	for _, bz := range [][]byte{a0, a1, under, b1, b0, c0, c1} {
+		if err := pool.Add(bz); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	name := map[string]string{string(a0): "a0", string(a1): "a1", string(b0): "b0", string(b1): "b1", string(c0): "c0", string(c1): "c1", string(under): "under"}
+	names := func(txs [][]byte) []string {
+		out := []string{}
+		for _, bz := range txs {
+			out = append(out, name[string(bz)])
+		}
+		return out
+	}
+	var offered [][]byte
+	reap := func(maxBytes int, refuse []byte) []string {
+		offered = nil
+		return names(pool.Reap(10, maxBytes, func(bz []byte) bool {
+			offered = append(offered, bz)
+			return !bytes.Equal(bz, refuse)
+		}))
+	}
+
+	// b's and c's higher tips wait for their lower nonces
+	if got, want := reap(1<<20, nil), []string{"b0", "b1", "c0", "c1", "a0", "a1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("reaped %v, want %v", got, want)
+	}
+	// a refused transaction skips the sender's later nonces, not the rest
+	if got, want := reap(1<<20, b0), []string{"c0", "c1", "a0", "a1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("with b0 refused: reaped %v, want %v", got, want)
+	}
+	for _, bz := range offered {
+		if bytes.Equal(bz, b1) || bytes.Equal(bz, under) {
+			t.Fatalf("offered %s", name[string(bz)])
+		}
+	}
+}
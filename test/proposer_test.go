@@ -0,0 +1,85 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+func TestImportChecksProposer(t *testing.T) {
+	st := newStateDB(t)
+
+	keys := map[string]*ecdsa.PrivateKey{}
+	var vals []string
+	for i := 0; i < 2; i++ {
+		k, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := core.PubKeyToAddress(&k.PublicKey).Hex()
+		keys[addr] = k
+		vals = append(vals, addr)
+	}
+	sort.Strings(vals)
+	ov := state.NewOverlay(st)
+	for _, v := range vals {
+		if err := ov.PutValidator(&state.Validator{Address: v, Stake: 100, SelfStake: 100, Active: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ov.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// the validator set is read from the state
+	cons := newConsensus(t, st)
+	root, err := st.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// block 1 is in the slot of vals[1]
+	block := func(proposer, signer string) *consensus.Block {
+		head := cons.Head()
+		b := &consensus.Block{
+			Number:       head.Number + 1,
+			Prev:         head.Hash,
+			Time:         time.Now().Unix(),
+			Proposer:     proposer,
+			StateRoot:    root,
+			ReceiptsRoot: consensus.ReceiptsRoot(nil),
+			BaseFee:      cons.NextBaseFee(),
+		}
+		b.Hash = b.ComputeHash()
+		if signer != "" {
+			if err := b.Sign(keys[signer]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return b
+	}
+	for _, tc := range []struct {
+		name             string
+		proposer, signer string
+	}{
+		{"unsigned", vals[1], ""},
+		{"signed by another validator", vals[1], vals[0]},
+		{"out of turn", vals[0], vals[0]},
+	} {
+		if err := cons.ImportBlock(block(tc.proposer, tc.signer)); err == nil {
+			t.Fatalf("%s: block imported", tc.name)
+		}
+	}
+	if err := cons.ImportBlock(block(vals[1], vals[1])); err != nil {
+		t.Fatal(err)
+	}
+	if err := cons.ImportBlock(block(vals[0], vals[0])); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,215 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	peerstore "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/syndtr/goleveldb/leveldb"
+
+	"github.com/rockandcode4/graphene-proto/consensus"
+	"github.com/rockandcode4/graphene-proto/snapshot"
+	"github.com/rockandcode4/graphene-proto/staking"
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+func newStateDB(t *testing.T) *state.StateDB {
+	db, err := leveldb.OpenFile(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return state.NewStateDB(db)
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	src := newStateDB(t)
+	for i := 0; i < 50; i++ {
+		if err := src.PutAccount(&state.Account{Address: fmt.Sprintf("addr%d", i), Balance: uint64(i * 10)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, err := src.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &consensus.Block{Number: consensus.EpochLength, Prev: []byte("prev"), StateRoot: root}
+	b.Hash = b.ComputeHash()
+
+	store, err := snapshot.NewStore(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, err := src.View()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := store.Create(view, b)
+	view.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newStateDB(t)
+	_ = dst.PutAccount(&state.Account{Address: "stale", Balance: 1})
+	err = snapshot.Restore(dst, m, func(i uint32) ([]byte, error) { return store.Chunk(m.Height, i) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := dst.Root()
+	if !bytes.Equal(got, root) {
+		t.Fatalf("restored root %x, want %x", got, root)
+	}
+	if a, _ := dst.GetAccount("stale"); a.Balance != 0 {
+		t.Fatal("stale account survived restore")
+	}
+}
+
+func TestSnapshotRejectsTamperedChunk(t *testing.T) {
+	src := newStateDB(t)
+	_ = src.PutAccount(&state.Account{Address: "alice", Balance: 100})
+	root, _ := src.Root()
+	b := &consensus.Block{Number: consensus.EpochLength, StateRoot: root}
+	b.Hash = b.ComputeHash()
+
+	store, _ := snapshot.NewStore(t.TempDir(), 1)
+	view, _ := src.View()
+	m, err := store.Create(view, b)
+	view.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newStateDB(t)
+	_ = dst.PutAccount(&state.Account{Address: "bob", Balance: 7})
+	before, _ := dst.Root()
+	err = snapshot.Restore(dst, m, func(i uint32) ([]byte, error) {
+		chunk, err := store.Chunk(m.Height, i)
+		chunk[len(chunk)-1] ^= 0xff
+		return chunk, err
+	})
+	if err == nil {
+		t.Fatal("tampered chunk was accepted")
+	}
+	if after, _ := dst.Root(); !bytes.Equal(after, before) {
+		t.Fatal("failed restore changed the state")
+	}
+}
+
+// fetcher serves the same manifests, and the chunks of store if set, from
+// every peer.
+type fetcher struct {
+	peers     []peerstore.ID
+	manifests [][]byte
+	store     *snapshot.Store
+}
+
+func (f *fetcher) Peers() []peerstore.ID { return f.peers }
+
+func (f *fetcher) FetchSnapshotManifests(context.Context, peerstore.ID) ([][]byte, error) {
+	return f.manifests, nil
+}
+
+func (f *fetcher) FetchSnapshotChunk(_ context.Context, _ peerstore.ID, height uint64, index uint32) ([]byte, error) {
+	if f.store == nil {
+		return nil, errors.New("no chunks")
+	}
+	return f.store.Chunk(height, index)
+}
+
+func TestFastSyncCountsPeersOnce(t *testing.T) {
+	b := &consensus.Block{Number: consensus.EpochLength, StateRoot: []byte("root")}
+	b.Hash = b.ComputeHash()
+	bz, err := json.Marshal(&snapshot.Manifest{Format: snapshot.Format, Height: b.Number, BlockHash: b.Hash, StateRoot: b.StateRoot, Block: b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := snapshot.SyncConfig{MinPeers: 2, PeerTimeout: time.Millisecond}
+	for _, tc := range []struct {
+		name    string
+		peers   []peerstore.ID
+		wantErr string
+	}{
+		// one peer offering the same snapshot twice is not two peers
+		{"one peer", []peerstore.ID{"a"}, "no acceptable snapshot"},
+		{"repeated peer", []peerstore.ID{"a", "a"}, "no acceptable snapshot"},
+		{"two peers", []peerstore.ID{"a", "b"}, "does not match snapshot"},
+	} {
+		f := &fetcher{peers: tc.peers, manifests: [][]byte{bz, bz}}
+		_, err := snapshot.FastSync(context.Background(), f, newStateDB(t), nil, cfg)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: got %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestFastSyncRestoresStaking(t *testing.T) {
+	src := newStateDB(t)
+	ov := state.NewOverlay(src)
+	for _, err := range []error{
+		ov.PutAccount(&state.Account{Address: bob, Balance: 1000}),
+		ov.PutValidator(&state.Validator{Address: alice, Stake: 300, SelfStake: 100, Active: true}),
+		ov.PutDelegation(&state.Delegation{Delegator: bob, Validator: alice, Amount: 200}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ov.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	root, err := src.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &consensus.Block{Number: consensus.EpochLength, Prev: []byte("prev"), StateRoot: root}
+	b.Hash = b.ComputeHash()
+	store, err := snapshot.NewStore(t.TempDir(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, err := src.View()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Create(view, b)
+	view.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := store.Manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newStateDB(t)
+	cons := newConsensus(t, dst)
+	m := staking.NewManager(cons)
+	f := &fetcher{peers: []peerstore.ID{"a", "b"}, manifests: manifests, store: store}
+	if _, err := snapshot.FastSync(context.Background(), f, dst, cons, snapshot.SyncConfig{MinPeers: 2, PeerTimeout: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := m.ViewAt(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val, ok := v.Validator(alice); v.Height != b.Number || !ok || val.Stake != 300 || len(v.DelegationsBy(bob)) != 1 {
+		t.Fatalf("staking after fast sync at %d: %+v, delegations %+v", v.Height, val, v.DelegationsBy(bob))
+	}
+	// the restored validator set is enforced on the next block
+	if err := cons.ImportBlock(nextBlock(t, dst, cons)); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Fatalf("unsigned block after fast sync: %v", err)
+	}
+	// the snapshot block is the base of the stored chain
+	if head := newConsensus(t, dst).Head(); head.Number != b.Number || !bytes.Equal(head.Hash, b.Hash) {
+		t.Fatalf("head after restart %d, want %d", head.Number, b.Number)
+	}
+}
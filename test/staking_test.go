@@ -0,0 +1,216 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rockandcode4/graphene-proto/core"
+	"github.com/rockandcode4/graphene-proto/staking"
+	"github.com/rockandcode4/graphene-proto/state"
+)
+
+func TestSelfStakeExcludesDelegations(t *testing.T) {
+	st := newStateDB(t)
+	for _, addr := range []string{alice, bob} {
+		if err := st.PutAccount(&state.Account{Address: addr, Balance: 1000000}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cons := newConsensus(t, st)
+	m := staking.NewManager(cons)
+
+	keys := map[string]uint32{alice: 0, bob: 1}
+	nonces := map[string]uint64{}
+	tx := func(typ, from, validator string, amount uint64) *core.Transaction {
+		tx := &core.Transaction{Type: typ, From: from, Validator: validator, Amount: amount, Nonce: nonces[from], MaxFee: cons.NextBaseFee()}
+		if err := tx.Sign(testKey(t, keys[from])); err != nil {
+			t.Fatal(err)
+		}
+		nonces[from]++
+		return tx
+	}
+	b := nextBlock(t, st, cons,
+		tx(core.TxStake, alice, "", 100),
+		tx(core.TxDelegate, bob, alice, 300),
+		tx(core.TxStake, alice, "", 50), // registering again
+	)
+	if err := cons.ImportBlock(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// stake is bonded by the block itself
+	if self, _, err := m.StakeOf(alice); err != nil || self != 150 {
+		t.Fatalf("self stake %d, %v", self, err)
+	}
+	vals, err := m.GetValidators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vals) != 1 || vals[0].Stake != 450 || vals[0].SelfStake != 150 {
+		t.Fatalf("validators %+v", vals)
+	}
+	_, dels, err := m.StakeOf(bob)
+	if err != nil || len(dels) != 1 || dels[0].Amount != 300 {
+		t.Fatalf("delegation survived re-registration as %+v, %v", dels, err)
+	}
+	if v, err := m.ViewAt(0); err != nil || v.Height != 1 {
+		t.Fatalf("head view: %+v, %v", v, err)
+	}
+
+	// alice proposes from the next block on, so an unsigned one is refused
+	if err := cons.ImportBlock(nextBlock(t, st, cons)); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Fatalf("unsigned block after the stake: %v", err)
+	}
+}
+
+func TestUndelegateUnbonds(t *testing.T) {
+	st := newStateDB(t)
+	for _, addr := range []string{alice, bob} {
+		if err := st.PutAccount(&state.Account{Address: addr, Balance: 1000000}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cons := newConsensus(t, st)
+	m := staking.NewManager(cons)
+	var events []staking.Event
+	m.OnEvent(func(ev staking.Event) { events = append(events, ev) })
+
+	keys := map[string]uint32{alice: 0, bob: 1}
+	nonces := map[string]uint64{}
+	tx := func(typ, from, validator string, amount uint64) *core.Transaction {
+		tx := &core.Transaction{Type: typ, From: from, Validator: validator, Amount: amount, Nonce: nonces[from], MaxFee: cons.NextBaseFee()}
+		if err := tx.Sign(testKey(t, keys[from])); err != nil {
+			t.Fatal(err)
+		}
+		nonces[from]++
+		return tx
+	}
+	if err := cons.ImportBlock(nextBlock(t, st, cons, tx(core.TxStake, alice, "", 100), tx(core.TxDelegate, bob, alice, 300))); err != nil {
+		t.Fatal(err)
+	}
+	// alice proposes from now on; the blocks pay no tips, so the proposer
+	// does not change the state root
+	b := nextBlock(t, st, cons, tx(core.TxUndelegate, bob, alice, 400), tx(core.TxUndelegate, bob, alice, 100))
+	b.Proposer = alice
+	b.Hash = b.ComputeHash()
+	if err := b.Sign(testKey(t, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cons.ImportBlock(b); err != nil {
+		t.Fatal(err)
+	}
+	receipts := cons.BlockReceipts(2)
+	if len(receipts) != 2 || receipts[0].Success || !strings.Contains(receipts[0].Error, "insufficient stake") || !receipts[1].Success {
+		t.Fatalf("receipts %+v", receipts)
+	}
+	if len(events) != 3 || events[2].Type != staking.EventUndelegated || events[2].Delegator != bob || events[2].Amount != 100 {
+		t.Fatalf("events %+v", events)
+	}
+
+	v, err := m.ViewAt(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unb := v.Unbonding(bob)
+	if len(unb) != 1 || unb[0].Amount != 100 || unb[0].Validator != alice || unb[0].CompletionHeight != 2+core.UnbondingBlocks {
+		t.Fatalf("unbonding %+v", unb)
+	}
+	if val, _ := v.Validator(alice); val.Stake != 300 || val.SelfStake != 100 || !val.Active {
+		t.Fatalf("validator %+v", val)
+	}
+	// the amount stays out of the balance until the unbonding completes
+	fees := 2 * core.GasDelegate * b.BaseFee
+	if acct, _ := st.GetAccount(bob); acct.Balance != 1000000-300-core.GasDelegate*cons.BlockByNumber(1).BaseFee-fees {
+		t.Fatalf("balance while unbonding %d", acct.Balance)
+	}
+}
+
+func TestUnbondingAndRewardPayout(t *testing.T) {
+	st := newStateDB(t)
+	for _, addr := range []string{alice, bob} {
+		if err := st.PutAccount(&state.Account{Address: addr, Balance: 1000000}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ov := state.NewOverlay(st)
+	nonces := map[string]uint64{}
+	apply := func(typ, from, validator string, amount, height uint64) *core.Receipt {
+		t.Helper()
+		rcpt, err := core.ApplyTx(ov, &core.Transaction{Type: typ, From: from, Validator: validator, Amount: amount, Nonce: nonces[from], MaxFee: 1}, 1, height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonces[from]++
+		return rcpt
+	}
+	balance := func(addr string) uint64 {
+		t.Helper()
+		acct, err := ov.GetAccount(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return acct.Balance
+	}
+	apply(core.TxStake, alice, "", 100, 1)
+	apply(core.TxDelegate, bob, alice, 300, 1)
+
+	// tips of a validator's blocks are shared pro rata as pending rewards
+	aliceBefore, bobBefore := balance(alice), balance(bob)
+	if err := core.EndBlock(ov, 98, alice, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.EndBlock(ov, 99, alice, 3); err != nil {
+		t.Fatal(err)
+	}
+	rewards, err := ov.Rewards("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sorted by address, bob's first
+	if len(rewards) != 2 || rewards[0].Address != bob || rewards[0].Amount != 750+2 || rewards[1].Address != alice || rewards[1].Amount != 250+1 {
+		t.Fatalf("pending rewards %+v", rewards)
+	}
+	if balance(alice) != aliceBefore || balance(bob) != bobBefore {
+		t.Fatal("rewards paid before the end of the epoch")
+	}
+	// a proposer that is not a validator is paid at once
+	if err := core.EndBlock(ov, 99, "0xproposer", 7); err != nil {
+		t.Fatal(err)
+	}
+	if balance("0xproposer") != 7 {
+		t.Fatal("tips of a non-validator proposer not paid")
+	}
+
+	// the validator undelegating all of its own stake is deactivated
+	if rcpt := apply(core.TxUndelegate, alice, alice, 100, 99); !rcpt.Success {
+		t.Fatalf("self undelegation failed: %s", rcpt.Error)
+	}
+	if v, _ := ov.GetValidator(alice); v.Active || v.Stake != 300 || v.SelfStake != 0 {
+		t.Fatalf("validator after self undelegation %+v", v)
+	}
+	aliceBefore = balance(alice)
+	if err := core.EndBlock(ov, core.RewardInterval, alice, 0); err != nil {
+		t.Fatal(err)
+	}
+	if balance(alice) != aliceBefore+251 || balance(bob) != bobBefore+752 {
+		t.Fatalf("rewards paid out %d, %d", balance(alice)-aliceBefore, balance(bob)-bobBefore)
+	}
+	if rewards, _ := ov.Rewards(""); len(rewards) != 0 {
+		t.Fatalf("rewards left after payout %+v", rewards)
+	}
+
+	// unbonded stake returns at its completion height, not before
+	release := 99 + uint64(core.UnbondingBlocks)
+	if err := core.EndBlock(ov, release-1, bob, 0); err != nil {
+		t.Fatal(err)
+	}
+	if balance(alice) != aliceBefore+251 {
+		t.Fatal("stake released early")
+	}
+	if err := core.EndBlock(ov, release, bob, 0); err != nil {
+		t.Fatal(err)
+	}
+	if unb, _ := ov.Unbondings(0); balance(alice) != aliceBefore+251+100 || len(unb) != 0 {
+		t.Fatalf("stake not released: balance %d, unbonding %+v", balance(alice), unb)
+	}
+}
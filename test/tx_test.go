@@ -0,0 +1,145 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/rockandcode4/graphene-proto/core"
+)
+
+func TestTxSignatureCheck(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := &core.Transaction{Type: core.TxTransfer, From: core.PubKeyToAddress(&key.PublicKey).Hex(), To: bob, Amount: 10, Nonce: 1}
+	if err := tx.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	bz := core.EncodeTx(tx)
+	if _, err := core.CheckTx(bz); err != nil {
+		t.Fatalf("signed tx rejected: %v", err)
+	}
+
+	// a valid signature by someone else's key does not move the sender's funds
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := *tx
+	if err := forged.Sign(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := core.CheckTx(core.EncodeTx(&forged)); err == nil {
+		t.Fatal("tx signed by another key accepted")
+	}
+
+	tx.Amount = 1000
+	bz = core.EncodeTx(tx)
+	got, err := core.CheckTx(bz)
+	if err == nil {
+		pub, _ := got.SenderPubKey()
+		if crypto.PubkeyToAddress(*pub) == crypto.PubkeyToAddress(key.PublicKey) {
+			t.Fatal("tampered tx still recovers the signer")
+		}
+	}
+
+	tx.Signature = nil
+	bz = core.EncodeTx(tx)
+	if _, err := core.CheckTx(bz); err == nil {
+		t.Fatal("unsigned tx accepted")
+	}
+}
+
+func TestAddress(t *testing.T) {
+	for _, s := range []string{alice, strings.ToLower(alice), "0x" + strings.ToUpper(alice[2:])} {
+		a, err := core.ParseAddress(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if a.Hex() != alice {
+			t.Fatalf("%s parsed as %s", s, a)
+		}
+	}
+	for _, s := range []string{"", "alice", alice[2:], alice + "00", "0x9858efFD232B4033E47d90003D41EC34EcaEda94", "0xz858EfFD232B4033E47d90003D41EC34EcaEda94"} {
+		if _, err := core.ParseAddress(s); err == nil {
+			t.Fatalf("%q accepted", s)
+		}
+	}
+	if err := core.ValidateAddress(strings.ToLower(alice)); err == nil {
+		t.Fatal("unchecksummed address valid in a transaction")
+	}
+
+	tx := &core.Transaction{Type: core.TxTransfer, From: alice, To: strings.ToLower(bob), Amount: 1}
+	if err := tx.ValidateBasic(); err == nil {
+		t.Fatal("lowercase recipient accepted")
+	}
+}
+
+func TestMultisig(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var pubs []*ecdsa.PublicKey
+	for i := 0; i < 3; i++ {
+		k, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys, pubs = append(keys, k), append(pubs, &k.PublicKey)
+	}
+	ms, err := core.NewMultisig(2, pubs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reordered, _ := core.NewMultisig(2, []*ecdsa.PublicKey{pubs[2], pubs[0], pubs[1]})
+	if reordered.Address() != ms.Address() {
+		t.Fatal("multisig address depends on key order")
+	}
+	if other, _ := core.NewMultisig(1, pubs); other.Address() == ms.Address() {
+		t.Fatal("multisig address ignores the threshold")
+	}
+	if _, err := core.NewMultisig(2, []*ecdsa.PublicKey{pubs[0], pubs[0]}); err == nil {
+		t.Fatal("repeated key accepted")
+	}
+
+	tx := &core.Transaction{Type: core.TxTransfer, From: ms.Address().Hex(), To: bob, Amount: 10, MaxFee: 2, Multisig: ms}
+	a, c := *tx, *tx
+	if err := a.SignMultisig(keys[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := core.CheckTx(core.EncodeTx(&a)); err == nil {
+		t.Fatal("1 of 2 signatures accepted")
+	}
+	if err := c.SignMultisig(keys[2]); err != nil {
+		t.Fatal(err)
+	}
+	stranger, _ := crypto.GenerateKey()
+	if err := c.SignMultisig(stranger); err == nil {
+		t.Fatal("signed with a key outside the multisig")
+	}
+
+	full, err := core.CombineSignatures(&c, &a, &a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := core.CheckTx(core.EncodeTx(full))
+	if err != nil {
+		t.Fatalf("2 of 2 signatures rejected: %v", err)
+	}
+	if got.HashHex() != full.HashHex() || got.Gas() != core.GasTransfer+2*core.GasPerSignature {
+		t.Fatalf("decoded %+v", got)
+	}
+
+	dup := *full
+	dup.Signatures = [][]byte{a.Signatures[0], a.Signatures[0]}
+	if _, err := core.CheckTx(core.EncodeTx(&dup)); err == nil {
+		t.Fatal("one signer counted twice")
+	}
+	dup = *full
+	dup.Amount = 11
+	if _, err := core.CheckTx(core.EncodeTx(&dup)); err == nil {
+		t.Fatal("changed multisig tx still valid")
+	}
+}
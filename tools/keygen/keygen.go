@@ -1,23 +1,146 @@
 package main
 
 import (
-    "crypto/ecdsa"
-    "crypto/elliptic"
-    "crypto/rand"
-    "crypto/x509"
-    "encoding/hex"
-    "fmt"
+	"crypto/ecdsa"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/rockandcode4/graphene-proto/keystore"
+	"github.com/rockandcode4/graphene-proto/p2p"
 )
 
 func main() {
-    priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-    if err != nil {
-        panic(err)
-    }
+	mode := flag.String("mode", "account", "key to generate: \"account\" or \"node\" (libp2p identity)")
+	out := flag.String("out", "", "account mode: encrypted key file to write (required); node mode: also write the key to this file, e.g. <datadir>/node.key")
+	passFile := flag.String("passphrase-file", "", "account mode: read the passphrase from this file instead of prompting")
+	mnemonic := flag.Bool("mnemonic", false, "account mode: derive the key from a new mnemonic and print the mnemonic")
+	words := flag.Int("words", 24, "account mode: words in a new mnemonic, 12 or 24")
+	recoverMnemonic := flag.Bool("recover", false, "account mode: derive the key from an existing mnemonic")
+	mnemonicFile := flag.String("mnemonic-file", "", "account mode: with -recover, read the mnemonic from this file instead of prompting")
+	hdPath := flag.String("hd-path", "", "account mode: BIP-44 derivation path (default "+keystore.HDPath(0)+" with the -index)")
+	index := flag.Uint("index", 0, "account mode: account index in the default derivation path")
+	flag.Parse()
+
+	var err error
+	switch *mode {
+	case "account":
+		hd := &hdOptions{generate: *mnemonic, words: *words, recover: *recoverMnemonic, file: *mnemonicFile, path: *hdPath}
+		if hd.path == "" {
+			hd.path = keystore.HDPath(uint32(*index))
+		}
+		err = accountKey(*out, *passFile, hd)
+	case "node":
+		err = nodeKey(*out)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown mode %q\n", *mode)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// hdOptions select a key derived from a BIP-39 mnemonic, either a new one
+// or one read from file or the terminal.
+type hdOptions struct {
+	generate bool
+	words    int
+	recover  bool
+	file     string
+	path     string
+}
+
+// key returns the key chosen by h, or a random one without a mnemonic,
+// and the mnemonic if a new one was generated.
+func (h *hdOptions) key() (*ecdsa.PrivateKey, string, error) {
+	var (
+		phrase string
+		err    error
+	)
+	switch {
+	case h.generate && h.recover:
+		return nil, "", fmt.Errorf("use only one of -mnemonic and -recover")
+	case h.generate:
+		phrase, err = keystore.NewMnemonic(h.words)
+	case h.recover:
+		phrase, err = keystore.ReadMnemonic(h.file)
+	default:
+		priv, err := crypto.GenerateKey()
+		return priv, "", err
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	priv, err := keystore.DeriveKey(phrase, "", h.path)
+	if err != nil {
+		return nil, "", err
+	}
+	if h.recover {
+		phrase = ""
+	}
+	return priv, phrase, nil
+}
+
+// accountKey writes an account key, encrypted with a passphrase, to out,
+// for gfn or validator_key_file. The private key is never printed; a new
+// mnemonic is, once, since it is the only backup of the key.
+func accountKey(out, passFile string, hd *hdOptions) error {
+	if out == "" {
+		return fmt.Errorf("account mode needs -out")
+	}
+	priv, phrase, err := hd.key()
+	if err != nil {
+		return err
+	}
+	pass, err := keystore.ReadPassphrase(passFile, "Passphrase to encrypt the key: ", true)
+	if err != nil {
+		return err
+	}
+	k := &keystore.Key{PrivateKey: priv}
+	if err := keystore.WriteKeyFile(out, k, pass, keystore.StandardScryptN, keystore.StandardScryptP); err != nil {
+		return err
+	}
+
+	fmt.Println("Address:", k.Info().Address)
+	fmt.Println("Public Key:", k.Info().PubKey)
+	fmt.Println("Key File:", out)
+	if phrase != "" {
+		fmt.Println("HD Path:", hd.path)
+		fmt.Println("Mnemonic:", phrase)
+		fmt.Fprintln(os.Stderr, "Write down the mnemonic and keep it safe; keygen -recover derives the key from it again.")
+	}
+	return nil
+}
 
-    privBytes, _ := x509.MarshalECPrivateKey(priv)
-    pubBytes, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+// nodeKey prints a libp2p identity usable as node_key_hex together with the
+// peer id it yields, so bootstrap multiaddrs can be written before first start.
+func nodeKey(out string) error {
+	priv, err := p2p.GenerateIdentity()
+	if err != nil {
+		return err
+	}
+	enc, err := p2p.EncodeIdentity(priv)
+	if err != nil {
+		return err
+	}
+	pid, err := p2p.PeerIDFromKey(priv)
+	if err != nil {
+		return err
+	}
+	if out != "" {
+		if _, err := os.Stat(out); err == nil {
+			return fmt.Errorf("%s already exists", out)
+		}
+		if err := os.WriteFile(out, []byte(enc+"\n"), 0o600); err != nil {
+			return err
+		}
+	}
 
-    fmt.Println("Private Key:", hex.EncodeToString(privBytes))
-    fmt.Println("Public Key:", hex.EncodeToString(pubBytes))
+	fmt.Println("Node Key:", enc)
+	fmt.Println("Peer ID:", pid)
+	return nil
 }
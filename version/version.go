@@ -0,0 +1,15 @@
+// Package version holds the client version reported over RPC and the CLI.
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Version is the release of this client.
+const Version = "0.1.0"
+
+// ClientVersion identifies the client, e.g. "graphene/v0.1.0/linux-amd64/go1.21.5".
+func ClientVersion() string {
+	return fmt.Sprintf("graphene/v%s/%s-%s/%s", Version, runtime.GOOS, runtime.GOARCH, runtime.Version())
+}